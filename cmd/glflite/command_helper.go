@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is an action of glflite, it only accepts the listed flags.
+type command struct {
+	name        string
+	arguments   string
+	description string
+	example     string
+	flags       []string
+}
+
+var commands = []command{
+	{
+		name:        "check",
+		arguments:   "[paths...]",
+		description: "Checks if the files are up to date. With the -remote flag, it also checks that the files are stored on the remote.",
+		example:     "glflite check videos/ \"*.wav\" -force",
+		flags:       []string{"file", "force", "remote", "recursive", "progress", "quiet", "wait"},
+	},
+	{
+		name:        "update",
+		arguments:   "[paths...]",
+		description: "Creates the JSON file with the information of the new files and updates the information of the existing files. The GLFLite file of a missing file is moved to a new file with the same Sha256 sum.",
+		example:     "glflite update -track-large",
+		flags:       []string{"file", "track-large", "recursive", "progress", "quiet", "wait"},
+	},
+	{
+		name:        "push",
+		arguments:   "[paths...]",
+		description: "Copies the files that are not on the remote yet. The files are stored by their Sha256 sum.",
+		example:     "glflite push -remote offsite",
+		flags:       []string{"file", "remote", "quiet", "wait"},
+	},
+	{
+		name:        "pull",
+		arguments:   "[paths...]",
+		description: "Copies the missing files from the remote and verifies their Sha256 sum.",
+		example:     "glflite pull -remote offsite",
+		flags:       []string{"file", "remote", "quiet", "wait"},
+	},
+	{
+		name:        "fix-mtimes",
+		arguments:   "[paths...]",
+		description: "Sets the last modified date of the GLFLite file back on the files whose content didn't change, like the files copied without their dates. The content is verified with the Sha256 sum.",
+		example:     "glflite fix-mtimes videos/ -dry-run",
+		flags:       []string{"file", "dry-run", "quiet", "wait"},
+	},
+	{
+		name:        "serve",
+		description: "Shares the files over HTTP by their Sha256 sum, other clones can pull them using http://host:port as remote.",
+		example:     "GLFLITE_TOKEN=secret glflite serve -listen :8080",
+		flags:       []string{"listen", "token", "store", "allow-put", "quiet"},
+	},
+	{
+		name:        "keygen",
+		description: "Creates the key file of a remote with \"encrypt\": true in the .glflite file.",
+		example:     "glflite keygen -remote offsite",
+		flags:       []string{"remote", "quiet"},
+	},
+	{
+		name:        "gc",
+		description: "Deletes the objects of the local store, and of the remote if the -remote flag is set, that aren't referenced by the GLFLite files of the git history.",
+		example:     "glflite gc -since \"6 months ago\" -dry-run",
+		flags:       []string{"remote", "commits", "since", "grace-days", "dry-run", "quiet", "wait"},
+	},
+	{
+		name:        "log",
+		arguments:   "<path>",
+		description: "Prints the versions of a file in the git history with their commit, author, date, size, last modified date and Sha256 sum.",
+		example:     "glflite log videos/intro.mp4",
+		flags:       []string{"file", "quiet"},
+	},
+	{
+		name:        "checkout",
+		arguments:   "<path>@<revision>",
+		description: "Restores the version of a file of a git revision from the local store or the remotes, and updates its GLFLite file.",
+		example:     "glflite checkout videos/intro.mp4@HEAD~2",
+		flags:       []string{"file", "remote", "force", "quiet", "wait"},
+	},
+	{
+		name:        "diff",
+		arguments:   "[old revision] [new revision]",
+		description: "Compares the GLFLite files of two git revisions, or of a revision and the working tree, and prints the added, removed, modified and renamed files with their size difference.",
+		example:     "glflite diff HEAD~1 HEAD",
+		flags:       []string{"difftool", "quiet"},
+	},
+	{
+		name:        "mv",
+		arguments:   "<old path> <new path>",
+		description: "Moves a tracked file and its GLFLite file, the GLFLite file keeps its tracked since date.",
+		example:     "glflite mv videos/intro.mp4 archive/",
+		flags:       []string{"quiet", "wait"},
+	},
+	{
+		name:        "untrack",
+		arguments:   "<path|pattern>",
+		description: "Removes the GLFLite files of the files selected by a path, a folder or a pattern, the files are kept.",
+		example:     "glflite untrack \"*.wav\" -remove-rule",
+		flags:       []string{"file", "remove-rule", "dry-run", "quiet", "wait"},
+	},
+	{
+		name:        "prune",
+		description: "Removes the GLFLite files of the missing files that don't match the rules of the .gitignore file anymore.",
+		example:     "glflite prune -dry-run",
+		flags:       []string{"dry-run", "quiet", "wait"},
+	},
+	{
+		name:        "track",
+		arguments:   "<pattern>",
+		description: "Adds a rule to the #GitLFSLite section of the .gitignore file and lists the files that start being tracked.",
+		example:     "glflite track \"*.mov\"",
+		flags:       []string{"file", "dry-run", "quiet", "wait"},
+	},
+	{
+		name:        "untrack-pattern",
+		arguments:   "<pattern>",
+		description: "Removes a rule of the #GitLFSLite section of the .gitignore file and lists the files that stop being tracked.",
+		example:     "glflite untrack-pattern \"*.mov\" -dry-run",
+		flags:       []string{"file", "dry-run", "quiet", "wait"},
+	},
+	{
+		name:        "guard",
+		description: "Blocks the commit of the staged files that match the rules of the #GitLFSLite section or are bigger than the size threshold, 50 MB without size rules in the .glflite file.",
+		example:     "glflite guard -install-hook",
+		flags:       []string{"install-hook", "quiet"},
+	},
+	{
+		name:        "completion",
+		arguments:   "bash|zsh|fish",
+		description: "Prints the completion script of a shell.",
+		example:     "glflite completion bash > /etc/bash_completion.d/glflite",
+	},
+	{
+		name:        "help",
+		arguments:   "[command]",
+		description: "Prints the commands, or the options of a command.",
+		example:     "glflite help check",
+	},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+func getCommandNames() []string {
+	names := make([]string, 0, len(commands))
+
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+
+	return names
+}
+
+// newFlagSet returns the flags of a command, they share the values of the
+// flags defined in allFlags.
+func newFlagSet(allFlags *flag.FlagSet, cmd command) *flag.FlagSet {
+	flags := flag.NewFlagSet("glflite "+cmd.name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	// -C is accepted by all the commands
+	for _, name := range append([]string{"C"}, cmd.flags...) {
+		definition := allFlags.Lookup(name)
+
+		flags.Var(definition.Value, definition.Name, definition.Usage)
+	}
+
+	return flags
+}
+
+// parseFlags parses the flags placed before, between and after the
+// arguments, the arguments after -- are never parsed as flags.
+func parseFlags(flags *flag.FlagSet, arguments []string) ([]string, error) {
+	var positional []string
+
+	for {
+		err := flags.Parse(arguments)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rest := flags.Args()
+
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		// Parse stops after --, the argument before the rest
+		if len(arguments) > len(rest) && arguments[len(arguments)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		positional = append(positional, rest[0])
+		arguments = rest[1:]
+	}
+}
+
+// parseCommandLine returns the command and its arguments. The command is the
+// first argument, or the value of the -action flag of the older versions.
+func parseCommandLine(allFlags *flag.FlagSet, arguments []string) (command, []string, error) {
+	name := "help"
+
+	// the -C flag can be placed before the command, like with git
+	var leading []string
+
+	for len(arguments) > 0 && (arguments[0] == "-C" || strings.HasPrefix(arguments[0], "-C=")) {
+		count := 1
+
+		if arguments[0] == "-C" && len(arguments) > 1 {
+			count = 2
+		}
+
+		leading = append(leading, arguments[:count]...)
+		arguments = arguments[count:]
+	}
+
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		name = arguments[0]
+		arguments = arguments[1:]
+	} else {
+		for i := 0; i < len(arguments); i++ {
+			argument := strings.TrimPrefix(arguments[i], "-")
+
+			if argument == "-" {
+				break
+			}
+
+			if strings.HasPrefix(argument, "-action=") || strings.HasPrefix(argument, "action=") {
+				name = argument[strings.Index(argument, "=")+1:]
+				arguments = append(append([]string{}, arguments[:i]...), arguments[i+1:]...)
+				break
+			}
+
+			if (argument == "-action" || argument == "action") && i+1 < len(arguments) {
+				name = arguments[i+1]
+				arguments = append(append([]string{}, arguments[:i]...), arguments[i+2:]...)
+				break
+			}
+		}
+	}
+
+	cmd, ok := findCommand(name)
+
+	if !ok {
+		return cmd, nil, errors.New(fmt.Sprintf("Invalid command %s. Possible values: %s.", name, strings.Join(getCommandNames(), ", ")))
+	}
+
+	args, err := parseFlags(newFlagSet(allFlags, cmd), append(leading, arguments...))
+
+	if errors.Is(err, flag.ErrHelp) {
+		return command{name: "help"}, []string{cmd.name}, nil
+	}
+
+	if err != nil {
+		return cmd, nil, errors.New(fmt.Sprintf("%s. Run glflite help %s to see its options.", err.Error(), cmd.name))
+	}
+
+	return cmd, args, nil
+}
+
+// printHelp prints the commands, or the usage and the options of a command.
+func printHelp(allFlags *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		fmt.Println("GitLFSLite is a tool to help you manage your large files in your git repository. It adds a JSON file to your repository with the information of each file so that you can check if the files are up to date. It also  helps you to keep a remote copy of the files using rsync.")
+		fmt.Println("GitLFSLite version " + version)
+		fmt.Println("Usage: glflite [-C folder] <command> [options] [arguments]")
+		fmt.Println("Commands:")
+
+		for _, cmd := range commands {
+			fmt.Printf("  %-16s %s\n", cmd.name, cmd.description)
+		}
+
+		fmt.Println("Run glflite help <command> to see the options of a command. The options can be placed before or after the arguments.")
+		fmt.Println("The paths are relative to the current folder, and the check, update, push and pull commands only process the files of the current folder by default. -C runs glflite as if it was started in another folder.")
+		fmt.Println("The #GitLFSLite section of the .gitignore file goes until the end of the file or until a #EndGitLFSLite line.")
+		fmt.Println("To sync the files, use the rsync command with the list of files in the rsync_list_glflite file.")
+		fmt.Println("Example:")
+		fmt.Println("   rsync -v -t --ignore-missing-args --files-from=rsync_list_glflite . [destination]")
+
+		return nil
+	}
+
+	cmd, ok := findCommand(args[0])
+
+	if !ok {
+		return errors.New(fmt.Sprintf("Invalid command %s. Possible values: %s.", args[0], strings.Join(getCommandNames(), ", ")))
+	}
+
+	usage := "Usage: glflite " + cmd.name
+
+	if len(cmd.flags) > 0 {
+		usage += " [options]"
+	}
+
+	if cmd.arguments != "" {
+		usage += " " + cmd.arguments
+	}
+
+	fmt.Println(usage)
+	fmt.Println(cmd.description)
+	fmt.Println("Example: " + cmd.example)
+
+	if len(cmd.flags) > 0 {
+		fmt.Println("Options:")
+
+		flags := newFlagSet(allFlags, cmd)
+		flags.SetOutput(os.Stdout)
+		flags.PrintDefaults()
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// newTestFlags returns the flags of all the commands, like the ones defined
+// by main.
+func newTestFlags() *flag.FlagSet {
+	allFlags := flag.NewFlagSet("glflite", flag.ContinueOnError)
+
+	for _, name := range []string{"force", "quiet", "allow-put", "dry-run", "remove-rule", "track-large", "install-hook", "wait", "difftool", "recursive"} {
+		allFlags.Bool(name, false, "The "+name+" flag. It doesn't take a value.")
+	}
+
+	for _, name := range []string{"file", "remote", "listen", "token", "store", "since", "progress", "C"} {
+		allFlags.String(name, "", "The "+name+" flag.")
+	}
+
+	allFlags.Int("commits", 0, "Number of commits.")
+	allFlags.Int("grace-days", 14, "Days of the grace period.")
+
+	return allFlags
+}
+
+func TestParseCommandLine(t *testing.T) {
+	for _, test := range []struct {
+		arguments string
+		command   string
+		args      string
+		flags     string
+	}{
+		{"", "help", "", ""},
+		{"check -force -remote offsite", "check", "", "force=true remote=offsite"},
+		{"log videos/intro.mp4 -quiet", "log", "videos/intro.mp4", "quiet=true"},
+		{"mv -wait videos/intro.mp4 -quiet archive/", "mv", "videos/intro.mp4,archive/", "wait=true quiet=true"},
+		{"diff -quiet -- -HEAD -difftool", "diff", "-HEAD,-difftool", "quiet=true difftool=false"},
+		{"gc -commits=3 -since 2024-01-31", "gc", "", "commits=3 since=2024-01-31"},
+		{"-action update -quiet", "update", "", "quiet=true"},
+		{"-quiet --action=push", "push", "", "quiet=true"},
+		{"check -h", "help", "check", ""},
+		{"-C videos log intro.mp4", "log", "intro.mp4", "C=videos"},
+		{"-C=videos -C ../photos prune -dry-run", "prune", "", "C=../photos dry-run=true"},
+		{"update -C videos", "update", "", "C=videos"},
+	} {
+		allFlags := newTestFlags()
+
+		var arguments []string
+
+		if test.arguments != "" {
+			arguments = strings.Split(test.arguments, " ")
+		}
+
+		cmd, args, err := parseCommandLine(allFlags, arguments)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.arguments, err.Error())
+			continue
+		}
+
+		if cmd.name != test.command || strings.Join(args, ",") != test.args {
+			t.Errorf("%s: the command is %s with the arguments %v", test.arguments, cmd.name, args)
+		}
+
+		if test.flags == "" {
+			continue
+		}
+
+		for _, value := range strings.Split(test.flags, " ") {
+			name, expected, _ := strings.Cut(value, "=")
+
+			if allFlags.Lookup(name).Value.String() != expected {
+				t.Errorf("%s: the flag %s is %s", test.arguments, name, allFlags.Lookup(name).Value.String())
+			}
+		}
+	}
+
+	for arguments, message := range map[string]string{
+		"commit -quiet":     "Invalid command commit",
+		"-action commit":    "Invalid command commit",
+		"push -force":       "glflite help push",
+		"check -remote":     "glflite help check",
+		"gc -commits three": "glflite help gc",
+	} {
+		_, _, err := parseCommandLine(newTestFlags(), strings.Split(arguments, " "))
+
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: the error is %v", arguments, err)
+		}
+	}
+}
+
+func TestCommandFlagsAreDefined(t *testing.T) {
+	allFlags := newTestFlags()
+
+	for _, cmd := range commands {
+		if cmd.description == "" || cmd.example == "" || !strings.HasPrefix(cmd.example, "glflite "+cmd.name) && !strings.Contains(cmd.example, " glflite "+cmd.name) {
+			t.Errorf("the command %s doesn't have a description or an example", cmd.name)
+		}
+
+		for _, name := range cmd.flags {
+			if allFlags.Lookup(name) == nil {
+				t.Errorf("the flag %s of the command %s isn't defined", name, cmd.name)
+			}
+		}
+	}
+}
+
+func TestPrintHelp(t *testing.T) {
+	allFlags := newTestFlags()
+
+	var err error
+
+	output := captureOutput(t, func() {
+		err = printHelp(allFlags, nil)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range getCommandNames() {
+		if !strings.Contains(output, "\n  "+name+" ") {
+			t.Errorf("the help doesn't list the command %s", name)
+		}
+	}
+
+	output = captureOutput(t, func() {
+		err = printHelp(allFlags, []string{"checkout"})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the flags of the command are listed
+	if !strings.HasPrefix(output, "Usage: glflite checkout [options] <path>@<revision>\n") || !strings.Contains(output, "  -force\n") || strings.Contains(output, "-dry-run") {
+		t.Errorf("the help of the checkout command is:\n%s", output)
+	}
+
+	err = printHelp(allFlags, []string{"commit"})
+
+	if err == nil {
+		t.Error("the help of an invalid command was printed")
+	}
+}
+
+func TestPrintCompletion(t *testing.T) {
+	allFlags := newTestFlags()
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var err error
+
+		output := captureOutput(t, func() {
+			err = printCompletion(allFlags, []string{shell})
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range []string{"untrack-pattern", "install-hook", "grace-days"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("the %s completion doesn't contain %s", shell, expected)
+			}
+		}
+
+		// the script has to be valid for the shell
+		if _, err := exec.LookPath(shell); err == nil {
+			cmd := exec.Command(shell, "-n")
+			cmd.Stdin = strings.NewReader(output)
+
+			if shell == "fish" {
+				cmd = exec.Command(shell, "--no-execute")
+				cmd.Stdin = strings.NewReader(output)
+			}
+
+			result, err := cmd.CombinedOutput()
+
+			if err != nil {
+				t.Errorf("the %s completion isn't valid: %s: %s", shell, err.Error(), result)
+			}
+		}
+	}
+
+	for _, args := range [][]string{nil, {"powershell"}} {
+		if printCompletion(allFlags, args) == nil {
+			t.Errorf("the completion of %v was printed", args)
+		}
+	}
+}
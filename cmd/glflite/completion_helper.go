@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// isBoolFlag tells if a flag doesn't take a value.
+func isBoolFlag(definition *flag.Flag) bool {
+	boolFlag, ok := definition.Value.(interface{ IsBoolFlag() bool })
+
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// getShortUsage returns the first sentence of the usage of a flag, for the
+// shells that show a description next to each flag.
+func getShortUsage(usage string) string {
+	if i := strings.Index(usage, ". "); i >= 0 {
+		usage = usage[:i]
+	}
+
+	return strings.TrimSuffix(usage, ".")
+}
+
+// printCompletion prints the completion script of a shell, generated from
+// the commands and their flags.
+func printCompletion(allFlags *flag.FlagSet, args []string) error {
+	if len(args) != 1 {
+		return errors.New("No shell specified. Usage: glflite completion bash|zsh|fish")
+	}
+
+	switch args[0] {
+	case "bash":
+		printBashCompletion()
+	case "zsh":
+		printZshCompletion(allFlags)
+	case "fish":
+		printFishCompletion(allFlags)
+	default:
+		return errors.New(fmt.Sprintf("Invalid shell %s. Possible values: bash, zsh, fish.", args[0]))
+	}
+
+	return nil
+}
+
+func printBashCompletion() {
+	fmt.Println("# bash completion for glflite, generated by glflite completion bash")
+	fmt.Println("_glflite() {")
+	fmt.Println("	local cur=\"${COMP_WORDS[COMP_CWORD]}\"")
+	fmt.Println("	local options=\"\"")
+	fmt.Println()
+	fmt.Println("	if [ \"$COMP_CWORD\" -eq 1 ]; then")
+	fmt.Printf("		COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(getCommandNames(), " "))
+	fmt.Println("		return")
+	fmt.Println("	fi")
+	fmt.Println()
+	fmt.Println("	case \"${COMP_WORDS[1]}\" in")
+	fmt.Println("	help)")
+	fmt.Printf("		COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(getCommandNames(), " "))
+	fmt.Println("		return")
+	fmt.Println("		;;")
+	fmt.Println("	completion)")
+	fmt.Println("		COMPREPLY=($(compgen -W \"bash zsh fish\" -- \"$cur\"))")
+	fmt.Println("		return")
+	fmt.Println("		;;")
+
+	for _, cmd := range commands {
+		if len(cmd.flags) == 0 {
+			continue
+		}
+
+		options := make([]string, 0, len(cmd.flags))
+
+		for _, name := range cmd.flags {
+			options = append(options, "-"+name)
+		}
+
+		fmt.Printf("	%s)\n", cmd.name)
+		fmt.Printf("		options=\"%s\"\n", strings.Join(options, " "))
+		fmt.Println("		;;")
+	}
+
+	fmt.Println("	esac")
+	fmt.Println()
+	fmt.Println("	if [[ \"$cur\" == -* ]]; then")
+	fmt.Println("		COMPREPLY=($(compgen -W \"$options\" -- \"$cur\"))")
+	fmt.Println("	else")
+	fmt.Println("		COMPREPLY=($(compgen -f -- \"$cur\"))")
+	fmt.Println("	fi")
+	fmt.Println("}")
+	fmt.Println()
+	fmt.Println("complete -o filenames -F _glflite glflite")
+}
+
+// zshQuote escapes a description for the single quoted specs of _describe
+// and _arguments.
+func zshQuote(text string) string {
+	replacer := strings.NewReplacer("'", "'\\''", "[", "\\[", "]", "\\]")
+
+	return replacer.Replace(text)
+}
+
+func printZshCompletion(allFlags *flag.FlagSet) {
+	fmt.Println("#compdef glflite")
+	fmt.Println("# zsh completion for glflite, generated by glflite completion zsh")
+	fmt.Println()
+	fmt.Println("_glflite() {")
+	fmt.Println("	local -a commands")
+	fmt.Println("	commands=(")
+
+	for _, cmd := range commands {
+		fmt.Printf("		'%s:%s'\n", cmd.name, zshQuote(getShortUsage(cmd.description)))
+	}
+
+	fmt.Println("	)")
+	fmt.Println()
+	fmt.Println("	if (( CURRENT == 2 )); then")
+	fmt.Println("		_describe 'command' commands")
+	fmt.Println("		return")
+	fmt.Println("	fi")
+	fmt.Println()
+	fmt.Println("	local command=$words[2]")
+	fmt.Println("	shift words")
+	fmt.Println("	(( CURRENT-- ))")
+	fmt.Println()
+	fmt.Println("	case $command in")
+	fmt.Println("	help)")
+	fmt.Println("		_describe 'command' commands")
+	fmt.Println("		;;")
+	fmt.Println("	completion)")
+	fmt.Println("		_values 'shell' bash zsh fish")
+	fmt.Println("		;;")
+
+	for _, cmd := range commands {
+		if len(cmd.flags) == 0 {
+			continue
+		}
+
+		fmt.Printf("	%s)\n", cmd.name)
+		fmt.Println("		_arguments \\")
+
+		for _, name := range cmd.flags {
+			definition := allFlags.Lookup(name)
+
+			spec := fmt.Sprintf("-%s[%s]", name, zshQuote(getShortUsage(definition.Usage)))
+
+			if name == "file" {
+				spec += ":file:_files"
+			} else if !isBoolFlag(definition) {
+				spec += ":" + name + ":"
+			}
+
+			fmt.Printf("			'%s' \\\n", spec)
+		}
+
+		fmt.Println("			'*:file:_files'")
+		fmt.Println("		;;")
+	}
+
+	fmt.Println("	esac")
+	fmt.Println("}")
+	fmt.Println()
+	fmt.Println("compdef _glflite glflite")
+}
+
+// fishQuote escapes a description for a single quoted fish string.
+func fishQuote(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(text)
+}
+
+func printFishCompletion(allFlags *flag.FlagSet) {
+	fmt.Println("# fish completion for glflite, generated by glflite completion fish")
+
+	for _, cmd := range commands {
+		fmt.Printf("complete -c glflite -n __fish_use_subcommand -f -a %s -d '%s'\n", cmd.name, fishQuote(getShortUsage(cmd.description)))
+	}
+
+	fmt.Printf("complete -c glflite -n '__fish_seen_subcommand_from help' -f -a '%s'\n", strings.Join(getCommandNames(), " "))
+	fmt.Println("complete -c glflite -n '__fish_seen_subcommand_from completion' -f -a 'bash zsh fish'")
+
+	for _, cmd := range commands {
+		for _, name := range cmd.flags {
+			definition := allFlags.Lookup(name)
+
+			line := fmt.Sprintf("complete -c glflite -n '__fish_seen_subcommand_from %s' -o %s -d '%s'", cmd.name, name, fishQuote(getShortUsage(definition.Usage)))
+
+			if !isBoolFlag(definition) {
+				line += " -r"
+			}
+
+			fmt.Println(line)
+		}
+	}
+}
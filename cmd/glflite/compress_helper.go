@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedObjectSuffix is added to the name of the compressed objects, so
+// the files can be pulled even if the compression rules changed since they
+// were pushed.
+const compressedObjectSuffix = ".zst"
+
+// minimumCompressedSize is the size of the smallest zstd frame: the magic
+// number, the frame header and a block header with one byte. An empty file
+// is compressed to an empty object.
+const minimumCompressedSize = 4 + 2 + 3 + 1
+
+// zstdMagic is the magic number at the start of the zstd frames.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// shouldCompress tells if a file matches the compression rules of the setup
+// file, the rules use the same patterns as the .gitignore file.
+func (app *application) shouldCompress(filePath string) bool {
+	return isFileExcluded(app.config.setup.Compress, filePath, false)
+}
+
+func compressContent(level int, destination io.Writer, source io.Reader) error {
+	encoderLevel := zstd.SpeedDefault
+
+	if level > 0 {
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+
+	encoder, err := zstd.NewWriter(destination, zstd.WithEncoderLevel(encoderLevel))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(encoder, source)
+
+	if err != nil {
+		encoder.Close()
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func decompressContent(destination io.Writer, source io.Reader) error {
+	decoder, err := zstd.NewReader(source)
+
+	if err != nil {
+		return err
+	}
+
+	defer decoder.Close()
+
+	_, err = io.Copy(destination, decoder)
+
+	return err
+}
+
+func formatSize(size int64) string {
+	if size > 1024*1024*1024 {
+		return fmt.Sprintf("%.1f GB", float64(size)/(1024*1024*1024))
+	} else if size > 1024*1024 {
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	} else if size > 1024 {
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+
+	return fmt.Sprintf("%d B", size)
+}
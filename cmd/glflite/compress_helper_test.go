@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompressedPushAndPull(t *testing.T) {
+	files := map[string]string{
+		"logs/server.log":  strings.Repeat("GET /index.html 200\n", 1000),
+		"videos/intro.mp4": strings.Repeat("intro video ", 1000),
+	}
+
+	for _, encrypt := range []bool{false, true} {
+		app := newTestApplication(t, files)
+		app.config.setup.Compress = []string{"*.log"}
+
+		keyFile := t.TempDir() + "/offsite.key"
+		storeFolder := t.TempDir()
+
+		err := generateKeyFile(keyFile)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app.config.setup.Remotes = map[string]remoteConfig{
+			"offsite": {URL: storeFolder, Encrypt: encrypt, KeyFile: keyFile},
+		}
+
+		conn, err := app.openRemote("offsite")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output := captureOutput(t, func() {
+			err = app.pushFiles(conn)
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(output, "Space saved by compression: ") {
+			t.Errorf("the push didn't print the space saved:\n%s", output)
+		}
+
+		// only the files of the compression rules are compressed, the name of the object tells it
+		compressed := readTestObject(t, storeFolder, conn.getObjectKey(getTestShasum(files["logs/server.log"]))+compressedObjectSuffix)
+
+		if compressed == "" || len(compressed) >= len(files["logs/server.log"])/10 {
+			t.Errorf("the log file was stored with %d bytes, encrypted: %t", len(compressed), encrypt)
+		}
+
+		stored := readTestObject(t, storeFolder, conn.getObjectKey(getTestShasum(files["videos/intro.mp4"])))
+
+		if int64(len(stored)) != conn.getStoredSize(int64(len(files["videos/intro.mp4"]))) {
+			t.Errorf("the video was stored with %d bytes, encrypted: %t", len(stored), encrypt)
+		}
+
+		for filePath := range files {
+			err = os.Remove(app.getFullPath(filePath))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file := app.trackedFiles[filePath]
+			file.isPresent = false
+			app.trackedFiles[filePath] = file
+		}
+
+		// the rules changed since the push, the objects are found with their suffix
+		app.config.setup.Compress = []string{"*.mp4"}
+
+		err = app.pullFiles(conn)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for filePath, content := range files {
+			if readTestFile(t, app, filePath) != content {
+				t.Errorf("%s wasn't pulled, encrypted: %t", filePath, encrypt)
+			}
+		}
+	}
+}
+
+func TestCompressContent(t *testing.T) {
+	for _, level := range []int{0, 1, 3, 19} {
+		for _, content := range []string{"", "a", strings.Repeat("GET /index.html 200\n", 1000)} {
+			var compressed, decompressed bytes.Buffer
+
+			err := compressContent(level, &compressed, strings.NewReader(content))
+
+			if err == nil {
+				err = decompressContent(&decompressed, &compressed)
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decompressed.String() != content {
+				t.Errorf("the content of %d bytes changed with the level %d", len(content), level)
+			}
+		}
+	}
+}
+
+func TestCheckRemoteCompressedObjects(t *testing.T) {
+	files := map[string]string{
+		"logs/server.log": strings.Repeat("GET /index.html 200\n", 1000),
+		"logs/empty.log":  "",
+		"logs/cut.log":    strings.Repeat("GET /about.html 200\n", 1000),
+		"logs/other.log":  strings.Repeat("GET /contact.html 200\n", 1000),
+	}
+
+	app := newTestApplication(t, files)
+	app.config.setup.Compress = []string{"*.log"}
+
+	storeFolder := t.TempDir()
+
+	conn, err := app.openRemote(storeFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureOutput(t, func() {
+		err = app.checkRemote(conn, false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "Files on the remote: 4\n") {
+		t.Fatalf("the compressed objects weren't found on the remote:\n%s", output)
+	}
+
+	// the empty file is stored as an empty object
+	err = os.Remove(app.getFullPath("logs/empty.log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["logs/empty.log"]
+	file.isPresent = false
+	app.trackedFiles["logs/empty.log"] = file
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fileExists(app.getFullPath("logs/empty.log")) {
+		t.Error("the empty file wasn't pulled")
+	}
+
+	// an upload cut before the first byte, and an object that isn't compressed
+	for filePath, content := range map[string]string{"logs/cut.log": "", "logs/other.log": files["logs/other.log"]} {
+		objectFile := storeFolder + "/" + getObjectPath(getTestShasum(files[filePath])+compressedObjectSuffix)
+
+		err = os.WriteFile(objectFile, []byte(content), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output = captureOutput(t, func() {
+		err = app.checkRemote(conn, false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, summary := range []string{"Files on the remote: 2\n", "Files corrupted on the remote: 2\n", "logs/cut.log: Corrupted on the remote\n", "logs/other.log: Corrupted on the remote\n"} {
+		if !strings.Contains(output, summary) {
+			t.Errorf("the check of the remote didn't print %q:\n%s", summary, output)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	encryptionMagic     = "GLFLENC1"
+	encryptionSaltSize  = 16
+	encryptionChunkSize = 64 * 1024
+	encryptionTagSize   = 16
+)
+
+var ErrDecryptionFailed = errors.New("the object can't be decrypted, it was modified or encrypted with another key")
+
+// objectCipher encrypts the objects stored on untrusted remotes with
+// AES-256-GCM. The content is split in chunks that are authenticated one by
+// one, so big files are encrypted as a stream, and the object names are an
+// HMAC of the Sha256 sum so that they don't reveal the content.
+//
+// Object format: magic | salt | chunk 0 | ... | chunk n, each chunk is sealed
+// with a key derived from the salt and the object name, and a nonce made of
+// the chunk number and a flag set on the last chunk to detect truncation.
+type objectCipher struct {
+	encryptionKey []byte
+	nameKey       []byte
+}
+
+func getDefaultKeyFile(remoteName string) (string, error) {
+	configFolder, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return configFolder + "/glflite/keys/" + remoteName + ".key", nil
+}
+
+func generateKeyFile(keyFile string) error {
+	if fileExists(keyFile) {
+		return errors.New(fmt.Sprintf("The key file %s already exists", keyFile))
+	}
+
+	key := make([]byte, 32)
+
+	_, err := rand.Read(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(keyFile), 0700)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+func readObjectCipher(keyFile string) (*objectCipher, error) {
+	content, err := os.ReadFile(keyFile)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.New(fmt.Sprintf("The key file %s doesn't exist, create it with the keygen action", keyFile))
+	} else if err != nil {
+		return nil, err
+	}
+
+	masterKey, err := hex.DecodeString(strings.TrimSpace(string(content)))
+
+	if err != nil || len(masterKey) != 32 {
+		return nil, errors.New(fmt.Sprintf("The key file %s must contain a 32 bytes key in hexadecimal", keyFile))
+	}
+
+	objectCipher := &objectCipher{
+		encryptionKey: make([]byte, 32),
+		nameKey:       make([]byte, 32),
+	}
+
+	_, err = io.ReadFull(hkdf.New(sha256.New, masterKey, nil, []byte("glflite encryption key")), objectCipher.encryptionKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.ReadFull(hkdf.New(sha256.New, masterKey, nil, []byte("glflite name key")), objectCipher.nameKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return objectCipher, nil
+}
+
+func (c *objectCipher) getObjectKey(shaSum string) string {
+	mac := hmac.New(sha256.New, c.nameKey)
+	mac.Write([]byte(shaSum))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *objectCipher) getEncryptedSize(size int64) int64 {
+	chunks := (size + encryptionChunkSize - 1) / encryptionChunkSize
+
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	return int64(len(encryptionMagic)) + encryptionSaltSize + size + chunks*encryptionTagSize
+}
+
+func (c *objectCipher) newAEAD(key string, salt []byte) (cipher.AEAD, error) {
+	objectKey := make([]byte, 32)
+
+	_, err := io.ReadFull(hkdf.New(sha256.New, c.encryptionKey, salt, []byte("glflite object "+key)), objectKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(objectKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func getChunkNonce(chunk uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], chunk)
+
+	if last {
+		nonce[11] = 1
+	}
+
+	return nonce
+}
+
+// readChunk reads the next chunk and tells if it is the last one.
+func readChunk(reader *bufio.Reader, buffer []byte) (int, bool, error) {
+	n, err := io.ReadFull(reader, buffer)
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+
+	_, err = reader.Peek(1)
+
+	if err == io.EOF {
+		return n, true, nil
+	}
+
+	return n, false, err
+}
+
+func (c *objectCipher) encrypt(key string, destination io.Writer, source io.Reader) error {
+	salt := make([]byte, encryptionSaltSize)
+
+	_, err := rand.Read(salt)
+
+	if err != nil {
+		return err
+	}
+
+	aead, err := c.newAEAD(key, salt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = destination.Write(append([]byte(encryptionMagic), salt...))
+
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(source, encryptionChunkSize)
+	buffer := make([]byte, encryptionChunkSize)
+	sealed := make([]byte, 0, encryptionChunkSize+encryptionTagSize)
+
+	for chunk := uint64(0); ; chunk++ {
+		n, last, err := readChunk(reader, buffer)
+
+		if err != nil {
+			return err
+		}
+
+		sealed = aead.Seal(sealed[:0], getChunkNonce(chunk, last), buffer[:n], nil)
+
+		_, err = destination.Write(sealed)
+
+		if err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+func (c *objectCipher) decrypt(key string, destination io.Writer, source io.Reader) error {
+	reader := bufio.NewReaderSize(source, encryptionChunkSize+encryptionTagSize)
+
+	header := make([]byte, len(encryptionMagic)+encryptionSaltSize)
+
+	_, err := io.ReadFull(reader, header)
+
+	if err != nil || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return ErrDecryptionFailed
+	}
+
+	aead, err := c.newAEAD(key, header[len(encryptionMagic):])
+
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, encryptionChunkSize+encryptionTagSize)
+	opened := make([]byte, 0, encryptionChunkSize)
+
+	for chunk := uint64(0); ; chunk++ {
+		n, last, err := readChunk(reader, buffer)
+
+		if err != nil {
+			return err
+		}
+
+		opened, err = aead.Open(opened[:0], getChunkNonce(chunk, last), buffer[:n], nil)
+
+		if err != nil {
+			return ErrDecryptionFailed
+		}
+
+		_, err = destination.Write(opened)
+
+		if err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) *objectCipher {
+	t.Helper()
+
+	keyFile := t.TempDir() + "/keys/offsite.key"
+
+	err := generateKeyFile(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := readObjectCipher(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// getTestContent returns a content of the given size that is different in
+// every chunk, so that the chunks can't be swapped without being detected.
+func getTestContent(size int) []byte {
+	content := make([]byte, size)
+
+	for i := range content {
+		content[i] = byte(i / 7)
+	}
+
+	return content
+}
+
+func encryptTestContent(t *testing.T, c *objectCipher, key string, content []byte) []byte {
+	t.Helper()
+
+	var encrypted bytes.Buffer
+
+	err := c.encrypt(key, &encrypted, bytes.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encrypted.Bytes()
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+	key := c.getObjectKey(getTestShasum("intro video"))
+
+	for _, test := range []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one byte", 1},
+		{"one chunk minus one byte", encryptionChunkSize - 1},
+		{"exactly one chunk", encryptionChunkSize},
+		{"one chunk plus one byte", encryptionChunkSize + 1},
+		{"exactly three chunks", 3 * encryptionChunkSize},
+		{"three chunks and a half", 3*encryptionChunkSize + encryptionChunkSize/2},
+	} {
+		content := getTestContent(test.size)
+		encrypted := encryptTestContent(t, c, key, content)
+
+		if int64(len(encrypted)) != c.getEncryptedSize(int64(test.size)) {
+			t.Errorf("%s: the encrypted object has %d bytes, expected %d", test.name, len(encrypted), c.getEncryptedSize(int64(test.size)))
+		}
+
+		if test.size > 16 && bytes.Contains(encrypted, content[:16]) {
+			t.Errorf("%s: the encrypted object contains the content", test.name)
+		}
+
+		var decrypted bytes.Buffer
+
+		err := c.decrypt(key, &decrypted, bytes.NewReader(encrypted))
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+		} else if !bytes.Equal(decrypted.Bytes(), content) {
+			t.Errorf("%s: the decrypted content is different", test.name)
+		}
+	}
+}
+
+func TestDecryptDetectsModifiedObjects(t *testing.T) {
+	c := newTestCipher(t)
+	key := c.getObjectKey(getTestShasum("intro video"))
+
+	content := getTestContent(3 * encryptionChunkSize)
+	encrypted := encryptTestContent(t, c, key, content)
+
+	header := len(encryptionMagic) + encryptionSaltSize
+	sealedChunk := encryptionChunkSize + encryptionTagSize
+
+	// the chunk i of the encrypted object
+	chunk := func(i int) []byte {
+		return encrypted[header+i*sealedChunk : header+(i+1)*sealedChunk]
+	}
+
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	flipped := append([]byte{}, encrypted...)
+	flipped[header+10] ^= 1
+
+	for _, test := range []struct {
+		name   string
+		cipher *objectCipher
+		key    string
+		object []byte
+	}{
+		{"wrong key", newTestCipher(t), key, encrypted},
+		{"another object name", c, c.getObjectKey(getTestShasum("outro video")), encrypted},
+		{"modified byte", c, key, flipped},
+		{"last chunk removed", c, key, encrypted[:header+2*sealedChunk]},
+		{"cut inside a chunk", c, key, encrypted[:header+sealedChunk+100]},
+		{"chunks swapped", c, key, join(encrypted[:header], chunk(1), chunk(0), chunk(2))},
+		{"last chunk repeated", c, key, join(encrypted, chunk(2))},
+		{"header only", c, key, encrypted[:header]},
+		{"not encrypted", c, key, content},
+		{"empty", c, key, nil},
+	} {
+		var decrypted bytes.Buffer
+
+		err := test.cipher.decrypt(test.key, &decrypted, bytes.NewReader(test.object))
+
+		if !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("%s: the decryption returned %v", test.name, err)
+		}
+	}
+
+	// a chunk that isn't the last one can't pass for the end of the object
+	short := encryptTestContent(t, c, key, getTestContent(encryptionChunkSize))
+	long := encryptTestContent(t, c, key, getTestContent(2*encryptionChunkSize))
+
+	var decrypted bytes.Buffer
+
+	err := c.decrypt(key, &decrypted, bytes.NewReader(long[:len(short)]))
+
+	if !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("the first chunk of a longer object was decrypted as a whole object: %v", err)
+	}
+}
+
+func TestObjectCipherKeys(t *testing.T) {
+	keyFile := t.TempDir() + "/offsite.key"
+
+	err := generateKeyFile(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = generateKeyFile(keyFile)
+
+	if err == nil {
+		t.Error("the existing key file was replaced")
+	}
+
+	info, err := os.Stat(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the key file can be read by others: %s", info.Mode().Perm())
+	}
+
+	c, err := readObjectCipher(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := readObjectCipher(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shaSum := getTestShasum("intro video")
+
+	if c.getObjectKey(shaSum) != same.getObjectKey(shaSum) || len(c.getObjectKey(shaSum)) != 64 {
+		t.Errorf("the name of the object is %s, then %s", c.getObjectKey(shaSum), same.getObjectKey(shaSum))
+	}
+
+	if c.getObjectKey(shaSum) == shaSum || newTestCipher(t).getObjectKey(shaSum) == c.getObjectKey(shaSum) {
+		t.Error("the name of the object doesn't depend on the key")
+	}
+
+	for name, content := range map[string]string{"short": "0123abcd\n", "not hexadecimal": strings.Repeat("zz", 32)} {
+		invalidFile := t.TempDir() + "/invalid.key"
+
+		err = os.WriteFile(invalidFile, []byte(content), 0600)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = readObjectCipher(invalidFile)
+
+		if err == nil {
+			t.Errorf("the %s key was read", name)
+		}
+	}
+
+	_, err = readObjectCipher(t.TempDir() + "/missing.key")
+
+	if err == nil {
+		t.Error("a missing key file was read")
+	}
+}
+
+func TestEncryptedPushAndPull(t *testing.T) {
+	content := strings.Repeat("intro video ", 10000)
+
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": content})
+
+	keyFile := t.TempDir() + "/offsite.key"
+	storeFolder := t.TempDir()
+
+	err := generateKeyFile(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.config.setup.Remotes = map[string]remoteConfig{
+		"offsite": {URL: storeFolder, Encrypt: true, KeyFile: keyFile},
+	}
+
+	conn, err := app.openRemote("offsite")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the object is named by the HMAC of the Sha256 sum and doesn't contain the file
+	if readTestObject(t, storeFolder, getTestShasum(content)) != "" {
+		t.Error("the object is named by the Sha256 sum of the file")
+	}
+
+	encrypted := readTestObject(t, storeFolder, conn.cipher.getObjectKey(getTestShasum(content)))
+
+	if int64(len(encrypted)) != conn.cipher.getEncryptedSize(int64(len(content))) || strings.Contains(encrypted, "intro video") {
+		t.Fatalf("the object of the file has %d bytes", len(encrypted))
+	}
+
+	err = os.Remove(app.getFullPath("videos/intro.mp4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["videos/intro.mp4"]
+	file.isPresent = false
+	app.trackedFiles["videos/intro.mp4"] = file
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestFile(t, app, "videos/intro.mp4") != content {
+		t.Error("the encrypted file wasn't pulled")
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	fileAdded    = "A"
+	fileRemoved  = "D"
+	fileModified = "M"
+	fileRenamed  = "R"
+)
+
+// fileChange is a difference between two sets of GLFLite files. Renamed
+// files keep the same Sha256 sum with a new path.
+type fileChange struct {
+	status  string
+	oldPath string
+	newPath string
+	oldData fileData
+	newData fileData
+}
+
+func (change fileChange) getPath() string {
+	if change.newPath != "" {
+		return change.newPath
+	}
+
+	return change.oldPath
+}
+
+func (change fileChange) getSizeDelta() int64 {
+	return change.newData.Size - change.oldData.Size
+}
+
+// getRevisionFiles returns the GLFLite files of a git revision by the path of
+// their tracked file.
+func (app *application) getRevisionFiles(revision string) (map[string]fileData, error) {
+	_, err := app.runGit("rev-parse", "--verify", "--quiet", revision+"^{tree}")
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unknown revision %s", revision))
+	}
+
+	output, err := app.runGit("ls-tree", "-r", "-z", revision)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []gitBlob
+
+	// the entries of ls-tree are "<mode> <type> <hash>\t<path>"
+	for _, entry := range strings.Split(string(output), "\x00") {
+		info, filePath, found := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+
+		if !found || len(fields) != 3 || fields[1] != "blob" || filePath == setupFile || !isGLFLiteFile(filePath) {
+			continue
+		}
+
+		blobs = append(blobs, gitBlob{hash: fields[2], path: filePath})
+	}
+
+	files, err := app.readGitBlobs(blobs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	revisionFiles := make(map[string]fileData)
+
+	for i, data := range files {
+		if data.Sha256Sum != "" {
+			revisionFiles[getTrackedFilePath(blobs[i].path)] = data
+		}
+	}
+
+	return revisionFiles, nil
+}
+
+// getWorkingTreeFiles returns the GLFLite files of the working tree by the
+// path of their tracked file.
+func (app *application) getWorkingTreeFiles() (map[string]fileData, error) {
+	workingTreeFiles := make(map[string]fileData)
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		data, err := app.readJSONFile(fileFullPath)
+
+		if errors.Is(err, ErrGLFLiteFileNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		workingTreeFiles[fileFullPath] = data
+	}
+
+	return workingTreeFiles, nil
+}
+
+// compareFileSets returns the changes between two sets of GLFLite files
+// sorted by path. A removed file and an added file with the same Sha256 sum
+// are reported as a rename.
+func compareFileSets(oldFiles map[string]fileData, newFiles map[string]fileData) []fileChange {
+	var changes []fileChange
+	var addedPaths []string
+
+	removedPaths := make(map[string][]string)
+
+	for filePath, oldData := range oldFiles {
+		newData, ok := newFiles[filePath]
+
+		if !ok {
+			removedPaths[oldData.Sha256Sum] = append(removedPaths[oldData.Sha256Sum], filePath)
+		} else if newData.Sha256Sum != oldData.Sha256Sum {
+			changes = append(changes, fileChange{status: fileModified, oldPath: filePath, newPath: filePath, oldData: oldData, newData: newData})
+		}
+	}
+
+	for filePath := range newFiles {
+		if _, ok := oldFiles[filePath]; !ok {
+			addedPaths = append(addedPaths, filePath)
+		}
+	}
+
+	sort.Strings(addedPaths)
+
+	for _, paths := range removedPaths {
+		sort.Strings(paths)
+	}
+
+	for _, filePath := range addedPaths {
+		newData := newFiles[filePath]
+
+		if paths := removedPaths[newData.Sha256Sum]; len(paths) > 0 {
+			changes = append(changes, fileChange{status: fileRenamed, oldPath: paths[0], newPath: filePath, oldData: oldFiles[paths[0]], newData: newData})
+
+			removedPaths[newData.Sha256Sum] = paths[1:]
+			continue
+		}
+
+		changes = append(changes, fileChange{status: fileAdded, newPath: filePath, newData: newData})
+	}
+
+	for _, paths := range removedPaths {
+		for _, filePath := range paths {
+			changes = append(changes, fileChange{status: fileRemoved, oldPath: filePath, oldData: oldFiles[filePath]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].getPath() < changes[j].getPath()
+	})
+
+	return changes
+}
+
+func formatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatSize(-delta)
+	}
+
+	return "+" + formatSize(delta)
+}
+
+func printFileChange(change fileChange) {
+	switch change.status {
+	case fileAdded:
+		printGreen(fmt.Sprintf("%s  %s  %s", change.status, change.newPath, formatSizeDelta(change.getSizeDelta())))
+	case fileRemoved:
+		printRed(fmt.Sprintf("%s  %s  %s", change.status, change.oldPath, formatSizeDelta(change.getSizeDelta())))
+	case fileModified:
+		fmt.Printf("%s  %s  %s -> %s (%s)\n", change.status, change.newPath, formatSize(change.oldData.Size), formatSize(change.newData.Size), formatSizeDelta(change.getSizeDelta()))
+	case fileRenamed:
+		fmt.Printf("%s  %s -> %s  %s\n", change.status, change.oldPath, change.newPath, formatSize(change.newData.Size))
+	}
+
+	if change.status == fileModified {
+		fmt.Printf("     Sha256Sum: %s -> %s\n", change.oldData.Sha256Sum, change.newData.Sha256Sum)
+		fmt.Printf("     LastModified: %s -> %s\n", change.oldData.LastModified.Format("2006-01-02 15:04:05 -0700"), change.newData.LastModified.Format("2006-01-02 15:04:05 -0700"))
+	} else if change.status == fileAdded {
+		fmt.Printf("     Sha256Sum: %s\n", change.newData.Sha256Sum)
+	} else {
+		fmt.Printf("     Sha256Sum: %s\n", change.oldData.Sha256Sum)
+	}
+}
+
+func printFileChanges(changes []fileChange, verbose bool) {
+	counts := make(map[string]int)
+
+	var sizeDelta int64
+
+	for _, change := range changes {
+		if verbose {
+			printFileChange(change)
+		}
+
+		counts[change.status]++
+		sizeDelta += change.getSizeDelta()
+	}
+
+	if verbose && len(changes) > 0 {
+		fmt.Println()
+	}
+
+	fmt.Printf("Files added: ")
+	printGreen(strconv.Itoa(counts[fileAdded]))
+
+	fmt.Printf("Files removed: ")
+	printRed(strconv.Itoa(counts[fileRemoved]))
+
+	fmt.Printf("Files modified: ")
+	printGreen(strconv.Itoa(counts[fileModified]))
+
+	fmt.Printf("Files renamed: ")
+	printGreen(strconv.Itoa(counts[fileRenamed]))
+
+	fmt.Printf("Size difference: %s\n", formatSizeDelta(sizeDelta))
+}
+
+// diffRevisions compares the GLFLite files of two git revisions, the working
+// tree is used when a revision is empty.
+func (app *application) diffRevisions(oldRevision string, newRevision string) error {
+	getFiles := func(revision string) (map[string]fileData, error) {
+		if revision == "" {
+			return app.getWorkingTreeFiles()
+		}
+
+		return app.getRevisionFiles(revision)
+	}
+
+	oldFiles, err := getFiles(oldRevision)
+
+	if err != nil {
+		return err
+	}
+
+	newFiles, err := getFiles(newRevision)
+
+	if err != nil {
+		return err
+	}
+
+	printFileChanges(compareFileSets(oldFiles, newFiles), app.verbose)
+
+	return nil
+}
+
+// readDiffFile reads a GLFLite file given by git to an external diff tool,
+// /dev/null and empty files are the side where the file doesn't exist.
+func readDiffFile(diffFile string, filePath string) (map[string]fileData, error) {
+	content, err := os.ReadFile(diffFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]fileData)
+
+	if len(strings.TrimSpace(string(content))) == 0 {
+		return files, nil
+	}
+
+	var data fileData
+
+	err = json.Unmarshal(content, &data)
+
+	if err != nil || data.Sha256Sum == "" {
+		return nil, errors.New(fmt.Sprintf("%s is not a GLFLite file", filePath))
+	}
+
+	files[filePath] = data
+
+	return files, nil
+}
+
+// printDifftool prints the change of a GLFLite file instead of its JSON. It
+// accepts the arguments of git difftool -x, "<local> <remote>" with the path
+// in the BASE environment variable, and the arguments of GIT_EXTERNAL_DIFF,
+// "<path> <old-file> <old-hex> <old-mode> <new-file> <new-hex> <new-mode>"
+// followed by "<new-path> <rename-info>" for the renamed files.
+func printDifftool(args []string) error {
+	var oldPath, newPath, oldFile, newFile string
+
+	switch len(args) {
+	case 2:
+		oldPath, oldFile, newFile = os.Getenv("BASE"), args[0], args[1]
+
+		// the temporary files of git keep the name of the file
+		if oldPath == "" && newFile != os.DevNull {
+			oldPath = filepath.Base(newFile)
+		} else if oldPath == "" {
+			oldPath = filepath.Base(oldFile)
+		}
+	case 7:
+		oldPath, oldFile, newFile = args[0], args[1], args[4]
+	case 9:
+		oldPath, oldFile, newFile, newPath = args[0], args[1], args[4], args[7]
+	default:
+		return errors.New("The difftool mode expects the 2 arguments of git difftool -x or the arguments of GIT_EXTERNAL_DIFF")
+	}
+
+	if newPath == "" {
+		newPath = oldPath
+	}
+
+	if !isGLFLiteFile(newPath) || filepath.Base(newPath) == setupFile {
+		fmt.Printf("%s is not a GLFLite file\n", newPath)
+		return nil
+	}
+
+	oldFiles, err := readDiffFile(oldFile, getTrackedFilePath(oldPath))
+
+	if err != nil {
+		return err
+	}
+
+	newFiles, err := readDiffFile(newFile, getTrackedFilePath(newPath))
+
+	if err != nil {
+		return err
+	}
+
+	changes := compareFileSets(oldFiles, newFiles)
+
+	if len(changes) == 0 {
+		fmt.Printf("%s: the Sha256 sum didn't change\n", getTrackedFilePath(newPath))
+		return nil
+	}
+
+	for _, change := range changes {
+		printFileChange(change)
+	}
+
+	return nil
+}
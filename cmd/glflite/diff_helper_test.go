@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompareFileSets(t *testing.T) {
+	data := func(content string) fileData {
+		return fileData{Size: int64(len(content)), Sha256Sum: getTestShasum(content)}
+	}
+
+	oldFiles := map[string]fileData{
+		"intro.mp4":        data("intro video"),
+		"outro.mp4":        data("outro video"),
+		"cover.raw":        data("cover photo"),
+		"copies/intro.mp4": data("intro video"),
+	}
+
+	newFiles := map[string]fileData{
+		"intro.mp4":          data("intro video, second version"),
+		"videos/outro.mp4":   data("outro video"),
+		"videos/credits.mp4": data("credits"),
+		"copies/intro.mp4":   data("intro video"),
+	}
+
+	changes := compareFileSets(oldFiles, newFiles)
+
+	expected := []string{
+		"D cover.raw -11",
+		"M intro.mp4 intro.mp4 16",
+		"A  videos/credits.mp4 7",
+		"R outro.mp4 videos/outro.mp4 0",
+	}
+
+	var found []string
+
+	for _, change := range changes {
+		found = append(found, strings.TrimSpace(change.status+" "+change.oldPath+" "+change.newPath)+" "+strconv.FormatInt(change.getSizeDelta(), 10))
+	}
+
+	if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("the changes are:\n%s\nexpected:\n%s", strings.Join(found, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	commitTestVersion(t, app, "intro.mp4", "intro video", false)
+	commitTestVersion(t, app, "outro.mp4", "outro video", false)
+	commitTestVersion(t, app, "cover.raw", "cover photo", false)
+	runTestGit(t, app, "add", "--", "intro.mp4.glflite", "outro.mp4.glflite", "cover.raw.glflite")
+	runTestGit(t, app, "commit", "--quiet", "-m", "first commit")
+
+	commitTestVersion(t, app, "intro.mp4", "intro video, second version", false)
+	runTestGit(t, app, "mv", "outro.mp4.glflite", "credits.mp4.glflite")
+	runTestGit(t, app, "rm", "--quiet", "cover.raw.glflite")
+	runTestGit(t, app, "commit", "--quiet", "--all", "-m", "second commit")
+
+	// the working tree has a new file that isn't committed
+	commitTestVersion(t, app, "trailer.mp4", "trailer", false)
+
+	app.sortedTrackedFiles = []string{"credits.mp4", "intro.mp4", "trailer.mp4"}
+
+	files, err := app.getRevisionFiles("HEAD~1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 3 || files["cover.raw"].Sha256Sum != getTestShasum("cover photo") {
+		t.Errorf("the files of the first commit are %v", files)
+	}
+
+	var output string
+
+	for _, test := range []struct {
+		oldRevision string
+		newRevision string
+		summary     string
+	}{
+		{"HEAD~1", "HEAD", "Files added: 0\nFiles removed: 1\nFiles modified: 1\nFiles renamed: 1\n"},
+		{"HEAD", "", "Files added: 1\nFiles removed: 0\nFiles modified: 0\nFiles renamed: 0\n"},
+		{"HEAD", "HEAD~1", "Files added: 1\nFiles removed: 0\nFiles modified: 1\nFiles renamed: 1\n"},
+	} {
+		output = captureOutput(t, func() {
+			err = app.diffRevisions(test.oldRevision, test.newRevision)
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(output, test.summary) {
+			t.Errorf("the diff of %s and %q printed:\n%s", test.oldRevision, test.newRevision, output)
+		}
+	}
+
+	err = app.diffRevisions("no-such-revision", "HEAD")
+
+	if err == nil {
+		t.Error("an unknown revision was accepted")
+	}
+}
+
+func TestPrintDifftool(t *testing.T) {
+	folder := t.TempDir()
+
+	oldFile := folder + "/old.glflite"
+	newFile := folder + "/new.glflite"
+
+	err := os.WriteFile(oldFile, []byte(`{"size": 11, "sha256sum": "`+getTestShasum("intro video")+`"}`), 0644)
+
+	if err == nil {
+		err = os.WriteFile(newFile, []byte(`{"size": 27, "sha256sum": "`+getTestShasum("intro video, second version")+`"}`), 0644)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"videos/intro.mp4.glflite", oldFile, "abc", "100644", newFile, "def", "100644"},
+		{oldFile, newFile},
+	} {
+		t.Setenv("BASE", "videos/intro.mp4.glflite")
+
+		output := captureOutput(t, func() {
+			err = printDifftool(args)
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(output, "M  videos/intro.mp4  11 B -> 27 B (+16 B)\n") {
+			t.Errorf("the difftool with %d arguments printed:\n%s", len(args), output)
+		}
+	}
+
+	// the file was added
+	output := captureOutput(t, func() {
+		err = printDifftool([]string{"videos/intro.mp4.glflite", os.DevNull, "0", "0", newFile, "def", "100644"})
+	})
+
+	if err != nil || !strings.Contains(output, "A  videos/intro.mp4  +27 B\n") {
+		t.Errorf("the difftool of an added file printed %v:\n%s", err, output)
+	}
+
+	// the other files aren't GLFLite files
+	output = captureOutput(t, func() {
+		err = printDifftool([]string{"README.md", oldFile, "abc", "100644", newFile, "def", "100644"})
+	})
+
+	if err != nil || !strings.Contains(output, "README.md is not a GLFLite file") {
+		t.Errorf("the difftool of another file printed %v:\n%s", err, output)
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 type fileToSort struct {
@@ -26,30 +31,69 @@ func sortFiles(files []fileToSort) []fileToSort {
 	return files
 }
 
-func findGitFolder() (string, error) {
-	var err error
+// gitRepository holds the folders of the repository of the current folder.
+type gitRepository struct {
+	rootFolder      string
+	gitDirectory    string
+	commonDirectory string
+	currentFolder   string
+}
 
-	currentFolder := getCurrentFolder()
+// findRepository asks git for the repository of a folder, so it is
+// found like git does: in the parent folders, with the .git files of the
+// worktrees and the submodules, and with the GIT_DIR and GIT_WORK_TREE
+// environment variables. The worktrees have their own git directory and
+// share the common directory of the repository.
+func findRepository(folder string) (gitRepository, error) {
+	var repository gitRepository
 
-	folder := currentFolder
+	cmd := exec.Command("git", "rev-parse", "--absolute-git-dir", "--git-common-dir", "--is-bare-repository")
+	cmd.Dir = folder
 
-	for {
-		if hasGitFolder(folder) {
-			return folder, nil
-		}
+	output, err := cmd.Output()
 
-		folder, err = getAbsolutePath(folder + "/..")
+	if err != nil {
+		return repository, errors.New(fmt.Sprintf("Git folder not found in %s or any of its parent folders", folder))
+	}
 
-		if err != nil {
-			return "", err
-		}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 
-		if folder == "/" {
-			break
-		}
+	if len(lines) != 3 {
+		return repository, errors.New(fmt.Sprintf("Unexpected output of git rev-parse: %s", string(output)))
 	}
 
-	return "", errors.New(fmt.Sprintf("Git folder not found in %s or any of its parent folders", currentFolder))
+	if lines[2] == "true" {
+		return repository, errors.New(fmt.Sprintf("The repository %s is bare, glflite needs a work tree. Set GIT_WORK_TREE or core.worktree, or create a worktree with git worktree add", lines[0]))
+	}
+
+	repository.gitDirectory = lines[0]
+
+	// the common directory is relative to the folder
+	repository.commonDirectory = lines[1]
+
+	if !filepath.IsAbs(repository.commonDirectory) {
+		repository.commonDirectory = filepath.Join(folder, repository.commonDirectory)
+	}
+
+	cmd = exec.Command("git", "rev-parse", "--show-toplevel", "--show-prefix")
+	cmd.Dir = folder
+
+	output, err = cmd.Output()
+
+	if err != nil {
+		return repository, errors.New(fmt.Sprintf("The folder %s is inside the git directory, run glflite in the work tree of the repository", folder))
+	}
+
+	lines = strings.Split(string(output), "\n")
+
+	if len(lines) < 2 {
+		return repository, errors.New(fmt.Sprintf("Unexpected output of git rev-parse: %s", string(output)))
+	}
+
+	repository.rootFolder = lines[0]
+	repository.currentFolder = strings.TrimSuffix(lines[1], "/")
+
+	return repository, nil
 }
 
 func getAbsolutePath(path string) (string, error) {
@@ -61,13 +105,37 @@ func getAbsolutePath(path string) (string, error) {
 	return absPath, nil
 }
 
-func hasGitFolder(folder string) bool {
-	gitFolder := folder + "/.git"
-	if fileExists(gitFolder) && isDirectory(gitFolder) {
-		return true
+// stdinReader is shared by all the questions, so the answers piped to glflite
+// aren't lost in the buffer of a previous question.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// askConfirmation asks a yes/no question to the user.
+func askConfirmation(question string) bool {
+	return askConfirmationFrom(stdinReader, question)
+}
+
+// askConfirmationFrom asks a question answered from another input, like the
+// terminal of a git hook.
+func askConfirmationFrom(reader *bufio.Reader, question string) bool {
+	fmt.Print(question + " (yes/no): ")
+	response, _ := reader.ReadString('\n')
+
+	response = strings.TrimSpace(strings.ToLower(response))
+
+	return response == "yes" || response == "y"
+}
+
+func isTerminalFile(file *os.File) bool {
+	info, err := file.Stat()
+
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
 	}
 
-	return false
+	// /dev/null is a character device too
+	devNull, err := os.Stat(os.DevNull)
+
+	return err != nil || !os.SameFile(info, devNull)
 }
 
 func hasGitIgnoreFile(folder string) bool {
@@ -96,6 +164,26 @@ func createGitIgnoreFile(folder string) error {
 	return nil
 }
 
+// getGitIgnoreSection returns the lines of a .gitignore file with the index
+// of the GitLFSLite separator, -1 when it is missing, and the index where the
+// section ends, the end marker or the end of the file. The end marker lets
+// the section sit in the middle of the file.
+func getGitIgnoreSection(content string) ([]string, int, int) {
+	lines := strings.Split(content, "\n")
+
+	start := -1
+
+	for i, line := range lines {
+		if start == -1 && strings.Contains(line, gitIgnoreSeparator) {
+			start = i
+		} else if start != -1 && strings.TrimSpace(line) == gitIgnoreEndMarker {
+			return lines, start, i
+		}
+	}
+
+	return lines, start, len(lines)
+}
+
 func getGitIgnoreContent(folder string) (fileRules []string, err error) {
 	gitIgnoreFile := folder + "/.gitignore"
 
@@ -109,26 +197,195 @@ func getGitIgnoreContent(folder string) (fileRules []string, err error) {
 
 	content, err := ioutil.ReadFile(gitIgnoreFile)
 
-	foundGitLFSLite := false
+	if err != nil {
+		return fileRules, err
+	}
+
+	lines, start, end := getGitIgnoreSection(string(content))
+
+	if start == -1 {
+		return fileRules, nil
+	}
+
+	for _, line := range lines[start+1 : end] {
+		if line != "" && !strings.Contains(line, gitIgnoreSeparator) {
+			fileRules = append(fileRules, line)
+		}
+	}
 
-	for _, line := range strings.Split(string(content), "\n") {
-		if strings.Contains(line, gitIgnoreSeparator) {
-			foundGitLFSLite = true
+	return fileRules, nil
+}
+
+// addGitIgnoreRule adds a rule at the end of the GitLFSLite section of the
+// .gitignore file, the section is added when it is missing.
+func addGitIgnoreRule(folder string, rule string) error {
+	gitIgnoreFile := folder + "/.gitignore"
+
+	content, err := ioutil.ReadFile(gitIgnoreFile)
+
+	if err != nil {
+		return err
+	}
+
+	lines, start, end := getGitIgnoreSection(string(content))
+
+	if start == -1 {
+		text := strings.TrimRight(string(content), "\n")
+
+		if text != "" {
+			text += "\n\n"
+		}
+
+		return writeFileAtomic(gitIgnoreFile, []byte(text+gitIgnoreSeparator+"\n"+rule+"\n"), 0644)
+	}
+
+	// the rule goes after the last rule, before the empty lines
+	position := end
+
+	for position > start+1 && strings.TrimSpace(lines[position-1]) == "" {
+		position--
+	}
+
+	lines = append(lines[:position], append([]string{rule}, lines[position:]...)...)
+
+	return writeFileAtomic(gitIgnoreFile, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// escapeGitIgnoreRule returns the rule that matches only the given path. The
+// rule starts with / so that git doesn't match the files with the same name
+// in the other folders, and the glob characters and the trailing spaces are
+// escaped with a backslash like git expects.
+func escapeGitIgnoreRule(filePath string) string {
+	var rule strings.Builder
+
+	rule.WriteRune('/')
+
+	for _, char := range filePath {
+		if strings.ContainsRune("*?[\\", char) {
+			rule.WriteRune('\\')
+		}
+
+		rule.WriteRune(char)
+	}
+
+	escaped := rule.String()
+	trimmed := strings.TrimRight(escaped, " ")
+
+	return trimmed + strings.Repeat("\\ ", len(escaped)-len(trimmed))
+}
+
+// unescapeGitIgnoreRule removes the backslashes of the escaped characters.
+func unescapeGitIgnoreRule(rule string) string {
+	if !strings.Contains(rule, "\\") {
+		return rule
+	}
+
+	var unescaped strings.Builder
+
+	escaped := false
+
+	for _, char := range rule {
+		if char == '\\' && !escaped {
+			escaped = true
 			continue
 		}
 
-		if foundGitLFSLite {
-			if line != "" {
-				fileRules = append(fileRules, line)
-			}
+		escaped = false
+
+		unescaped.WriteRune(char)
+	}
+
+	return unescaped.String()
+}
+
+// trimGitIgnoreRule removes the spaces around a rule, except the trailing
+// spaces escaped with a backslash.
+func trimGitIgnoreRule(rule string) string {
+	rule = strings.TrimLeft(rule, " \t")
+	trimmed := strings.TrimRight(rule, " \t\r")
+
+	backslashes := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+
+	if backslashes%2 == 1 && len(trimmed) < len(rule) {
+		trimmed += rule[len(trimmed) : len(trimmed)+1]
+	}
+
+	return trimmed
+}
+
+// removeGitIgnoreRule removes a rule of the GitLFSLite section of the
+// .gitignore file and tells if it was found.
+func removeGitIgnoreRule(folder string, rule string) (bool, error) {
+	gitIgnoreFile := folder + "/.gitignore"
+
+	content, err := ioutil.ReadFile(gitIgnoreFile)
+
+	if err != nil {
+		return false, err
+	}
+
+	lines, start, end := getGitIgnoreSection(string(content))
+
+	if start == -1 {
+		return false, nil
+	}
+
+	var newLines []string
+
+	removed := false
+
+	for i, line := range lines {
+		if i > start && i < end && strings.TrimSpace(line) == rule {
+			removed = true
+			continue
 		}
+
+		newLines = append(newLines, line)
+	}
+
+	if !removed {
+		return false, nil
 	}
 
+	return true, writeFileAtomic(gitIgnoreFile, []byte(strings.Join(newLines, "\n")), 0644)
+}
+
+// writeFileAtomic writes a file to a temporary file in the same folder and
+// renames it, so that the other processes never read a partial file.
+func writeFileAtomic(filePath string, content []byte, perm os.FileMode) error {
+	return writeReaderAtomic(filePath, bytes.NewReader(content), perm)
+}
+
+// writeReaderAtomic is writeFileAtomic for the content that is too large to
+// read in memory, like the objects received by the serve action.
+func writeReaderAtomic(filePath string, content io.Reader, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+
 	if err != nil {
-		return fileRules, err
+		return err
 	}
 
-	return fileRules, nil
+	_, err = io.Copy(file, content)
+
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), filePath)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+	}
+
+	return err
 }
 
 func fileExists(filename string) bool {
@@ -171,58 +428,84 @@ func getCurrentFolder() string {
 	return dir
 }
 
-func findAllFilesAndFolders(folder string) (files []fileInformation, err error) {
+// findTrackedFiles finds the tracked files of the scope, the files that
+// match the rules of the #GitLFSLite section and the GLFLite files of the
+// missing files. The files found are kept in app.files, all the files of the
+// scope when allFiles is set.
+func (app *application) findTrackedFiles(allFiles bool) error {
+	exclusions, err := app.getWalkExclusions()
 
-	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return err
+	}
 
-		relativePath := strings.TrimPrefix(path, folder)
+	walker, err := startFileWalk(app.config.rootFolder, app.scope, exclusions, app.config.fileRules, allFiles)
 
-		//exclude setup file
+	if err != nil {
+		return err
+	}
 
-		if relativePath == "/"+setupFile {
-			return nil
-		}
+	var glfliteFiles []string
 
-		// exclude the root folder
-		if relativePath == "" {
-			return nil
-		}
+	// check and update need the sorted full list, for the ordered output and the journal
+	for file := range walker.files {
+		app.files = append(app.files, file)
 
-		// exclude the .git folder
-		if relativePath == "/.git" {
-			return nil
+		// Check if the file is excluded by the .gitignore file after the #GitLFSLite separator
+		if isFileExcluded(app.config.fileRules, file.path, file.isDirectory) {
+			app.trackedFiles[file.path] = trackedFile{
+				file:       file,
+				isPresent:  true,
+				isUpToDate: false,
+			}
 		}
 
-		// exclude .git folder and its content
-		if strings.HasPrefix(relativePath, "/.git/") {
-			return nil
+		if isGLFLiteFile(file.path) {
+			glfliteFiles = append(glfliteFiles, file.path)
 		}
+	}
 
-		// exclude .gitignore file
-		if strings.HasPrefix(relativePath, "/.gitignore") {
-			return nil
-		}
+	if walker.err != nil {
+		return walker.err
+	}
+
+	sort.Slice(app.files, func(i, j int) bool {
+		return app.files[i].path < app.files[j].path
+	})
 
-		filePath := strings.TrimPrefix(relativePath, "/")
+	// the GLFLite files of the missing files
+	for _, glfliteFile := range glfliteFiles {
+		trackedFileName := getTrackedFilePath(glfliteFile)
 
-		files = append(files, fileInformation{
-			path:         filePath,
-			isDirectory:  info.IsDir(),
-			lastModified: info.ModTime(),
-			size:         info.Size(),
-		})
+		if _, ok := app.trackedFiles[trackedFileName]; !ok {
+			trackedFileData, err := app.readJSONFile(trackedFileName)
 
-		return nil
-	})
+			if err != nil {
+				return err
+			}
 
-	if err != nil {
-		return files, err
+			app.trackedFiles[trackedFileName] = trackedFile{
+				file: fileInformation{
+					path:         trackedFileName,
+					isDirectory:  false,
+					lastModified: trackedFileData.LastModified,
+					size:         trackedFileData.Size,
+				},
+				isPresent:  false,
+				isUpToDate: false,
+			}
+		}
+	}
+
+	app.sortedTrackedFiles = make([]string, 0, len(app.trackedFiles))
+
+	for file := range app.trackedFiles {
+		app.sortedTrackedFiles = append(app.sortedTrackedFiles, file)
 	}
 
-	return files, nil
+	sort.Strings(app.sortedTrackedFiles)
+
+	return nil
 }
 
 func isGLFLiteFile(file string) bool {
@@ -248,7 +531,7 @@ func isFileExcluded(gitIgnoreFiles []string, path string, isDir bool) bool {
 	// Iterate through the lines of the .gitignore
 	for _, line := range gitIgnoreFiles {
 		// Trim whitespace and ignore empty lines and comments
-		line = strings.TrimSpace(line)
+		line = trimGitIgnoreRule(line)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
@@ -270,17 +553,21 @@ func isFileExcluded(gitIgnoreFiles []string, path string, isDir bool) bool {
 			line = strings.TrimSuffix(line, "/")
 		}
 
+		// a leading "/" anchors the rule to the root folder
+		isAnchored := strings.HasPrefix(line, "/")
+		line = strings.TrimPrefix(line, "/")
+
 		// Match pattern using filepath.Match (but handling special cases)
 		matched := false
 		if strings.HasPrefix(line, "*") {
 			excludedFileSuffix := strings.ToLower(strings.TrimPrefix(line, "*"))
 
-			if strings.HasSuffix(strings.ToLower(path), excludedFileSuffix) {
+			if strings.HasSuffix(strings.ToLower(path), excludedFileSuffix) && !(isAnchored && strings.Contains(path, "/")) {
 				matched = true
 			}
 		} else {
-			// Use normal matching for other patterns
-			if path == line {
+			// Use normal matching for other patterns, the escaped characters are literal
+			if path == unescapeGitIgnoreRule(line) {
 				matched = true
 			}
 		}
@@ -303,20 +590,95 @@ func isFileExcluded(gitIgnoreFiles []string, path string, isDir bool) bool {
 	return isExcluded
 }
 
-func (app *application) getFileShasum(fileName string) (string, error) {
-	bufferSize := 32 * 1024 // 32KB buffer
+// canMatchInFolder tells if the rules of the #GitLFSLite section can match a
+// file inside a folder listed by git as ignored. The rules without a slash
+// match the names at any depth: they match a folder ignored by git by its
+// name, and the files of a folder that git only lists because all its files
+// are ignored. The other rules match the paths inside the folder.
+func canMatchInFolder(gitIgnoreFiles []string, folder string, isIgnored bool) bool {
+	for _, line := range gitIgnoreFiles {
+		line = trimGitIgnoreRule(line)
+
+		// the negated rules only include files again
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		line = strings.TrimSuffix(filepath.ToSlash(line), "/")
 
+		if !strings.Contains(line, "/") {
+			if !isIgnored {
+				return true
+			}
+
+			if matched, _ := path.Match(line, path.Base(folder)); matched {
+				return true
+			}
+
+			continue
+		}
+
+		rulePath := unescapeGitIgnoreRule(strings.TrimPrefix(line, "/"))
+
+		if rulePath == folder || strings.HasPrefix(rulePath, folder+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (app *application) getFileShasum(fileName string) (string, error) {
 	filePath := fileName
 	if !fileExists(filePath) {
 		return "", errors.New(fmt.Sprintf("file %s does not exist", fileName))
 	}
 
+	// the local index keeps the date when the hash started, to detect the racy files
+	hashed := time.Now()
+
+	var shaSum string
+	var err error
+
+	if app.progress == nil {
+		shaSum, err = getShasum(app.getFullPath(filePath))
+	} else {
+		shaSum, err = app.getShasumWithProgress(filePath)
+	}
+
+	if err == nil {
+		app.index.record(filePath, app.trackedFiles[filePath].file, shaSum, hashed)
+	}
+
+	return shaSum, err
+}
+
+func (app *application) getShasumWithProgress(filePath string) (string, error) {
+	app.progress.startFile(filePath)
+	defer app.progress.finishFile()
+
 	file, err := os.Open(app.getFullPath(filePath))
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
+	return readShasum(&progressReader{reader: file, progress: app.progress})
+}
+
+func getShasum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return readShasum(file)
+}
+
+func readShasum(file io.Reader) (string, error) {
+	bufferSize := 32 * 1024 // 32KB buffer
+
 	hash := sha256.New()
 	buf := make([]byte, bufferSize)
 
@@ -348,35 +710,53 @@ func (app *application) generateRsyncFileList(local bool) error {
 		fileName += "_local"
 	}
 
-	file, err := os.Create(app.getFullPath(fileName))
+	lines, err := app.getListLinesOutsideScope(fileName)
 
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
-
 	for _, fileFullPath := range app.sortedTrackedFiles {
 		trackedFile := app.trackedFiles[fileFullPath]
 
 		if !local || (trackedFile.isPresent && local) {
+			lines = append(lines, fmt.Sprintf("./%s", fileFullPath))
+		}
+	}
 
-			_, err = file.WriteString(fmt.Sprintf("./%s\n", fileFullPath))
+	sort.Strings(lines)
 
-			if err != nil {
-				return err
-			}
-		}
+	var content strings.Builder
+
+	for _, line := range lines {
+		content.WriteString(line + "\n")
 	}
 
-	return nil
+	return writeFileAtomic(app.getFullPath(fileName), []byte(content.String()), 0644)
 }
 
 func (app *application) generateSha256FileList() error {
-	var lines []string
+	lines, err := app.getListLinesOutsideScope("sha256_list_" + fileExtension)
+
+	if err != nil {
+		return err
+	}
 
 	sortedByShasum := []fileToSort{}
 
+	// the files outside of the scope are checked for duplicates too
+	for _, line := range lines {
+		shaSum, filePath, _ := strings.Cut(line, "  ./")
+
+		var size int64
+
+		if info, err := os.Stat(app.getFullPath(filePath)); err == nil {
+			size = info.Size()
+		}
+
+		sortedByShasum = append(sortedByShasum, fileToSort{Shasum: shaSum, Path: filePath, Size: size})
+	}
+
 	for _, fileFullPath := range app.sortedTrackedFiles {
 		trackedFile := app.trackedFiles[fileFullPath]
 
@@ -397,10 +777,10 @@ func (app *application) generateSha256FileList() error {
 			if _, ok := app.duplicatedFiles[sortedFile.Shasum]; !ok {
 				app.duplicatedFiles[sortedFile.Shasum] = []string{lastFilePath}
 
-				fmt.Printf("Original file: %s\n", lastFilePath)
+				fmt.Printf("Original file: %s\n", app.getDisplayPath(lastFilePath))
 			}
 
-			fmt.Printf("Duplicated file: %s\n", sortedFile.Path)
+			fmt.Printf("Duplicated file: %s\n", app.getDisplayPath(sortedFile.Path))
 
 			app.duplicatedFiles[sortedFile.Shasum] = append(app.duplicatedFiles[sortedFile.Shasum], sortedFile.Path)
 
@@ -411,7 +791,7 @@ func (app *application) generateSha256FileList() error {
 		lastFilePath = sortedFile.Path
 	}
 
-	err := ioutil.WriteFile(app.getFullPath("sha256_list_"+fileExtension), []byte(strings.Join(lines, "\n")), 0644)
+	err = writeFileAtomic(app.getFullPath("sha256_list_"+fileExtension), []byte(strings.Join(lines, "\n")), 0644)
 
 	if err != nil {
 		return err
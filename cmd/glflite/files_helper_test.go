@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindRepository(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, map[string]string{"videos/notes.txt": "notes"})
+
+	rootFolder, err := filepath.EvalSymlinks(app.config.rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the worktree has its own git directory and shares the common directory
+	worktreeFolder := filepath.Dir(rootFolder) + "/feature"
+
+	runTestGit(t, app, "worktree", "add", "--quiet", worktreeFolder)
+
+	for _, test := range []struct {
+		folder        string
+		rootFolder    string
+		gitDirectory  string
+		currentFolder string
+	}{
+		{rootFolder, rootFolder, rootFolder + "/.git", ""},
+		{rootFolder + "/videos", rootFolder, rootFolder + "/.git", "videos"},
+		{worktreeFolder + "/videos", worktreeFolder, rootFolder + "/.git/worktrees/feature", "videos"},
+	} {
+		repository, err := findRepository(test.folder)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if repository.rootFolder != test.rootFolder || repository.gitDirectory != test.gitDirectory || repository.commonDirectory != rootFolder+"/.git" || repository.currentFolder != test.currentFolder {
+			t.Errorf("the repository of %s is %+v", test.folder, repository)
+		}
+	}
+
+	// the git directory isn't a work tree
+	_, err = findRepository(rootFolder + "/.git")
+
+	if err == nil || !strings.Contains(err.Error(), "is inside the git directory") {
+		t.Errorf("the git directory was accepted: %v", err)
+	}
+
+	runTestGit(t, app, "clone", "--quiet", "--bare", rootFolder, rootFolder+"/../bare.git")
+
+	_, err = findRepository(rootFolder + "/../bare.git")
+
+	if err == nil || !strings.Contains(err.Error(), "is bare") {
+		t.Errorf("the bare repository was accepted: %v", err)
+	}
+
+	_, err = findRepository(t.TempDir())
+
+	if err == nil {
+		t.Error("a folder outside of a repository was accepted")
+	}
+}
+
+func TestWalkSkipsGitDirectories(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	// the git directory of GIT_DIR can have another name
+	for _, filePath := range []string{"repository.git/HEAD", "repository.git/objects/info", "repository.git/refs/heads"} {
+		writeTestFile(t, app, filePath, "")
+	}
+
+	files := walkTestFiles(t, app, nil, walkExclusions{}, true)
+
+	for _, file := range files {
+		if strings.HasPrefix(file.path, "repository.git") {
+			t.Errorf("the file %s of the git directory was found", file.path)
+		}
+	}
+
+	if len(files) != 3 {
+		t.Errorf("the files found are %v", files)
+	}
+}
+
+func TestEscapeGitIgnoreRule(t *testing.T) {
+	paths := []string{
+		"#notes.mp4",
+		"!important.mov",
+		"videos/take*1.mp4",
+		"videos/what?.wav",
+		"photos/[draft] cover.raw",
+		"scans/back\\slash.tiff",
+		"trailing space.mp4 ",
+		"two trailing spaces.mp4  ",
+	}
+
+	// the other files that the paths would match as patterns
+	others := []string{
+		"notes.mp4",
+		"important.mov",
+		"videos/take 21.mp4",
+		"videos/whatX.wav",
+		"photos/d cover.raw",
+		"trailing space.mp4",
+	}
+
+	folder := t.TempDir()
+
+	output, err := exec.Command("git", "init", "--quiet", folder).CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("%s: %s", err.Error(), output)
+	}
+
+	var rules []string
+	content := gitIgnoreSeparator + "\n"
+
+	for _, filePath := range paths {
+		rule := escapeGitIgnoreRule(filePath)
+
+		rules = append(rules, rule)
+		content += rule + "\n"
+	}
+
+	err = os.WriteFile(folder+"/.gitignore", []byte(content), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileRules, err := getGitIgnoreContent(folder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filePath := range paths {
+		if !isFileExcluded(fileRules, filePath, false) {
+			t.Errorf("the rules don't track %q", filePath)
+		}
+
+		// git check-ignore exits with 1 when the file isn't ignored
+		err = exec.Command("git", "-C", folder, "check-ignore", "--quiet", "--no-index", "--", filePath).Run()
+
+		if err != nil {
+			t.Errorf("git doesn't ignore %q with the rules %q", filePath, rules)
+		}
+	}
+
+	for _, filePath := range others {
+		if isFileExcluded(fileRules, filePath, false) {
+			t.Errorf("the rules track %q", filePath)
+		}
+
+		err = exec.Command("git", "-C", folder, "check-ignore", "--quiet", "--no-index", "--", filePath).Run()
+
+		if err == nil {
+			t.Errorf("git ignores %q with the rules %q", filePath, rules)
+		}
+	}
+}
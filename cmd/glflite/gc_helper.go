@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getReferencedShasums returns the Sha256 sums of the files referenced by
+// the GLFLite files committed in git, in the index and in the working tree.
+// By default all the refs are walked, commits and since limit the walk to the
+// last commits or to the commits after a date.
+func (app *application) getReferencedShasums(commits int, since string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	revListArgs := []string{"--all"}
+
+	if commits > 0 {
+		revListArgs = append(revListArgs, "--max-count="+strconv.Itoa(commits))
+	}
+
+	if since != "" {
+		revListArgs = append(revListArgs, "--since="+since)
+	}
+
+	blobs, err := app.findHistoryGLFLiteFiles(revListArgs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := app.runGit("ls-files", "--stage")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the lines of ls-files are "<mode> <hash> <stage>\t<path>"
+	for _, line := range strings.Split(string(output), "\n") {
+		info, filePath, found := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+
+		if found && len(fields) == 3 && filePath != setupFile && isGLFLiteFile(filePath) {
+			blobs = append(blobs, gitBlob{hash: fields[1], path: filePath})
+		}
+	}
+
+	files, err := app.readGitBlobs(blobs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, data := range files {
+		if data.Sha256Sum != "" {
+			referenced[data.Sha256Sum] = true
+		}
+	}
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		data, err := app.readJSONFile(fileFullPath)
+
+		if errors.Is(err, ErrGLFLiteFileNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		referenced[data.Sha256Sum] = true
+	}
+
+	return referenced, nil
+}
+
+// collectGarbage deletes the objects of a remote that aren't referenced by
+// any GLFLite file. The objects modified during the grace period are kept,
+// they may belong to commits that aren't in this clone yet.
+func (app *application) collectGarbage(conn *remoteConnection, referenced map[string]bool, graceDays int, dryRun bool) error {
+	objects, err := conn.listObjects()
+
+	if err != nil {
+		return err
+	}
+
+	referencedKeys := make(map[string]bool)
+
+	for shaSum := range referenced {
+		key := conn.getObjectKey(shaSum)
+
+		referencedKeys[key] = true
+		referencedKeys[key+compressedObjectSuffix] = true
+	}
+
+	graceLimit := time.Now().AddDate(0, 0, -graceDays)
+
+	var unreferenced []remoteObject
+	var unreferencedSize int64
+
+	objectsKept := 0
+
+	for _, object := range objects {
+		// the partial uploads of referenced objects are kept to resume them
+		if referencedKeys[strings.TrimSuffix(object.key, partialObjectSuffix)] {
+			continue
+		}
+
+		if object.modified.After(graceLimit) {
+			objectsKept++
+			continue
+		}
+
+		if app.verbose {
+			fmt.Printf("%s %s %s\n", object.key, formatSize(object.size), object.modified.Format(time.DateTime))
+		}
+
+		unreferenced = append(unreferenced, object)
+		unreferencedSize += object.size
+	}
+
+	fmt.Printf("Objects: %d\n", len(objects))
+
+	fmt.Printf("Unreferenced objects in the grace period: ")
+	printGreen(strconv.Itoa(objectsKept))
+
+	fmt.Printf("Unreferenced objects: ")
+	printRed(fmt.Sprintf("%d (%s)", len(unreferenced), formatSize(unreferencedSize)))
+
+	if len(unreferenced) == 0 {
+		return nil
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, no objects were deleted.")
+		return nil
+	}
+
+	if !askConfirmation(fmt.Sprintf("Do you want to delete %d objects and reclaim %s?", len(unreferenced), formatSize(unreferencedSize))) {
+		return nil
+	}
+
+	var reclaimedSize int64
+
+	for _, object := range unreferenced {
+		err = conn.deleteObject(object.key)
+
+		if err != nil {
+			return err
+		}
+
+		reclaimedSize += object.size
+	}
+
+	fmt.Printf("Reclaimed: ")
+	printGreen(formatSize(reclaimedSize))
+
+	return nil
+}
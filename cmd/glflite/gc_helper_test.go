@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// commitTestVersion writes a version of a tracked file and its GLFLite file,
+// and commits the GLFLite file when commit is set.
+func commitTestVersion(t *testing.T, app *application, filePath string, content string, commit bool) {
+	t.Helper()
+
+	file := writeTestFile(t, app, filePath, content)
+
+	err := app.writeJSONFile(filePath, fileData{FilePath: filePath, LastModified: file.lastModified, Size: file.size, Sha256Sum: getTestShasum(content)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commit {
+		runTestGit(t, app, "add", "--", getGLFLiteFilePath(filePath))
+		runTestGit(t, app, "commit", "--quiet", "-m", "version "+content)
+	}
+}
+
+// writeTestObject writes an object of a folder remote modified at the given
+// date.
+func writeTestObject(t *testing.T, storeFolder string, key string, content string, modified time.Time) {
+	t.Helper()
+
+	objectFile := storeFolder + "/" + getObjectPath(strings.TrimSuffix(key, partialObjectSuffix))
+
+	if strings.HasSuffix(key, partialObjectSuffix) {
+		objectFile += partialObjectSuffix
+	}
+
+	err := os.MkdirAll(filepath.Dir(objectFile), 0755)
+
+	if err == nil {
+		err = os.WriteFile(objectFile, []byte(content), 0644)
+	}
+
+	if err == nil {
+		err = os.Chtimes(objectFile, modified, modified)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	// two committed versions and the version of the working tree
+	commitTestVersion(t, app, "intro.mp4", "intro video 1", true)
+	commitTestVersion(t, app, "intro.mp4", "intro video 2", true)
+	commitTestVersion(t, app, "intro.mp4", "intro video 3", false)
+
+	app.trackedFiles["intro.mp4"] = trackedFile{isPresent: true}
+	app.sortedTrackedFiles = []string{"intro.mp4"}
+
+	storeFolder := t.TempDir()
+	lastMonth := time.Now().AddDate(0, -1, 0)
+
+	for _, key := range []string{
+		getTestShasum("intro video 1") + compressedObjectSuffix,
+		getTestShasum("intro video 2"),
+		getTestShasum("intro video 3") + partialObjectSuffix,
+		getTestShasum("deleted video"),
+	} {
+		writeTestObject(t, storeFolder, key, "content", lastMonth)
+	}
+
+	// an object of a commit that isn't in this clone yet
+	writeTestObject(t, storeFolder, getTestShasum("video of another clone"), "content", time.Now())
+
+	conn, err := app.openRemote(storeFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	referenced, err := app.getReferencedShasums(0, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"intro video 1", "intro video 2", "intro video 3"} {
+		if !referenced[getTestShasum(content)] {
+			t.Errorf("the version %q isn't referenced", content)
+		}
+	}
+
+	// only the last commit
+	lastCommit, err := app.getReferencedShasums(1, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lastCommit[getTestShasum("intro video 1")] || !lastCommit[getTestShasum("intro video 2")] || !lastCommit[getTestShasum("intro video 3")] {
+		t.Errorf("the versions referenced by the last commit are %v", lastCommit)
+	}
+
+	output := captureOutput(t, func() {
+		err = app.collectGarbage(conn, referenced, 14, true)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, summary := range []string{"Objects: 5\n", "Unreferenced objects in the grace period: 1\n", "Unreferenced objects: 1 (7 B)\n", "Dry run"} {
+		if !strings.Contains(output, summary) {
+			t.Errorf("the dry run didn't print %q:\n%s", summary, output)
+		}
+	}
+
+	if readTestObject(t, storeFolder, getTestShasum("deleted video")) == "" {
+		t.Fatal("the dry run deleted the object")
+	}
+
+	answerQuestions(t, "yes")
+
+	captureOutput(t, func() {
+		err = app.collectGarbage(conn, referenced, 14, false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, getTestShasum("deleted video")) != "" {
+		t.Error("the unreferenced object wasn't deleted")
+	}
+
+	for _, key := range []string{getTestShasum("intro video 1") + compressedObjectSuffix, getTestShasum("intro video 2"), getTestShasum("video of another clone")} {
+		if readTestObject(t, storeFolder, key) == "" {
+			t.Errorf("the object %s was deleted", key)
+		}
+	}
+
+	if !fileExists(storeFolder + "/" + getObjectPath(getTestShasum("intro video 3")) + partialObjectSuffix) {
+		t.Error("the partial upload of a referenced object was deleted")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// runGit runs a git command in the root folder of the repository and returns
+// its output.
+func (app *application) runGit(args ...string) ([]byte, error) {
+	return app.runGitWithInput(nil, args...)
+}
+
+// runGitWithInput runs a git command that reads its input from stdin, like
+// the batch modes of git cat-file.
+func (app *application) runGitWithInput(input io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = app.config.rootFolder
+	cmd.Stdin = input
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+
+	if err != nil {
+		return output, errors.New(fmt.Sprintf("git %s: %s %s", strings.Join(args, " "), err.Error(), strings.TrimSpace(stderr.String())))
+	}
+
+	return output, nil
+}
+
+// gitBlob is a file stored in git, identified by the hash of its object.
+type gitBlob struct {
+	hash string
+	path string
+}
+
+// findHistoryGLFLiteFiles returns the GLFLite files of the commits listed by
+// git rev-list with the given arguments, each version of a file only once.
+func (app *application) findHistoryGLFLiteFiles(revListArgs []string) ([]gitBlob, error) {
+	output, err := app.runGit(append([]string{"rev-list", "--objects"}, revListArgs...)...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []gitBlob
+
+	for _, line := range strings.Split(string(output), "\n") {
+		hash, filePath, found := strings.Cut(line, " ")
+
+		if !found || filePath == setupFile || !isGLFLiteFile(filePath) {
+			continue
+		}
+
+		blobs = append(blobs, gitBlob{hash: hash, path: filePath})
+	}
+
+	return blobs, nil
+}
+
+// readGitBlobs reads the GLFLite files stored in git using a single
+// git cat-file process. The hash can be any object name, like
+// <commit>:<path>. The files are returned in the same order as the blobs, the
+// files that aren't GLFLite files are returned empty.
+func (app *application) readGitBlobs(blobs []gitBlob) ([]fileData, error) {
+	if len(blobs) == 0 {
+		return nil, nil
+	}
+
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = app.config.rootFolder
+
+	var input bytes.Buffer
+
+	for _, blob := range blobs {
+		input.WriteString(blob.hash + "\n")
+	}
+
+	cmd.Stdin = &input
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(stdout)
+
+	var files []fileData
+
+	for _, blob := range blobs {
+		header, err := reader.ReadString('\n')
+
+		if err != nil {
+			cmd.Wait()
+			return nil, err
+		}
+
+		// the header is "<hash> <type> <size>" or "<hash> missing"
+		fields := strings.Fields(header)
+
+		if len(fields) != 3 {
+			cmd.Wait()
+			return nil, errors.New(fmt.Sprintf("git object %s not found", blob.hash))
+		}
+
+		size, err := strconv.Atoi(fields[2])
+
+		if err != nil {
+			cmd.Wait()
+			return nil, err
+		}
+
+		content := make([]byte, size+1)
+
+		_, err = io.ReadFull(reader, content)
+
+		if err != nil {
+			cmd.Wait()
+			return nil, err
+		}
+
+		var data fileData
+
+		// files with the GLFLite extension that aren't GLFLite files are ignored
+		if json.Unmarshal(content[:size], &data) != nil || data.Sha256Sum == "" {
+			data = fileData{}
+		} else {
+			data.FilePath = getTrackedFilePath(blob.path)
+		}
+
+		files = append(files, data)
+	}
+
+	return files, cmd.Wait()
+}
+
+// getIgnoredFiles returns the files that match the rules of the .gitignore
+// files, whether they are committed or not.
+func (app *application) getIgnoredFiles(filePaths []string) (map[string]bool, error) {
+	ignoredFiles := make(map[string]bool)
+
+	if len(filePaths) == 0 {
+		return ignoredFiles, nil
+	}
+
+	cmd := exec.Command("git", "check-ignore", "--no-index", "-z", "--stdin")
+	cmd.Dir = app.config.rootFolder
+	cmd.Stdin = strings.NewReader(strings.Join(filePaths, "\x00") + "\x00")
+
+	output, err := cmd.Output()
+
+	// check-ignore exits with 1 when none of the files is ignored
+	var exitError *exec.ExitError
+
+	if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+		return ignoredFiles, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("git check-ignore: %s", err.Error()))
+	}
+
+	for _, filePath := range strings.Split(string(output), "\x00") {
+		if filePath != "" {
+			ignoredFiles[filePath] = true
+		}
+	}
+
+	return ignoredFiles, nil
+}
+
+// getGitConfig returns the value of a git config key, or an empty string when
+// it isn't set.
+func (app *application) getGitConfig(key string) (string, error) {
+	cmd := exec.Command("git", "config", "--get", key)
+	cmd.Dir = app.config.rootFolder
+
+	output, err := cmd.Output()
+
+	// git config exits with 1 when the key isn't set
+	var exitError *exec.ExitError
+
+	if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+		return "", nil
+	} else if err != nil {
+		return "", errors.New(fmt.Sprintf("git config %s: %s", key, err.Error()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultGuardThreshold is the size in MB from which the staged files are
+// blocked when the setup file doesn't have size rules.
+const defaultGuardThreshold = 50
+
+// terminalDevice is read for the answers of the guard, git runs the hooks
+// without the terminal as standard input.
+var terminalDevice = "/dev/tty"
+
+const preCommitHook = "#!/bin/sh\n# blocks the commits of large files, installed by glflite guard -install-hook\nexec glflite guard\n"
+
+type stagedFile struct {
+	path  string
+	hash  string
+	size  int64
+	added bool
+}
+
+// getStagedFiles returns the files added or modified in the git index.
+func (app *application) getStagedFiles() ([]stagedFile, error) {
+	output, err := app.runGit("diff", "--cached", "--raw", "-z", "--no-abbrev", "--no-renames", "--diff-filter=AM")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files []stagedFile
+	var input strings.Builder
+
+	// the records are ":<old mode> <new mode> <old hash> <new hash> <status>\0<path>\0"
+	records := strings.Split(string(output), "\x00")
+
+	for i := 0; i+1 < len(records); i += 2 {
+		fields := strings.Fields(records[i])
+
+		// submodules are commits of other repositories
+		if len(fields) != 5 || fields[1] == "160000" {
+			continue
+		}
+
+		files = append(files, stagedFile{path: records[i+1], hash: fields[3], added: fields[4] == "A"})
+		input.WriteString(fields[3] + "\n")
+	}
+
+	if len(files) == 0 {
+		return files, nil
+	}
+
+	output, err = app.runGitWithInput(strings.NewReader(input.String()), "cat-file", "--batch-check")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the lines of cat-file are "<hash> <type> <size>" in the same order
+	lines := strings.Split(string(output), "\n")
+
+	for i := range files {
+		fields := []string{}
+
+		if i < len(lines) {
+			fields = strings.Fields(lines[i])
+		}
+
+		if len(fields) != 3 {
+			return nil, errors.New(fmt.Sprintf("git object %s not found", files[i].hash))
+		}
+
+		files[i].size, err = strconv.ParseInt(fields[2], 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// guardCommit checks the staged files before a commit, the files that match
+// the rules of the GitLFSLite section or are bigger than their size
+// threshold are blocked. It tells if the commit can go on.
+func (app *application) guardCommit() (bool, error) {
+	files, err := app.getStagedFiles()
+
+	if err != nil {
+		return false, err
+	}
+
+	var blockedFiles []stagedFile
+
+	for _, file := range files {
+		if isGLFLiteFile(file.path) {
+			continue
+		}
+
+		threshold := app.getSizeThreshold(file.path)
+
+		if !app.hasSizeRules() {
+			threshold = defaultGuardThreshold * 1024 * 1024
+		}
+
+		if isFileExcluded(app.config.fileRules, file.path, false) {
+			fmt.Printf("%s: ", file.path)
+			printRed(fmt.Sprintf("Matches the rules of the %s section (%s)", gitIgnoreSeparator, formatSize(file.size)))
+		} else if threshold > 0 && file.size >= threshold {
+			fmt.Printf("%s: ", file.path)
+			printRed(fmt.Sprintf("Bigger than %s (%s)", formatSize(threshold), formatSize(file.size)))
+		} else {
+			continue
+		}
+
+		blockedFiles = append(blockedFiles, file)
+	}
+
+	if len(blockedFiles) == 0 {
+		if app.verbose {
+			fmt.Println("No large files staged.")
+		}
+
+		return true, nil
+	}
+
+	fmt.Printf("Large files staged: ")
+	printRed(strconv.Itoa(len(blockedFiles)))
+
+	terminal, err := os.Open(terminalDevice)
+
+	if err != nil {
+		fmt.Println("Run glflite guard in a terminal to track them with GLFLite and unstage them, or use git commit --no-verify to commit them anyway.")
+		return false, nil
+	}
+
+	defer terminal.Close()
+
+	if !askConfirmationFrom(bufio.NewReader(terminal), "Do you want to track these files with GLFLite and unstage them?") {
+		return false, nil
+	}
+
+	for _, file := range blockedFiles {
+		if !isFileExcluded(app.config.fileRules, file.path, false) {
+			// the paths can have the characters of the patterns, like # or *
+			rule := escapeGitIgnoreRule(file.path)
+
+			err = addGitIgnoreRule(app.config.rootFolder, rule)
+
+			if err != nil {
+				return false, err
+			}
+
+			app.config.fileRules = append(app.config.fileRules, rule)
+
+			fmt.Println("Rule " + rule + " added.")
+		}
+
+		err = app.unstageFile(file)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	fmt.Println("Run the update action to create their GLFLite files and add them to the commit with the .gitignore file.")
+
+	return false, nil
+}
+
+// unstageFile removes a new file from the git index, or the staged change of
+// a file of the last commit. git rm --cached would stage the deletion of the
+// files of the last commit.
+func (app *application) unstageFile(file stagedFile) error {
+	if file.added {
+		_, err := app.runGit("rm", "--cached", "--quiet", "--", file.path)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("File " + file.path + " unstaged.")
+
+		return nil
+	}
+
+	_, err := app.runGit("reset", "--quiet", "--", file.path)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("File " + file.path + " unstaged, git still has the version of the last commit.")
+
+	return nil
+}
+
+// installGuardHook installs the guard action as the pre-commit hook of the
+// repository.
+func (app *application) installGuardHook() error {
+	output, err := app.runGit("rev-parse", "--git-path", "hooks/pre-commit")
+
+	if err != nil {
+		return err
+	}
+
+	hookFile := strings.TrimSpace(string(output))
+
+	if !filepath.IsAbs(hookFile) {
+		hookFile = app.getFullPath(hookFile)
+	}
+
+	content, err := os.ReadFile(hookFile)
+
+	if err == nil {
+		if strings.Contains(string(content), "glflite guard") {
+			fmt.Println("The pre-commit hook already runs glflite guard.")
+			return nil
+		}
+
+		return errors.New(fmt.Sprintf("The pre-commit hook %s already exists, add \"glflite guard || exit 1\" to it", hookFile))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(hookFile), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(hookFile, []byte(preCommitHook), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Pre-commit hook installed: " + hookFile)
+
+	return nil
+}
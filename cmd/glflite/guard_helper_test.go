@@ -0,0 +1,239 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGetStagedFiles(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, map[string]string{"README.md": "readme", "notes.txt": "notes"})
+
+	writeTestFile(t, app, "notes.txt", "more notes")
+	writeTestFile(t, app, "data/large.csv", "1,2,3\n")
+	runTestGit(t, app, "rm", "--quiet", "README.md")
+	runTestGit(t, app, "add", "--", "notes.txt", "data/large.csv")
+
+	files, err := app.getStagedFiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deleted files aren't staged
+	if len(files) != 2 || files[0].path != "data/large.csv" || files[0].size != 6 || files[1].path != "notes.txt" || files[1].size != 10 {
+		t.Errorf("the staged files are %v", files)
+	}
+}
+
+// setTestTerminal gives the answers that the guard reads from the terminal,
+// the terminal can't be opened when there are none.
+func setTestTerminal(t *testing.T, answers ...string) {
+	t.Helper()
+
+	device := t.TempDir() + "/tty"
+
+	if len(answers) > 0 {
+		err := os.WriteFile(device, []byte(strings.Join(answers, "\n")+"\n"), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	previous := terminalDevice
+	terminalDevice = device
+
+	t.Cleanup(func() {
+		terminalDevice = previous
+	})
+}
+
+func TestGuardCommit(t *testing.T) {
+	app := newTestApplication(t, nil)
+	setTestTerminal(t)
+	initTestRepository(t, app, map[string]string{".gitignore": gitIgnoreSeparator + "\n*.mp4\n"})
+
+	app.config.fileRules = []string{"*.mp4"}
+
+	writeTestFile(t, app, "notes.txt", "notes")
+	runTestGit(t, app, "add", "--", "notes.txt")
+
+	var canCommit bool
+	var err error
+
+	captureOutput(t, func() {
+		canCommit, err = app.guardCommit()
+	})
+
+	if err != nil || !canCommit {
+		t.Fatalf("the commit of a small file was blocked: %v", err)
+	}
+
+	// the files of the rules and the ones bigger than the threshold are blocked
+	app.config.setup.SizeThreshold = 1
+
+	writeTestFile(t, app, "intro.mp4", "intro video")
+	writeTestFile(t, app, "data/large.csv", strings.Repeat("x", 1024*1024))
+	runTestGit(t, app, "add", "--force", "--", "intro.mp4", "data/large.csv")
+
+	output := captureOutput(t, func() {
+		canCommit, err = app.guardCommit()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if canCommit {
+		t.Error("the commit of the large files wasn't blocked")
+	}
+
+	for _, message := range []string{
+		"intro.mp4: Matches the rules of the #GitLFSLite section",
+		"data/large.csv: Bigger than 1024.0 KB",
+		"Large files staged: 2\n",
+		"Run glflite guard in a terminal",
+	} {
+		if !strings.Contains(output, message) {
+			t.Errorf("the guard didn't print %q:\n%s", message, output)
+		}
+	}
+
+	// the small file isn't blocked with the size rules
+	if strings.Contains(output, "notes.txt") {
+		t.Errorf("the small file was blocked:\n%s", output)
+	}
+}
+
+func TestGuardCommitFromTerminal(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, map[string]string{".gitignore": gitIgnoreSeparator + "\n"})
+
+	app.config.setup.SizeThreshold = 1
+
+	// the small file of the backup folder has the name of the large file
+	writeTestFile(t, app, "dump.sql", strings.Repeat("x", 1024*1024))
+	writeTestFile(t, app, "backup/dump.sql", "small dump")
+	runTestGit(t, app, "add", "--", "dump.sql", "backup/dump.sql")
+
+	// the standard input of the hooks isn't the terminal
+	answerQuestions(t, "no")
+	setTestTerminal(t, "yes")
+
+	var canCommit bool
+	var err error
+
+	output := captureOutput(t, func() {
+		canCommit, err = app.guardCommit()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if canCommit || !strings.Contains(output, "Rule /dump.sql added.") {
+		t.Fatalf("the guard printed:\n%s", output)
+	}
+
+	if staged := runTestGit(t, app, "diff", "--cached", "--name-only"); staged != "backup/dump.sql\n" {
+		t.Errorf("the staged files are:\n%s", staged)
+	}
+
+	for filePath, tracked := range map[string]bool{"dump.sql": true, "backup/dump.sql": false} {
+		if isFileExcluded(app.config.fileRules, filePath, false) != tracked {
+			t.Errorf("the rules track %s: %t", filePath, !tracked)
+		}
+
+		// git check-ignore exits with 1 when the file isn't ignored
+		err = exec.Command("git", "-C", app.config.rootFolder, "check-ignore", "--quiet", "--no-index", "--", filePath).Run()
+
+		if (err == nil) != tracked {
+			t.Errorf("git ignores %s: %t", filePath, !tracked)
+		}
+	}
+}
+
+func TestInstallGuardHook(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	for i := 0; i < 2; i++ {
+		err := app.installGuardHook()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hookFile := app.getFullPath(".git/hooks/pre-commit")
+
+	info, err := os.Stat(hookFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestFile(t, app, ".git/hooks/pre-commit") != preCommitHook || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("the hook is %s", info.Mode())
+	}
+
+	// another hook isn't replaced
+	err = os.WriteFile(hookFile, []byte("#!/bin/sh\nexit 0\n"), 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.installGuardHook()
+
+	if err == nil || readTestFile(t, app, ".git/hooks/pre-commit") != "#!/bin/sh\nexit 0\n" {
+		t.Errorf("the other hook was replaced: %v", err)
+	}
+}
+
+func TestUnstageFile(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, map[string]string{"videos/intro.mp4": "intro video"})
+
+	writeTestFile(t, app, "videos/intro.mp4", "intro video, second version")
+	writeTestFile(t, app, "videos/outro.mp4", "outro video")
+	runTestGit(t, app, "add", "--", "videos")
+
+	files, err := app.getStagedFiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("the staged files are %v", files)
+	}
+
+	for _, file := range files {
+		err = app.unstageFile(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	staged := runTestGit(t, app, "diff", "--cached", "--name-status")
+
+	if staged != "" {
+		t.Errorf("the changes staged after unstaging the files are:\n%s", staged)
+	}
+
+	// the file of the last commit is still in git, the new file isn't
+	tracked := runTestGit(t, app, "ls-files")
+
+	if tracked != "videos/intro.mp4\n" {
+		t.Errorf("the files of the index are:\n%s", tracked)
+	}
+
+	if readTestFile(t, app, "videos/intro.mp4") != "intro video, second version" {
+		t.Error("the change of the file was lost")
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileVersion is a version of a GLFLite file in the git history.
+type fileVersion struct {
+	commit  string
+	author  string
+	date    string
+	path    string
+	deleted bool
+	data    fileData
+}
+
+// cleanHistoryPath returns the path of a tracked file relative to the root
+// folder, the path of its GLFLite file is also accepted.
+func cleanHistoryPath(filePath string) string {
+	filePath = filepath.ToSlash(filepath.Clean(filePath))
+
+	return getTrackedFilePath(strings.TrimPrefix(filePath, "./"))
+}
+
+// parseRevisionPath splits a <path>@<rev> argument, the revision is HEAD when
+// it is missing. Paths can contain @ too, so a tracked file is used as a
+// whole, then the first split that matches a tracked file, or the last @
+// when none matches. The path is returned relative to the root folder.
+func (app *application) parseRevisionPath(arg string) (string, string, error) {
+	filePath := arg
+	revision := "HEAD"
+
+	if trackedFilePath, err := app.resolvePath(arg); err == nil {
+		if _, ok := app.trackedFiles[trackedFilePath]; ok {
+			return trackedFilePath, revision, nil
+		}
+	}
+
+	separator := strings.LastIndex(arg, "@")
+
+	if separator > 0 {
+		for i := 1; i < separator; i++ {
+			if arg[i] != '@' {
+				continue
+			}
+
+			if trackedFilePath, err := app.resolvePath(arg[:i]); err == nil {
+				if _, ok := app.trackedFiles[trackedFilePath]; ok {
+					separator = i
+					break
+				}
+			}
+		}
+
+		filePath = arg[:separator]
+		revision = arg[separator+1:]
+	}
+
+	trackedFilePath, err := app.resolvePath(filePath)
+
+	return trackedFilePath, revision, err
+}
+
+// getFileHistory returns the versions of the GLFLite file of a file, from the
+// newest to the oldest, following the renames.
+func (app *application) getFileHistory(filePath string) ([]fileVersion, error) {
+	output, err := app.runGit("-c", "core.quotePath=false", "log", "--follow", "--format=%x01%H%x00%an <%ae>%x00%ai", "--name-status", "--", getGLFLiteFilePath(filePath))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []fileVersion
+
+	for _, line := range strings.Split(string(output), "\n") {
+		// the commits start with \x01, followed by the "<status>\t<path>" lines
+		// of the changed files, renames have the old and the new path
+		if header, found := strings.CutPrefix(line, "\x01"); found {
+			fields := strings.Split(header, "\x00")
+
+			if len(fields) == 3 {
+				versions = append(versions, fileVersion{commit: fields[0], author: fields[1], date: fields[2]})
+			}
+
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+
+		if len(versions) == 0 || len(fields) < 2 {
+			continue
+		}
+
+		version := &versions[len(versions)-1]
+		version.path = fields[len(fields)-1]
+		version.deleted = strings.HasPrefix(fields[0], "D")
+	}
+
+	var blobs []gitBlob
+	var history []fileVersion
+
+	for _, version := range versions {
+		// merges without changes in the file don't list it
+		if version.path == "" {
+			continue
+		}
+
+		if !version.deleted {
+			blobs = append(blobs, gitBlob{hash: version.commit + ":" + version.path, path: version.path})
+		}
+
+		history = append(history, version)
+	}
+
+	files, err := app.readGitBlobs(blobs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range history {
+		if !history[i].deleted {
+			history[i].data = files[0]
+			files = files[1:]
+		}
+	}
+
+	return history, nil
+}
+
+func (app *application) printFileHistory(filePath string) error {
+	history, err := app.getFileHistory(filePath)
+
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		return errors.New(fmt.Sprintf("The GLFLite file of %s has no history in git", filePath))
+	}
+
+	for _, version := range history {
+		if !app.verbose {
+			if version.deleted {
+				fmt.Printf("%s %s deleted\n", version.commit[:12], version.date)
+			} else {
+				fmt.Printf("%s %s %s %s\n", version.commit[:12], version.date, formatSize(version.data.Size), version.data.Sha256Sum)
+			}
+
+			continue
+		}
+
+		fmt.Printf("commit %s\n", version.commit)
+		fmt.Printf("Author: %s\n", version.author)
+		fmt.Printf("Date: %s\n", version.date)
+
+		if version.path != getGLFLiteFilePath(filePath) {
+			fmt.Printf("Path: %s\n", getTrackedFilePath(version.path))
+		}
+
+		if version.deleted {
+			printRed("Deleted")
+		} else if version.data.Sha256Sum == "" {
+			printRed("Not a GLFLite file")
+		} else {
+			fmt.Printf("Size: %s (%d bytes)\n", formatSize(version.data.Size), version.data.Size)
+			fmt.Printf("LastModified: %s\n", version.data.LastModified.Format("2006-01-02 15:04:05 -0700"))
+			fmt.Printf("Sha256Sum: %s\n", version.data.Sha256Sum)
+		}
+
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// getStoreNames returns the stores where the versions of the files are
+// searched, the local store first, then the default remote and the other
+// remotes of the setup file.
+func (app *application) getStoreNames(remoteName string) []string {
+	storeNames := []string{}
+
+	if remoteName != "" {
+		storeNames = append(storeNames, remoteName)
+	}
+
+	if remoteName != localRemoteName && isDirectory(app.getLocalStoreFolder()) {
+		storeNames = append(storeNames, localRemoteName)
+	}
+
+	defaultRemote := app.config.setup.DefaultRemote
+
+	if defaultRemote != "" && defaultRemote != remoteName && defaultRemote != localRemoteName {
+		storeNames = append(storeNames, defaultRemote)
+	}
+
+	var otherRemotes []string
+
+	for name := range app.config.setup.Remotes {
+		if name != remoteName && name != localRemoteName && name != defaultRemote {
+			otherRemotes = append(otherRemotes, name)
+		}
+	}
+
+	sort.Strings(otherRemotes)
+
+	return append(storeNames, otherRemotes...)
+}
+
+// storeCurrentVersion copies a file to the local store before it is replaced
+// by another version, unless it is already there.
+func (app *application) storeCurrentVersion(filePath string, data fileData) error {
+	conn, err := app.openRemote(localRemoteName)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.close()
+
+	_, err = conn.findObject(data.Sha256Sum)
+
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, ErrRemoteObjectNotFound) {
+		return err
+	}
+
+	if app.verbose {
+		fmt.Printf("Saving the current version of %s in the local store\n", filePath)
+	}
+
+	object, content, err := app.prepareObject(conn, filePath, data)
+
+	if errors.Is(err, ErrFileChanged) {
+		return errors.New(fmt.Sprintf("The file %s changed since its GLFLite file was updated, run the update action first or use the -force flag to discard the changes", filePath))
+	} else if err != nil {
+		return err
+	}
+
+	err = conn.putObject(object, content)
+
+	content.Close()
+
+	if content.Name() != app.getFullPath(filePath) {
+		os.Remove(content.Name())
+	}
+
+	return err
+}
+
+// getRevisionPath returns the path of the GLFLite file of a file at a
+// revision, it is different when the file was renamed after the revision.
+func (app *application) getRevisionPath(filePath string, revision string) (string, error) {
+	output, err := app.runGit("rev-parse", "--verify", "--quiet", revision+"^{commit}")
+
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Unknown revision %s", revision))
+	}
+
+	commit := strings.TrimSpace(string(output))
+
+	history, err := app.getFileHistory(filePath)
+
+	if err != nil {
+		return "", err
+	}
+
+	// the newest version that is an ancestor of the revision is the one it has
+	for _, version := range history {
+		_, err = app.runGit("merge-base", "--is-ancestor", version.commit, commit)
+
+		if err != nil {
+			continue
+		}
+
+		if version.deleted {
+			return "", errors.New(fmt.Sprintf("The file %s was deleted at %s", filePath, revision))
+		}
+
+		return version.path, nil
+	}
+
+	return getGLFLiteFilePath(filePath), nil
+}
+
+// checkoutFile restores the version of a file of a git revision from the
+// first store that has it, and writes its GLFLite file. The current version
+// is saved in the local store so that it can be restored later.
+func (app *application) checkoutFile(filePath string, revision string, remoteName string, force bool) error {
+	glfFile, err := app.getRevisionPath(filePath, revision)
+
+	if err != nil {
+		return err
+	}
+
+	files, err := app.readGitBlobs([]gitBlob{{hash: revision + ":" + glfFile, path: glfFile}})
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("The GLFLite file of %s can't be read at %s: %s", filePath, revision, err.Error()))
+	}
+
+	data := files[0]
+
+	if data.Sha256Sum == "" {
+		return errors.New(fmt.Sprintf("The file %s at %s is not a GLFLite file", glfFile, revision))
+	}
+
+	current, err := app.readJSONFile(filePath)
+	hasCurrent := err == nil
+
+	if err != nil && !errors.Is(err, ErrGLFLiteFileNotFound) {
+		return err
+	}
+
+	file, tracked := app.trackedFiles[filePath]
+
+	if tracked && file.isPresent {
+		if isLink(app.getFullPath(filePath)) {
+			return errors.New(fmt.Sprintf("The file %s is a link", filePath))
+		}
+
+		isUpToDate := hasCurrent && isSameModificationTime(current.LastModified, file.file.lastModified) && current.Size == file.file.size
+
+		if isUpToDate && current.Sha256Sum == data.Sha256Sum {
+			fmt.Printf("File %s is already at the version of %s.\n", filePath, revision)
+			return nil
+		}
+
+		if !isUpToDate && !force {
+			return errors.New(fmt.Sprintf("The file %s changed since its GLFLite file was updated, run the update action first or use the -force flag to discard the changes", filePath))
+		}
+
+		if isUpToDate {
+			err = app.storeCurrentVersion(filePath, current)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	restored := false
+
+	for _, storeName := range app.getStoreNames(remoteName) {
+		conn, err := app.openRemote(storeName)
+
+		if err != nil {
+			if app.verbose {
+				fmt.Printf("%s: ", storeName)
+				printRed(err.Error())
+			}
+
+			continue
+		}
+
+		err = app.pullFile(conn, filePath, data)
+
+		conn.close()
+
+		if err == nil {
+			if app.verbose {
+				fmt.Printf("Restored %s from %s\n", filePath, storeName)
+			}
+
+			restored = true
+			break
+		}
+
+		if !errors.Is(err, ErrRemoteObjectNotFound) && app.verbose {
+			fmt.Printf("%s: ", storeName)
+			printRed(err.Error())
+		}
+	}
+
+	if !restored {
+		return errors.New(fmt.Sprintf("The version of %s at %s (%s) isn't stored on any reachable store", filePath, revision, data.Sha256Sum))
+	}
+
+	data.FilePath = filePath
+
+	if hasCurrent {
+		data.TrackedSince = current.TrackedSince
+	}
+
+	err = app.writeJSONFile(filePath, data)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: ", filePath)
+	printGreen("Restored the version of " + revision)
+
+	return nil
+}
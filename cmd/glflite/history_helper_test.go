@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestTrackedFile marks a file of the repository as present and tracked,
+// with its information on the disk.
+func setTestTrackedFile(t *testing.T, app *application, filePath string) {
+	t.Helper()
+
+	info, err := os.Stat(app.getFullPath(filePath))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := fileInformation{path: filePath, lastModified: info.ModTime(), size: info.Size()}
+
+	if _, ok := app.trackedFiles[filePath]; !ok {
+		app.sortedTrackedFiles = append(app.sortedTrackedFiles, filePath)
+	}
+
+	app.trackedFiles[filePath] = trackedFile{file: file, isPresent: true}
+}
+
+func TestFileHistoryFollowsRenames(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	commitTestVersion(t, app, "intro.mp4", "intro video 1", true)
+	commitTestVersion(t, app, "intro.mp4", "intro video 2", true)
+
+	runTestGit(t, app, "mv", "intro.mp4.glflite", "intro@2x.mp4.glflite")
+	runTestGit(t, app, "commit", "--quiet", "-m", "rename")
+
+	commitTestVersion(t, app, "intro@2x.mp4", "intro video 3", true)
+
+	history, err := app.getFileHistory("intro@2x.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		path    string
+		content string
+	}{
+		{"intro@2x.mp4.glflite", "intro video 3"},
+		{"intro@2x.mp4.glflite", "intro video 2"},
+		{"intro.mp4.glflite", "intro video 2"},
+		{"intro.mp4.glflite", "intro video 1"},
+	}
+
+	if len(history) != len(expected) {
+		t.Fatalf("the history has %d versions, expected %d: %v", len(history), len(expected), history)
+	}
+
+	for i, version := range history {
+		if version.path != expected[i].path || version.data.Sha256Sum != getTestShasum(expected[i].content) || version.deleted {
+			t.Errorf("the version %d is %s with %s, expected %s with %q", i, version.path, version.data.Sha256Sum, expected[i].path, expected[i].content)
+		}
+	}
+
+	output := captureOutput(t, func() {
+		err = app.printFileHistory("intro@2x.mp4")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(output, "\n") != 4 || !strings.Contains(output, getTestShasum("intro video 1")) {
+		t.Errorf("the log printed:\n%s", output)
+	}
+
+	// the path of a tracked file can contain @
+	app.trackedFiles["intro@2x.mp4"] = trackedFile{}
+
+	for arg, expected := range map[string][2]string{
+		"intro@2x.mp4":           {"intro@2x.mp4", "HEAD"},
+		"intro@2x.mp4@HEAD~2":    {"intro@2x.mp4", "HEAD~2"},
+		"./intro@2x.mp4.glflite": {"intro@2x.mp4", "HEAD"},
+		"outro.mp4@v1.0":         {"outro.mp4", "v1.0"},
+	} {
+		filePath, revision, err := app.parseRevisionPath(arg)
+
+		if err != nil || filePath != expected[0] || revision != expected[1] {
+			t.Errorf("%s is the path %s at %s: %v", arg, filePath, revision, err)
+		}
+	}
+}
+
+func TestCheckoutFile(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	commitTestVersion(t, app, "intro.mp4", "intro video 1", true)
+	commitTestVersion(t, app, "intro.mp4", "intro video 2", true)
+
+	setTestTrackedFile(t, app, "intro.mp4")
+
+	// the first version is only in the local store
+	writeTestObject(t, app.getLocalStoreFolder(), getTestShasum("intro video 1"), "intro video 1", time.Now())
+
+	var err error
+
+	captureOutput(t, func() {
+		err = app.checkoutFile("intro.mp4", "HEAD~1", "", false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := app.readJSONFile("intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestFile(t, app, "intro.mp4") != "intro video 1" || data.Sha256Sum != getTestShasum("intro video 1") {
+		t.Fatal("the first version wasn't restored")
+	}
+
+	// the version that was replaced was saved in the local store
+	if readTestObject(t, app.getLocalStoreFolder(), getTestShasum("intro video 2")) != "intro video 2" {
+		t.Fatal("the current version wasn't saved in the local store")
+	}
+
+	setTestTrackedFile(t, app, "intro.mp4")
+
+	captureOutput(t, func() {
+		err = app.checkoutFile("intro.mp4", "HEAD", "", false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestFile(t, app, "intro.mp4") != "intro video 2" {
+		t.Error("the last version wasn't restored from the local store")
+	}
+
+	// the changes that aren't in the GLFLite file aren't discarded without -force
+	writeTestFile(t, app, "intro.mp4", "intro video 2, edited")
+	setTestTrackedFile(t, app, "intro.mp4")
+
+	err = app.checkoutFile("intro.mp4", "HEAD~1", "", false)
+
+	if err == nil || readTestFile(t, app, "intro.mp4") != "intro video 2, edited" {
+		t.Error("the checkout replaced a modified file")
+	}
+
+	// a version that no store has
+	_, err = app.getRevisionPath("intro.mp4", "no-such-revision")
+
+	if err == nil {
+		t.Error("an unknown revision was accepted")
+	}
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentShasumHeader = "X-Content-Sha256"
+
+// objectServer shares the files over HTTP by their Sha256 sum. It serves the
+// tracked files of the repository, or the objects of a remote folder when
+// the store is set.
+type objectServer struct {
+	app      *application
+	store    *folderRemote
+	token    string
+	allowPut bool
+
+	mutex        sync.RWMutex
+	presentFiles map[string]string
+	missingFiles map[string][]string
+}
+
+func (app *application) newObjectServer(store string, token string, allowPut bool) (*objectServer, error) {
+	server := &objectServer{
+		app:          app,
+		token:        token,
+		allowPut:     allowPut,
+		presentFiles: make(map[string]string),
+		missingFiles: make(map[string][]string),
+	}
+
+	if store != "" {
+		folder, err := newFolderRemote(store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		server.store = folder
+
+		return server, nil
+	}
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if isLink(app.getFullPath(fileFullPath)) {
+			continue
+		}
+
+		data, err := app.readJSONFile(fileFullPath)
+
+		if errors.Is(err, ErrGLFLiteFileNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !file.isPresent {
+			server.missingFiles[data.Sha256Sum] = append(server.missingFiles[data.Sha256Sum], fileFullPath)
+			continue
+		}
+
+		// only the files that didn't change since the GLFLite file was updated are shared
+		if isSameModificationTime(data.LastModified, file.file.lastModified) && data.Size == file.file.size {
+			server.presentFiles[data.Sha256Sum] = fileFullPath
+		} else if app.verbose {
+			fmt.Printf("File %s is not up to date, it will not be shared.\n", fileFullPath)
+		}
+	}
+
+	return server, nil
+}
+
+func (s *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	key, found := strings.CutPrefix(r.URL.Path, "/objects/")
+
+	if !found || !isValidObjectKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.app.verbose {
+		fmt.Printf("%s %s %s\n", r.RemoteAddr, r.Method, r.URL.Path)
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.serveObject(w, r, key)
+	case http.MethodPut:
+		if !s.allowPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.receiveObject(w, r, key)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// isValidObjectKey only accepts lowercase letters and numbers, and dots after
+// the first 4 characters for the suffixes, so that the keys can't be used to
+// access the files outside of the store.
+func isValidObjectKey(key string) bool {
+	if len(key) < 4 {
+		return false
+	}
+
+	for i, char := range key {
+		if char == '.' && i >= 4 {
+			continue
+		}
+
+		if !(char >= '0' && char <= '9' || char >= 'a' && char <= 'z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *objectServer) getObjectFile(key string) string {
+	if s.store != nil {
+		return s.store.folder + "/" + getObjectPath(key)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if filePath, ok := s.presentFiles[key]; ok {
+		return s.app.getFullPath(filePath)
+	}
+
+	return ""
+}
+
+// serveObject answers GET and HEAD requests, http.ServeContent handles the
+// range requests.
+func (s *objectServer) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	objectFile := s.getObjectFile(key)
+
+	if objectFile == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(objectFile)
+
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if s.store == nil {
+		w.Header().Set(contentShasumHeader, key)
+	}
+
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// verifyObjectKey checks that the content of an uploaded object matches its
+// key, so that a client can't store another content under the key of a file.
+// The key is the Sha256 sum of the file, of the decompressed content for the
+// compressed objects. The encrypted objects are named with an HMAC that the
+// server can't compute without the key, so they aren't accepted.
+func verifyObjectKey(key string, objectFile string, shaSum string) error {
+	if isShasum(key) {
+		if shaSum != key {
+			return errors.New("The Sha256 sum of the content doesn't match the key of the object")
+		}
+
+		return nil
+	}
+
+	fileShasum, found := strings.CutSuffix(key, compressedObjectSuffix)
+
+	if !found || !isShasum(fileShasum) {
+		return errors.New("Only the objects named by their Sha256 sum can be uploaded")
+	}
+
+	file, err := os.Open(objectFile)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	// the encrypted objects can't be decompressed either
+	err = decompressContent(hash, file)
+
+	if err != nil || fmt.Sprintf("%x", hash.Sum(nil)) != fileShasum {
+		return errors.New("The Sha256 sum of the decompressed content doesn't match the key of the object")
+	}
+
+	return nil
+}
+
+// receiveObject saves the uploaded content once it is verified against its
+// key. Without a store only the files that are missing in the repository are
+// accepted.
+func (s *objectServer) receiveObject(w http.ResponseWriter, r *http.Request, key string) {
+	s.mutex.RLock()
+	missingFiles := s.missingFiles[key]
+	s.mutex.RUnlock()
+
+	if s.store == nil && len(missingFiles) == 0 {
+		http.Error(w, "The file is not missing in the repository", http.StatusConflict)
+		return
+	}
+
+	tmpFolder := s.app.getStateFolder() + "/tmp"
+
+	// the upload is renamed to its place, so it has to be on the same file system
+	if s.store != nil {
+		tmpFolder = s.store.folder
+	}
+
+	err := os.MkdirAll(tmpFolder, 0755)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.CreateTemp(tmpFolder, ".upload-*")
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(file, hash), r.Body)
+
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	shaSum := fmt.Sprintf("%x", hash.Sum(nil))
+
+	// the header of the client detects the uploads corrupted on the way
+	if r.Header.Get(contentShasumHeader) != "" && r.Header.Get(contentShasumHeader) != shaSum {
+		http.Error(w, "The Sha256 sum of the content doesn't match", http.StatusBadRequest)
+		return
+	}
+
+	err = verifyObjectKey(key, file.Name(), shaSum)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.store != nil {
+		objectFile := s.store.folder + "/" + getObjectPath(key)
+
+		err = os.MkdirAll(filepath.Dir(objectFile), 0755)
+
+		if err == nil {
+			err = os.Rename(file.Name(), objectFile)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	// the files are written in the working tree, so the other actions can't run at the same time
+	lock, err := s.app.lockRepository("serve", false)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	defer lock.release()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, filePath := range missingFiles {
+		data, err := s.app.readJSONFile(filePath)
+
+		if err == nil {
+			err = copyFile(file.Name(), s.app.getFullPath(filePath))
+		}
+
+		if err == nil {
+			err = os.Chtimes(s.app.getFullPath(filePath), data.LastModified, data.LastModified)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Printf("Received %s\n", filePath)
+
+		s.presentFiles[key] = filePath
+	}
+
+	delete(s.missingFiles, key)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// copyFile copies a file with writeReaderAtomic, a file received by the serve
+// action never appears partially written in the working tree.
+func copyFile(source string, destination string) error {
+	err := os.MkdirAll(filepath.Dir(destination), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	sourceFile, err := os.Open(source)
+
+	if err != nil {
+		return err
+	}
+
+	defer sourceFile.Close()
+
+	return writeReaderAtomic(destination, sourceFile, 0644)
+}
+
+func (app *application) serve(address string, store string, token string, allowPut bool) error {
+	server, err := app.newObjectServer(store, token, allowPut)
+
+	if err != nil {
+		return err
+	}
+
+	if store != "" {
+		fmt.Printf("Serving the objects of %s on %s\n", store, address)
+	} else {
+		fmt.Printf("Serving %d files on %s\n", len(server.presentFiles), address)
+	}
+
+	if token == "" {
+		printRed("Warning: no token set, anyone that can reach the server can download the files.")
+	}
+
+	return http.ListenAndServe(address, server)
+}
+
+// httpRemote gets the files from a glflite server.
+type httpRemote struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func newHTTPRemote(remoteURL *url.URL, token string) (*httpRemote, error) {
+	return &httpRemote{
+		baseURL: strings.TrimSuffix(remoteURL.String(), "/"),
+		token:   token,
+		client:  &http.Client{},
+	}, nil
+}
+
+// getHTTPToken returns the token of the HTTP remotes and of the serve action.
+// It is read from the GLFLITE_TOKEN environment variable, then from the
+// glflite.<remote>.token and glflite.token git config keys, the .glflite setup
+// file is committed so it can't hold the token.
+func (app *application) getHTTPToken(remoteName string) (string, error) {
+	token := os.Getenv("GLFLITE_TOKEN")
+
+	if token != "" {
+		return token, nil
+	}
+
+	if remoteName != "" {
+		token, err := app.getGitConfig("glflite." + remoteName + ".token")
+
+		if err != nil || token != "" {
+			return token, err
+		}
+	}
+
+	return app.getGitConfig("glflite.token")
+}
+
+// getHTTPRemoteToken refuses the tokens written in the setup file, anybody
+// who can read the repository could read them.
+func (app *application) getHTTPRemoteToken(remoteData remoteConfig) (string, error) {
+	if remoteData.Token != "" {
+		return "", errors.New(fmt.Sprintf("The token of the remote %s is written in the %s file, which is committed with the repository. Remove it from the file, change the token of the server and set the new one with git config glflite.%s.token or the GLFLITE_TOKEN environment variable", remoteData.Name, setupFile, remoteData.Name))
+	}
+
+	return app.getHTTPToken(remoteData.Name)
+}
+
+func (r *httpRemote) newRequest(method string, key string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, r.baseURL+"/objects/"+key, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if r.token != "" {
+		request.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	return request, nil
+}
+
+func getHTTPError(response *http.Response) error {
+	if response.StatusCode == http.StatusNotFound {
+		return ErrRemoteObjectNotFound
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+
+	if len(message) == 0 {
+		return errors.New(fmt.Sprintf("the server answered %s", response.Status))
+	}
+
+	return errors.New(fmt.Sprintf("the server answered %s: %s", response.Status, strings.TrimSpace(string(message))))
+}
+
+func (r *httpRemote) statObject(key string) (remoteObject, error) {
+	request, err := r.newRequest(http.MethodHead, key, nil)
+
+	if err != nil {
+		return remoteObject{}, err
+	}
+
+	response, err := r.client.Do(request)
+
+	if err != nil {
+		return remoteObject{}, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return remoteObject{}, getHTTPError(response)
+	}
+
+	modified, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+
+	return remoteObject{
+		key:      key,
+		size:     response.ContentLength,
+		shasum:   response.Header.Get(contentShasumHeader),
+		modified: modified,
+	}, nil
+}
+
+func (r *httpRemote) putObject(object remoteObject, content io.ReadSeeker) error {
+	_, err := content.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return err
+	}
+
+	request, err := r.newRequest(http.MethodPut, object.key, io.NopCloser(content))
+
+	if err != nil {
+		return err
+	}
+
+	request.ContentLength = object.size
+	request.Header.Set(contentShasumHeader, object.shasum)
+
+	response, err := r.client.Do(request)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusCreated {
+		return getHTTPError(response)
+	}
+
+	return nil
+}
+
+func (r *httpRemote) getObject(key string, offset int64) (io.ReadCloser, error) {
+	request, err := r.newRequest(http.MethodGet, key, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	response, err := r.client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		return response.Body, nil
+	case http.StatusOK:
+		// the server ignored the range, skip the bytes already downloaded
+		_, err = io.CopyN(io.Discard, response.Body, offset)
+
+		if err != nil {
+			response.Body.Close()
+			return nil, err
+		}
+
+		return response.Body, nil
+	}
+
+	defer response.Body.Close()
+
+	return nil, getHTTPError(response)
+}
+
+func (r *httpRemote) listObjects() ([]remoteObject, error) {
+	return nil, ErrRemoteNotSupported
+}
+
+func (r *httpRemote) deleteObject(key string) error {
+	return ErrRemoteNotSupported
+}
+
+func (r *httpRemote) close() error {
+	r.client.CloseIdleConnections()
+
+	return nil
+}
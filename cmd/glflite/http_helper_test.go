@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// startTestStoreServer starts the serve action with a store and the uploads
+// allowed, and returns the connection of a client with the right token.
+func startTestStoreServer(t *testing.T, app *application) (*remoteConnection, string) {
+	t.Helper()
+
+	storeFolder := t.TempDir()
+
+	server, err := app.newObjectServer(storeFolder, "secret", true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(server)
+
+	t.Cleanup(httpServer.Close)
+
+	t.Setenv("GLFLITE_TOKEN", "secret")
+
+	app.config.setup.Remotes = map[string]remoteConfig{
+		"laptop": {URL: httpServer.URL},
+	}
+
+	conn, err := app.openRemote("laptop")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, storeFolder
+}
+
+func TestHTTPStorePushAndPull(t *testing.T) {
+	files := map[string]string{
+		"videos/intro.mp4": strings.Repeat("intro video ", 1000),
+		"photos/cover.raw": "cover photo",
+	}
+
+	app := newTestApplication(t, files)
+	conn, storeFolder := startTestStoreServer(t, app)
+
+	err := app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		if readTestObject(t, storeFolder, getTestShasum(content)) != content {
+			t.Errorf("the object of %s wasn't stored", filePath)
+		}
+
+		err = os.Remove(app.getFullPath(filePath))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := app.trackedFiles[filePath]
+		file.isPresent = false
+		app.trackedFiles[filePath] = file
+	}
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		if readTestFile(t, app, filePath) != content {
+			t.Errorf("%s wasn't pulled", filePath)
+		}
+	}
+}
+
+func TestHTTPServeRepositoryFiles(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"intro.mp4": "intro video", "outro.mp4": "outro video"})
+
+	// the outro isn't on this computer, a client can upload it
+	err := os.Remove(app.getFullPath("outro.mp4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["outro.mp4"]
+	file.isPresent = false
+	app.trackedFiles["outro.mp4"] = file
+
+	server, err := app.newObjectServer("", "secret", true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(server)
+
+	t.Cleanup(httpServer.Close)
+
+	serverURL, err := url.Parse(httpServer.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := newHTTPRemote(serverURL, "secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := conn.statObject(getTestShasum("intro video"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if object.size != int64(len("intro video")) || object.shasum != getTestShasum("intro video") {
+		t.Errorf("the server shares the object %v", object)
+	}
+
+	_, err = conn.statObject(getTestShasum("outro video"))
+
+	if !errors.Is(err, ErrRemoteObjectNotFound) {
+		t.Errorf("the server shares a missing file: %v", err)
+	}
+
+	err = conn.putObject(remoteObject{key: getTestShasum("outro video"), size: 11, shasum: getTestShasum("outro video")}, strings.NewReader("outro video"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestFile(t, app, "outro.mp4") != "outro video" {
+		t.Error("the missing file wasn't received")
+	}
+
+	// the files that aren't missing can't be replaced
+	err = conn.putObject(remoteObject{key: getTestShasum("intro video"), size: 11, shasum: getTestShasum("intro video")}, strings.NewReader("intro video"))
+
+	if err == nil {
+		t.Error("the server replaced a file that isn't missing")
+	}
+}
+
+func TestHTTPServeWaitsForRepositoryLock(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"outro.mp4": "outro video"})
+
+	err := os.Remove(app.getFullPath("outro.mp4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["outro.mp4"]
+	file.isPresent = false
+	app.trackedFiles["outro.mp4"] = file
+
+	server, err := app.newObjectServer("", "secret", true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another action writes the working tree
+	lock, err := app.lockRepository("update", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putObject := func() int {
+		request := httptest.NewRequest(http.MethodPut, "/objects/"+getTestShasum("outro video"), strings.NewReader("outro video"))
+		request.Header.Set("Authorization", "Bearer secret")
+
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		return response.Code
+	}
+
+	if status := putObject(); status != http.StatusServiceUnavailable {
+		t.Errorf("the upload during the update answered %d", status)
+	}
+
+	if fileExists(app.getFullPath("outro.mp4")) {
+		t.Error("the file was written while the repository is locked")
+	}
+
+	lock.release()
+
+	if status := putObject(); status != http.StatusCreated {
+		t.Errorf("the upload answered %d", status)
+	}
+
+	if readTestFile(t, app, "outro.mp4") != "outro video" {
+		t.Error("the missing file wasn't received")
+	}
+
+	if fileExists(app.getStateFolder() + "/lock") {
+		t.Error("the serve action didn't release the lock")
+	}
+
+	entries, err := os.ReadDir(app.getFullPath(""))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("the temporary file %s was left", entry.Name())
+		}
+	}
+}
+
+func TestHTTPRemoteToken(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	t.Setenv("GLFLITE_TOKEN", "")
+
+	runTestGit(t, app, "config", "glflite.token", "shared")
+	runTestGit(t, app, "config", "glflite.laptop.token", "laptop")
+
+	for _, test := range []struct {
+		remote      remoteConfig
+		environment string
+		token       string
+		refused     bool
+	}{
+		{remoteConfig{Name: "laptop"}, "", "laptop", false},
+		{remoteConfig{Name: "desktop"}, "", "shared", false},
+		{remoteConfig{Name: "laptop"}, "secret", "secret", false},
+		{remoteConfig{Name: "laptop", Token: "committed"}, "", "", true},
+	} {
+		t.Setenv("GLFLITE_TOKEN", test.environment)
+
+		token, err := app.getHTTPRemoteToken(test.remote)
+
+		if test.refused {
+			if err == nil || !strings.Contains(err.Error(), setupFile) {
+				t.Errorf("the token of the setup file wasn't refused: %v", err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token != test.token {
+			t.Errorf("the token of %s is %q with GLFLITE_TOKEN=%q, expected %q", test.remote.Name, token, test.environment, test.token)
+		}
+	}
+}
+
+func TestHTTPServerChecksToken(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"intro.mp4": "intro video"})
+
+	server, err := app.newObjectServer("", "secret", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		method string
+		token  string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "secret", http.StatusOK},
+		{http.MethodPut, "secret", http.StatusMethodNotAllowed},
+	} {
+		request := httptest.NewRequest(test.method, "/objects/"+getTestShasum("intro video"), strings.NewReader("intro video"))
+
+		if test.token != "" {
+			request.Header.Set("Authorization", "Bearer "+test.token)
+		}
+
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		if response.Code != test.status {
+			t.Errorf("%s with the token %q answered %d, expected %d", test.method, test.token, response.Code, test.status)
+		}
+	}
+}
+
+func putTestHTTPObject(conn *remoteConnection, key string, content []byte) error {
+	object := remoteObject{key: key, size: int64(len(content)), shasum: getTestShasum(string(content))}
+
+	return conn.putObject(object, bytes.NewReader(content))
+}
+
+func TestHTTPStoreVerifiesKey(t *testing.T) {
+	app := newTestApplication(t, nil)
+	conn, storeFolder := startTestStoreServer(t, app)
+
+	// the header matches the content, but the key is the one of another file
+	err := putTestHTTPObject(conn, getTestShasum("intro video"), []byte("fake video"))
+
+	if err == nil {
+		t.Error("the server stored a content under the key of another file")
+	}
+
+	if fileExists(storeFolder + "/" + getObjectPath(getTestShasum("intro video"))) {
+		t.Error("the object with the wrong content was written")
+	}
+
+	err = putTestHTTPObject(conn, getTestShasum("intro video"), []byte("intro video"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, getTestShasum("intro video")) != "intro video" {
+		t.Error("the object wasn't stored")
+	}
+}
+
+func TestHTTPStoreVerifiesCompressedObject(t *testing.T) {
+	app := newTestApplication(t, nil)
+	conn, storeFolder := startTestStoreServer(t, app)
+
+	content := strings.Repeat("raw log line\n", 1000)
+	key := getTestShasum(content) + compressedObjectSuffix
+
+	var compressed bytes.Buffer
+
+	err := compressContent(3, &compressed, strings.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = putTestHTTPObject(conn, key, compressed.Bytes())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, key) != compressed.String() {
+		t.Error("the compressed object wasn't stored")
+	}
+
+	// the compressed content of another file
+	compressed.Reset()
+
+	err = compressContent(3, &compressed, strings.NewReader("another log"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = putTestHTTPObject(conn, getTestShasum("intro video")+compressedObjectSuffix, compressed.Bytes())
+
+	if err == nil {
+		t.Error("the server stored a compressed content under the key of another file")
+	}
+
+	// the partial uploads and the other names aren't objects
+	err = putTestHTTPObject(conn, getTestShasum("intro video")+partialObjectSuffix, []byte("intro video"))
+
+	if err == nil {
+		t.Error("the server stored an object that isn't named by its Sha256 sum")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+const glfliteIgnoreFile = ".glfliteignore"
+
+// walkExclusions are the folders and files left out of the walk, their
+// content isn't read at all.
+type walkExclusions struct {
+	rules          []string
+	ignoredFolders map[string]bool
+	oneFileSystem  bool
+	device         uint64
+}
+
+// getWalkExclusions returns the rules of the .glfliteignore file and of the
+// walk_exclude option of the setup file, and the folders ignored by git where
+// the #GitLFSLite section can't match any file. The GLFLite files of those
+// folders couldn't be committed, so they can't contain tracked files.
+func (app *application) getWalkExclusions() (walkExclusions, error) {
+	exclusions := walkExclusions{
+		rules:          app.config.setup.WalkExclude,
+		ignoredFolders: make(map[string]bool),
+		oneFileSystem:  app.config.setup.OneFileSystem,
+	}
+
+	ignoreFile := app.getFullPath(glfliteIgnoreFile)
+
+	if fileExists(ignoreFile) {
+		content, err := ioutil.ReadFile(ignoreFile)
+
+		if err != nil {
+			return exclusions, err
+		}
+
+		exclusions.rules = append(exclusions.rules, strings.Split(string(content), "\n")...)
+	}
+
+	if exclusions.oneFileSystem {
+		info, err := os.Stat(app.config.rootFolder)
+
+		if err != nil {
+			return exclusions, err
+		}
+
+		exclusions.device, _ = getDevice(info)
+	}
+
+	if app.config.setup.WalkIgnoredFolders {
+		return exclusions, nil
+	}
+
+	// git doesn't list the content of the ignored folders with --directory, only the folders
+	output, err := app.runGit("ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "-z")
+
+	if err != nil {
+		return exclusions, err
+	}
+
+	var folders []string
+
+	for _, filePath := range strings.Split(string(output), "\x00") {
+		if strings.HasSuffix(filePath, "/") {
+			folders = append(folders, filePath)
+		}
+	}
+
+	// git also lists the folders that only have ignored files, without ignoring the folder itself
+	ignoredFolders, err := app.getIgnoredFiles(folders)
+
+	if err != nil {
+		return exclusions, err
+	}
+
+	for _, filePath := range folders {
+		folder := strings.TrimSuffix(filePath, "/")
+
+		if !isFileExcluded(app.config.fileRules, folder, true) && !canMatchInFolder(app.config.fileRules, folder, ignoredFolders[filePath]) {
+			exclusions.ignoredFolders[folder] = true
+		}
+	}
+
+	return exclusions, nil
+}
+
+// isExcluded tells if a file or a folder of the walk is left out, the
+// GLFLite files follow the file they describe.
+func (w walkExclusions) isExcluded(filePath string, entry fs.DirEntry) bool {
+	if entry.IsDir() {
+		if w.ignoredFolders[filePath] {
+			return true
+		}
+
+		// the mount points are the folders with another device than the root folder
+		if w.oneFileSystem {
+			info, err := entry.Info()
+
+			if err == nil {
+				if device, ok := getDevice(info); ok && device != w.device {
+					return true
+				}
+			}
+		}
+	}
+
+	return matchesIgnoreRules(w.rules, getTrackedFilePath(filePath), entry.IsDir())
+}
+
+// matchesIgnoreRules tells if a file is selected by rules like the ones of
+// the .gitignore files. The rules without a slash match the name of the file
+// at any depth, the others match the path from the root folder, and the rules
+// that end with a slash only match folders.
+func matchesIgnoreRules(rules []string, filePath string, isDir bool) bool {
+	matched := false
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(rule, "!")
+		rule = strings.TrimPrefix(rule, "!")
+
+		if strings.HasSuffix(rule, "/") {
+			if !isDir {
+				continue
+			}
+
+			rule = strings.TrimSuffix(rule, "/")
+		}
+
+		name := path.Base(filePath)
+
+		if strings.Contains(rule, "/") {
+			rule = strings.TrimPrefix(rule, "/")
+			name = filePath
+		}
+
+		if ok, _ := path.Match(rule, name); ok {
+			matched = !negate
+		}
+	}
+
+	return matched
+}
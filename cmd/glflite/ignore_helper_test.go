@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMatchesIgnoreRules(t *testing.T) {
+	rules := []string{"# cache folders", "cache/", "*.tmp", "!keep.tmp", "/build", "assets/raw/*.psd", ""}
+
+	for _, test := range []struct {
+		filePath string
+		isDir    bool
+		matches  bool
+	}{
+		{"cache", true, true},
+		{"videos/cache", true, true},
+		{"videos/cache", false, false},
+		{"videos/intro.tmp", false, true},
+		{"videos/keep.tmp", false, false},
+		{"build", true, true},
+		{"videos/build", true, false},
+		{"assets/raw/cover.psd", false, true},
+		{"assets/raw/2024/cover.psd", false, false},
+		{"videos/intro.mp4", false, false},
+	} {
+		if matchesIgnoreRules(rules, test.filePath, test.isDir) != test.matches {
+			t.Errorf("the rules match %s: %t", test.filePath, !test.matches)
+		}
+	}
+}
+
+func TestWalkExclusions(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4":       "intro video",
+		"media/outro.mp4":        "outro video",
+		"cache/thumbnail.mp4":    "thumbnail",
+		"videos/intro.mp4.tmp":   "temporary",
+		"node_modules/video.mp4": "dependency",
+	})
+
+	initTestRepository(t, app, map[string]string{
+		".gitignore":     "node_modules/\nmedia/\n" + gitIgnoreSeparator + "\n*.mp4\nmedia/\n",
+		".glfliteignore": "# generated files\ncache/\n",
+	})
+
+	app.config.fileRules = []string{"*.mp4", "media/"}
+	app.config.setup.WalkExclude = []string{"*.tmp"}
+
+	exclusions, err := app.getWalkExclusions()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the media folder is ignored by the #GitLFSLite section, its files are tracked
+	if len(exclusions.ignoredFolders) != 1 || !exclusions.ignoredFolders["node_modules"] {
+		t.Errorf("the folders ignored by git are %v", exclusions.ignoredFolders)
+	}
+
+	files := walkTestFiles(t, app, nil, exclusions, true)
+
+	var filePaths []string
+
+	for _, file := range files {
+		if !file.isDirectory {
+			filePaths = append(filePaths, file.path)
+		}
+	}
+
+	if strings.Join(filePaths, ",") != ".glfliteignore,media/outro.mp4,media/outro.mp4.glflite,videos/intro.mp4,videos/intro.mp4.glflite" {
+		t.Errorf("the files found are %v", filePaths)
+	}
+
+	// the folders ignored by git are walked when walk_ignored_folders is set
+	app.config.setup.WalkIgnoredFolders = true
+
+	exclusions, err = app.getWalkExclusions()
+
+	if err != nil || len(exclusions.ignoredFolders) != 0 {
+		t.Errorf("the folders ignored by git are %v: %v", exclusions.ignoredFolders, err)
+	}
+}
+
+func TestOneFileSystem(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	app.config.setup.OneFileSystem = true
+	app.config.setup.WalkIgnoredFolders = true
+
+	exclusions, err := app.getWalkExclusions()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(app.getFullPath("videos"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := getDevice(info); !ok {
+		t.Skip("the devices of the files aren't known")
+	}
+
+	if exclusions.isExcluded("videos", fs.FileInfoToDirEntry(info)) {
+		t.Error("a folder of the file system of the root folder was excluded")
+	}
+
+	// a folder of another file system is a mount point
+	exclusions.device++
+
+	if !exclusions.isExcluded("videos", fs.FileInfoToDirEntry(info)) {
+		t.Error("a folder of another file system was walked")
+	}
+}
+
+func TestCanMatchInFolder(t *testing.T) {
+	rules := []string{"*.mp4", "media/", "/build/scans/cover.tiff", "!node_modules/keep.mp4"}
+
+	for _, test := range []struct {
+		folder    string
+		isIgnored bool
+		can       bool
+	}{
+		// git lists videos/ because all its files are ignored
+		{"videos", false, true},
+		{"node_modules", true, false},
+		{"assets/media", true, true},
+		{"build", true, true},
+		{"build/scans", true, true},
+		{"build/cache", true, false},
+	} {
+		if canMatchInFolder(rules, test.folder, test.isIgnored) != test.can {
+			t.Errorf("the rules can match a file in %s: %t", test.folder, !test.can)
+		}
+	}
+
+	if !canMatchInFolder([]string{"*"}, "node_modules", true) {
+		t.Error("the rule * doesn't match the ignored folder")
+	}
+
+	if canMatchInFolder([]string{"videos/intro.mp4"}, "logs", false) {
+		t.Error("the rule of a file matches another folder")
+	}
+}
+
+func TestWalkIgnoredFolders(t *testing.T) {
+	app := newTestApplication(t, nil)
+	initTestRepository(t, app, nil)
+
+	// git lists videos/ as an ignored folder, it only has files ignored by the #GitLFSLite section
+	writeTestFile(t, app, "videos/intro.mp4", "intro video")
+	writeTestFile(t, app, "videos/outro.mp4", "outro video")
+	writeTestFile(t, app, "node_modules/lodash/index.js", "module.exports = {}")
+	writeTestFile(t, app, "node_modules/lodash/demo.mp4", "demo video")
+	writeTestFile(t, app, "build/scans/cover.tiff", "cover scan")
+	writeTestFile(t, app, "build/app.js", "app")
+
+	for _, rules := range [][]string{{"*.mp4", "build/scans/cover.tiff"}, {"videos/intro.mp4", "videos/outro.mp4", "build/scans/cover.tiff"}} {
+		content := "node_modules/\nbuild/\n" + gitIgnoreSeparator + "\n"
+
+		for _, rule := range rules {
+			content += rule + "\n"
+		}
+
+		err := os.WriteFile(app.getFullPath(".gitignore"), []byte(content+gitIgnoreEndMarker+"\n"), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app.config.fileRules = rules
+		app.files = nil
+		app.trackedFiles = make(map[string]trackedFile)
+
+		err = app.findTrackedFiles(false)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the GLFLite file of node_modules/lodash/demo.mp4 couldn't be committed
+		expected := []string{"build/scans/cover.tiff", "videos/intro.mp4", "videos/outro.mp4"}
+
+		if len(app.sortedTrackedFiles) != len(expected) {
+			t.Fatalf("the files found with the rules %v are %v, expected %v", rules, app.sortedTrackedFiles, expected)
+		}
+
+		for i, filePath := range expected {
+			if app.sortedTrackedFiles[i] != filePath {
+				t.Errorf("the files found with the rules %v are %v, expected %v", rules, app.sortedTrackedFiles, expected)
+			}
+		}
+	}
+
+	// the folders where no rule can match a file aren't walked
+	exclusions, err := app.getWalkExclusions()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !exclusions.ignoredFolders["node_modules"] || exclusions.ignoredFolders["videos"] || exclusions.ignoredFolders["build"] {
+		t.Errorf("the ignored folders left out of the walk are %v", exclusions.ignoredFolders)
+	}
+}
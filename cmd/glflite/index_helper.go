@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// the clock of the file systems with nanoseconds only ticks every few milliseconds
+	racyWindow = 100 * time.Millisecond
+
+	// FAT keeps the last modified date with 2 seconds
+	coarseRacyWindow = 2 * time.Second
+)
+
+// quickStatus is the result of the comparison of a file with its GLFLite
+// file without hashing it.
+type quickStatus int
+
+const (
+	quickUnchanged quickStatus = iota
+	quickModified
+	quickRacy
+	// only the last modified date changed, the local index has the Sha256 sum of the GLFLite file
+	quickTouched
+)
+
+// indexEntry is the information of a file when its Sha256 sum was computed
+// on this clone, with the date when the hash started.
+type indexEntry struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Changed      time.Time `json:"changed"`
+	Inode        uint64    `json:"inode,omitempty"`
+	Sha256Sum    string    `json:"sha256sum"`
+	Hashed       time.Time `json:"hashed"`
+}
+
+// localIndex keeps the information of the hashed files in the git directory,
+// it isn't shared with the other clones. It lets the quick check trust the
+// files hashed after their last change.
+type localIndex struct {
+	file    string
+	entries map[string]indexEntry
+	changed bool
+}
+
+func (app *application) openIndex() (*localIndex, error) {
+	index := &localIndex{
+		file:    app.getStateFolder() + "/index",
+		entries: make(map[string]indexEntry),
+	}
+
+	content, err := os.ReadFile(index.file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		var entry indexEntry
+
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Path != "" {
+			index.entries[entry.Path] = entry
+		}
+	}
+
+	return index, nil
+}
+
+// record adds the Sha256 sum of a file hashed from the date hashed.
+func (index *localIndex) record(filePath string, file fileInformation, shaSum string, hashed time.Time) {
+	if index == nil {
+		return
+	}
+
+	index.entries[filePath] = indexEntry{
+		Path:         filePath,
+		Size:         file.size,
+		LastModified: file.lastModified,
+		Changed:      file.changed,
+		Inode:        file.inode,
+		Sha256Sum:    shaSum,
+		Hashed:       hashed,
+	}
+
+	index.changed = true
+}
+
+// saveIndex writes the local index when a file was hashed, without the files
+// that aren't tracked anymore.
+func (app *application) saveIndex() error {
+	index := app.index
+
+	if index == nil || !index.changed {
+		return nil
+	}
+
+	var lines []string
+
+	for _, filePath := range app.sortedTrackedFiles {
+		entry, ok := index.entries[filePath]
+
+		if !ok {
+			continue
+		}
+
+		line, err := json.Marshal(entry)
+
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, string(line))
+	}
+
+	// the files outside of the scope weren't walked, they are kept
+	for filePath, entry := range index.entries {
+		if _, ok := app.trackedFiles[filePath]; ok || isInScope(app.scope, filePath) {
+			continue
+		}
+
+		line, err := json.Marshal(entry)
+
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, string(line))
+	}
+
+	sort.Strings(lines)
+
+	err := os.MkdirAll(app.getStateFolder(), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(index.file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// getTimePrecision returns the precision of a last modified date, from the
+// trailing zeros of its nanoseconds.
+func getTimePrecision(t time.Time) time.Duration {
+	precision := time.Nanosecond
+
+	for precision < time.Second && t.Nanosecond()%int(precision*10) == 0 {
+		precision *= 10
+	}
+
+	return precision
+}
+
+// isSameModificationTime compares two last modified dates with the precision
+// of the less precise one, the file systems and the copy tools don't all keep
+// the nanoseconds.
+func isSameModificationTime(a time.Time, b time.Time) bool {
+	precision := getTimePrecision(a)
+
+	if getTimePrecision(b) > precision {
+		precision = getTimePrecision(b)
+	}
+
+	return a.Truncate(precision).Equal(b.Truncate(precision))
+}
+
+// isRacy tells if a file could have been modified after the hash started
+// without changing its last modified date, because both happened in the
+// same tick of the clock of the file system, like the racy files of git.
+func isRacy(lastModified time.Time, hashed time.Time) bool {
+	window := racyWindow
+
+	if getTimePrecision(lastModified) >= time.Second {
+		window = coarseRacyWindow
+	}
+
+	return hashed.Sub(lastModified) < window
+}
+
+// getQuickStatus compares a file with its GLFLite file using the size and the
+// last modified date. The file is racy when its Sha256 sum has to be checked:
+// it was modified close to the date of its GLFLite file or of its last hash on
+// this clone, or, with the check_inode option, it was replaced since then. The
+// file is touched when the local index shows that only its last modified
+// date changed.
+func (app *application) getQuickStatus(filePath string, file fileInformation, data fileData) quickStatus {
+	if app.index != nil {
+		entry, ok := app.index.entries[filePath]
+
+		if ok && entry.Sha256Sum == data.Sha256Sum && entry.Size == file.size && entry.LastModified.Equal(file.lastModified) {
+			if app.config.setup.CheckInode && (!entry.Changed.Equal(file.changed) || entry.Inode != file.inode) {
+				return quickRacy
+			}
+
+			// the file could have been modified in the same tick as the hash
+			if isRacy(entry.LastModified, entry.Hashed) {
+				return quickRacy
+			}
+
+			if data.Size == file.size && isSameModificationTime(data.LastModified, file.lastModified) {
+				return quickUnchanged
+			}
+
+			return quickTouched
+		}
+	}
+
+	if data.Size != file.size || !isSameModificationTime(data.LastModified, file.lastModified) {
+		return quickModified
+	}
+
+	// the GLFLite file is written after the hash, its date is the latest date of the hash
+	info, err := os.Stat(app.getFullPath(getGLFLiteFilePath(filePath)))
+
+	if err == nil && isRacy(file.lastModified, info.ModTime()) {
+		return quickRacy
+	}
+
+	return quickUnchanged
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIsSameModificationTime(t *testing.T) {
+	date := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+
+	for _, test := range []struct {
+		a    time.Time
+		b    time.Time
+		same bool
+	}{
+		{date, date, true},
+		{date, date.Add(time.Nanosecond), false},
+		{date, date.Truncate(time.Second), true},
+		{date, date.Truncate(time.Microsecond), true},
+		{date, date.Truncate(time.Second).Add(time.Second), false},
+		{date.Truncate(time.Millisecond), date.Truncate(time.Millisecond).Add(time.Millisecond), false},
+	} {
+		if isSameModificationTime(test.a, test.b) != test.same {
+			t.Errorf("%v and %v aren't compared as the same date: %v", test.a, test.b, test.same)
+		}
+	}
+}
+
+func TestIsRacy(t *testing.T) {
+	date := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+
+	for _, test := range []struct {
+		lastModified time.Time
+		hashed       time.Time
+		racy         bool
+	}{
+		{date, date.Add(10 * time.Millisecond), true},
+		{date, date.Add(time.Second), false},
+		// the dates of FAT only have seconds
+		{date.Truncate(time.Second), date.Truncate(time.Second).Add(time.Second), true},
+		{date.Truncate(time.Second), date.Truncate(time.Second).Add(3 * time.Second), false},
+	} {
+		if isRacy(test.lastModified, test.hashed) != test.racy {
+			t.Errorf("the file modified at %v and hashed at %v isn't racy: %v", test.lastModified, test.hashed, test.racy)
+		}
+	}
+}
+
+func TestGetQuickStatus(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	file := app.trackedFiles["videos/intro.mp4"].file
+
+	data, err := app.readJSONFile("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := app.getQuickStatus("videos/intro.mp4", file, data); status != quickUnchanged {
+		t.Errorf("the status of the file is %d", status)
+	}
+
+	// a file modified just before its GLFLite file was written is hashed
+	racy := writeTestFile(t, app, "videos/outro.mp4", "outro video")
+
+	err = app.writeJSONFile("videos/outro.mp4", fileData{LastModified: racy.lastModified, Size: racy.size, Sha256Sum: getTestShasum("outro video")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outro, err := app.readJSONFile("videos/outro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := app.getQuickStatus("videos/outro.mp4", racy, outro); status != quickRacy {
+		t.Errorf("the status of the racy file is %d", status)
+	}
+
+	// the index trusts the file hashed after its last change
+	app.index = &localIndex{entries: make(map[string]indexEntry)}
+	app.index.record("videos/outro.mp4", racy, outro.Sha256Sum, racy.lastModified.Add(time.Second))
+
+	if status := app.getQuickStatus("videos/outro.mp4", racy, outro); status != quickUnchanged {
+		t.Errorf("the status of the indexed file is %d", status)
+	}
+
+	file.size++
+
+	if status := app.getQuickStatus("videos/intro.mp4", file, data); status != quickModified {
+		t.Errorf("the status of the modified file is %d", status)
+	}
+}
+
+func TestSaveIndex(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"videos/outro.mp4": "outro video",
+	})
+
+	app.scope = []scopePattern{{pattern: "videos/intro.mp4"}}
+
+	index, err := app.openIndex()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.index = index
+
+	for filePath, file := range app.trackedFiles {
+		index.record(filePath, file.file, file.shasum, time.Now())
+	}
+
+	// the file outside of the scope isn't tracked anymore, it is kept
+	index.record("photos/cover.raw", fileInformation{size: 11}, getTestShasum("cover photo"), time.Now())
+
+	err = app.saveIndex()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.index, err = app.openIndex()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(app.index.entries) != 3 {
+		t.Fatalf("the index has %d entries", len(app.index.entries))
+	}
+
+	intro := app.index.entries["videos/intro.mp4"]
+
+	if intro.Sha256Sum != getTestShasum("intro video") || !intro.LastModified.Equal(app.trackedFiles["videos/intro.mp4"].file.lastModified) {
+		t.Errorf("the entry of the intro is %+v", intro)
+	}
+
+	// the index is only written when a file was hashed
+	err = os.Remove(app.index.file)
+
+	if err == nil {
+		err = app.saveIndex()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(app.index.file); err == nil {
+		t.Error("the index was written without changes")
+	}
+}
+
+func TestRacyIndexEntry(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	app.index = &localIndex{entries: make(map[string]indexEntry)}
+
+	// the update hashes the file in the same tick as its last change
+	file := writeTestFile(t, app, "videos/intro.mp4", "intro video")
+	app.trackedFiles["videos/intro.mp4"] = trackedFile{file: file, isPresent: true}
+
+	shaSum, err := app.getFileShasum("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.writeJSONFile("videos/intro.mp4", fileData{LastModified: file.lastModified, Size: file.size, Sha256Sum: shaSum})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the GLFLite file was written again later, like by a checkout
+	later := time.Now().Add(time.Minute)
+
+	err = os.Chtimes(app.getFullPath(getGLFLiteFilePath("videos/intro.mp4")), later, later)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file is touched again in the same tick, with the same size and date
+	writeTestFile(t, app, "videos/intro.mp4", "INTRO VIDEO")
+
+	err = os.Chtimes(app.getFullPath("videos/intro.mp4"), file.lastModified, file.lastModified)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := app.readJSONFile("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := app.getQuickStatus("videos/intro.mp4", file, data); status != quickRacy {
+		t.Fatalf("the status of the file hashed in the same tick is %d", status)
+	}
+
+	// the hash of the update finds the change
+	shaSum, err = app.getFileShasum("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shaSum != getTestShasum("INTRO VIDEO") {
+		t.Errorf("the Sha256 sum of the file is %s", shaSum)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// interrupted is set by the first Ctrl-C when the action stops gracefully,
+// the second one stops the program right away.
+var interrupted atomic.Bool
+
+// handleInterrupts runs the cleanup functions before the program stops on
+// Ctrl-C. With graceful, the first Ctrl-C only sets interrupted so that the
+// action finishes the current file.
+func handleInterrupts(graceful bool) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for range signals {
+			if graceful && !interrupted.Load() {
+				interrupted.Store(true)
+				printRed("Interrupted, finishing the current file. Press Ctrl-C again to stop now.")
+				continue
+			}
+
+			printRed("Interrupted")
+			exit(130)
+		}
+	}()
+}
+
+// journalEntry is a file that the update action has to hash, the Sha256 sum
+// and the date when the hash started are set once it is hashed.
+type journalEntry struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Sha256Sum    string    `json:"sha256sum,omitempty"`
+	Hashed       time.Time `json:"hashed,omitempty"`
+}
+
+// updateJournal lists the pending files of the update action and records the
+// ones already hashed, so that an interrupted update resumes without hashing
+// them again. It is deleted when the update finishes.
+//
+// The Sha256 sum of a file is synced to the journal right after the hash and
+// before its GLFLite file is written. When the update crashes between the two,
+// the GLFLite file is still missing or outdated, so the next update finds the
+// file pending again and writes its GLFLite file with the sum of the journal,
+// as long as the size and the last modified date of the file didn't change. A
+// crash after the GLFLite file is written leaves nothing to resume for that
+// file, the GLFLite files are written atomically.
+type updateJournal struct {
+	file    string
+	writer  *os.File
+	pending []string
+	hashed  map[string]journalEntry
+}
+
+// getPendingFiles returns the present files that don't have a GLFLite file,
+// changed since it was updated or have to be hashed to know it.
+func (app *application) getPendingFiles() []string {
+	var pendingFiles []string
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent || file.file.isDirectory || isLink(app.getFullPath(fileFullPath)) {
+			continue
+		}
+
+		data, err := app.readJSONFile(fileFullPath)
+
+		if err != nil {
+			pendingFiles = append(pendingFiles, fileFullPath)
+			continue
+		}
+
+		status := app.getQuickStatus(fileFullPath, file.file, data)
+
+		if status != quickUnchanged && status != quickTouched {
+			pendingFiles = append(pendingFiles, fileFullPath)
+		}
+	}
+
+	return pendingFiles
+}
+
+func (app *application) openUpdateJournal() (*updateJournal, error) {
+	journal := &updateJournal{
+		file:   app.getStateFolder() + "/update-journal",
+		hashed: make(map[string]journalEntry),
+	}
+
+	content, err := os.ReadFile(journal.file)
+
+	if err == nil {
+		pendingCount := 0
+
+		for _, line := range strings.Split(string(content), "\n") {
+			var entry journalEntry
+
+			// the last line is incomplete when the update stopped while writing it
+			if json.Unmarshal([]byte(line), &entry) != nil {
+				continue
+			}
+
+			if entry.Sha256Sum == "" {
+				pendingCount++
+			} else {
+				journal.hashed[entry.Path] = entry
+			}
+		}
+
+		fmt.Printf("Resuming the interrupted update, %d of %d files were already hashed.\n", len(journal.hashed), pendingCount)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	pendingFiles := app.getPendingFiles()
+
+	journal.pending = pendingFiles
+
+	if len(pendingFiles) == 0 && len(journal.hashed) == 0 {
+		return journal, nil
+	}
+
+	var lines []string
+
+	for _, fileFullPath := range pendingFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		line, err := json.Marshal(journalEntry{Path: fileFullPath, Size: file.file.size, LastModified: file.file.lastModified})
+
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, string(line))
+	}
+
+	// the files hashed by the interrupted update are kept, they are only used if they didn't change
+	hashedPaths := make([]string, 0, len(journal.hashed))
+
+	for filePath := range journal.hashed {
+		hashedPaths = append(hashedPaths, filePath)
+	}
+
+	sort.Strings(hashedPaths)
+
+	for _, filePath := range hashedPaths {
+		line, err := json.Marshal(journal.hashed[filePath])
+
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, string(line))
+	}
+
+	err = os.MkdirAll(app.getStateFolder(), 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFileAtomic(journal.file, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	journal.writer, err = os.OpenFile(journal.file, os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// isHashed tells if the interrupted update hashed a file that didn't change
+// since.
+func (j *updateJournal) isHashed(filePath string, file fileInformation) bool {
+	entry, ok := j.hashed[filePath]
+
+	return ok && entry.Size == file.size && entry.LastModified.Equal(file.lastModified)
+}
+
+// getFileShasum returns the Sha256 sum of a file, from the journal when the
+// interrupted update hashed it and it didn't change since. The local index
+// gets the Sha256 sum in both cases.
+func (j *updateJournal) getFileShasum(app *application, filePath string, file fileInformation) (string, error) {
+	if j.isHashed(filePath, file) {
+		entry := j.hashed[filePath]
+
+		// the journals of the older versions don't have the date of the hash, the file is racy in the index
+		app.index.record(filePath, file, entry.Sha256Sum, entry.Hashed)
+
+		return entry.Sha256Sum, nil
+	}
+
+	// the hash starts a little later, an earlier date only makes the file racy sooner
+	hashed := time.Now()
+
+	shaSum, err := app.getFileShasum(filePath)
+
+	if err != nil || j.writer == nil {
+		return shaSum, err
+	}
+
+	line, err := json.Marshal(journalEntry{Path: filePath, Size: file.size, LastModified: file.lastModified, Sha256Sum: shaSum, Hashed: hashed})
+
+	if err != nil {
+		return shaSum, err
+	}
+
+	_, err = j.writer.Write(append(line, '\n'))
+
+	if err != nil {
+		return shaSum, err
+	}
+
+	return shaSum, j.writer.Sync()
+}
+
+// close keeps the journal to resume the update, finished deletes it.
+func (j *updateJournal) close(finished bool) error {
+	if j.writer != nil {
+		j.writer.Close()
+	}
+
+	if !finished {
+		return nil
+	}
+
+	err := os.Remove(j.file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// loadShasums sets the Sha256 sum of the GLFLite files of the files that the
+// interrupted update didn't reach, so the lists are complete.
+func (app *application) loadShasums() {
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if file.shasum != "" {
+			continue
+		}
+
+		data, err := app.readJSONFile(fileFullPath)
+
+		if err == nil {
+			file.shasum = data.Sha256Sum
+			app.trackedFiles[fileFullPath] = file
+		}
+	}
+}
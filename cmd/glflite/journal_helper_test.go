@@ -0,0 +1,285 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateJournalResumes(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"videos/outro.mp4": "outro video",
+	})
+
+	// the intro changed and the cover is new, the outro is up to date
+	for filePath, content := range map[string]string{"videos/intro.mp4": "intro video, second version", "photos/cover.raw": "cover photo"} {
+		app.addTrackedFile(trackedFile{file: writeTestFile(t, app, filePath, content), isPresent: true})
+	}
+
+	if strings.Join(app.getPendingFiles(), ",") != "photos/cover.raw,videos/intro.mp4" {
+		t.Fatalf("the pending files are %v", app.getPendingFiles())
+	}
+
+	journal, err := app.openUpdateJournal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intro := app.trackedFiles["videos/intro.mp4"].file
+
+	shaSum, err := journal.getFileShasum(app, "videos/intro.mp4", intro)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shaSum != getTestShasum("intro video, second version") {
+		t.Errorf("the Sha256 sum of the intro is %s", shaSum)
+	}
+
+	// the update stops before writing the GLFLite file, in the middle of a line of the journal
+	err = journal.close(false)
+
+	if err == nil {
+		err = appendTestFile(app.getStateFolder()+"/update-journal", `{"path": "photos/cov`)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the content changes without changing the size and the date, the sum of the journal is used
+	writeTestFile(t, app, "videos/intro.mp4", "INTRO VIDEO, SECOND VERSION")
+
+	err = os.Chtimes(app.getFullPath("videos/intro.mp4"), intro.lastModified, intro.lastModified)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resumed *updateJournal
+
+	output := captureOutput(t, func() {
+		resumed, err = app.openUpdateJournal()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != "Resuming the interrupted update, 1 of 2 files were already hashed.\n" {
+		t.Errorf("the journal printed:\n%s", output)
+	}
+
+	shaSum, err = resumed.getFileShasum(app, "videos/intro.mp4", intro)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shaSum != getTestShasum("intro video, second version") {
+		t.Error("the intro was hashed again")
+	}
+
+	// a file that changed since it was hashed is hashed again
+	changed := intro
+	changed.size++
+
+	shaSum, err = resumed.getFileShasum(app, "videos/intro.mp4", changed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shaSum != getTestShasum("INTRO VIDEO, SECOND VERSION") {
+		t.Error("the changed intro wasn't hashed again")
+	}
+
+	err = resumed.close(true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileExists(app.getStateFolder() + "/update-journal") {
+		t.Error("the journal of the finished update wasn't deleted")
+	}
+}
+
+func TestUpdateJournalAfterCrash(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	app.addTrackedFile(trackedFile{file: writeTestFile(t, app, "videos/intro.mp4", "intro video, second version"), isPresent: true})
+
+	intro := app.trackedFiles["videos/intro.mp4"].file
+
+	journal, err := app.openUpdateJournal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the process is killed after the hash and before the GLFLite file is written, the journal isn't closed
+	shaSum, err := journal.getFileShasum(app, "videos/intro.mp4", intro)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		journal.writer.Close()
+	})
+
+	data, err := app.readJSONFile("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Sha256Sum != getTestShasum("intro video") {
+		t.Fatal("the GLFLite file was written before the crash")
+	}
+
+	// the content changes without changing the size and the date, the sum of the journal is used
+	writeTestFile(t, app, "videos/intro.mp4", "INTRO VIDEO, SECOND VERSION")
+
+	err = os.Chtimes(app.getFullPath("videos/intro.mp4"), intro.lastModified, intro.lastModified)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resumed *updateJournal
+
+	captureOutput(t, func() {
+		resumed, err = app.openUpdateJournal()
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(resumed.pending, ",") != "videos/intro.mp4" || !resumed.isHashed("videos/intro.mp4", intro) {
+		t.Fatalf("the resumed update has the pending files %v and the hashed files %v", resumed.pending, resumed.hashed)
+	}
+
+	resumedShasum, err := resumed.getFileShasum(app, "videos/intro.mp4", intro)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resumedShasum != shaSum {
+		t.Error("the file hashed before the crash was hashed again")
+	}
+
+	err = resumed.close(true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendTestFile(filePath string, content string) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(content)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func TestLoadShasums(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	file := app.trackedFiles["videos/intro.mp4"]
+	file.shasum = ""
+	app.trackedFiles["videos/intro.mp4"] = file
+
+	app.addTrackedFile(trackedFile{file: writeTestFile(t, app, "photos/cover.raw", "cover photo"), isPresent: true})
+
+	app.loadShasums()
+
+	if app.trackedFiles["videos/intro.mp4"].shasum != getTestShasum("intro video") || app.trackedFiles["photos/cover.raw"].shasum != "" {
+		t.Error("the Sha256 sums weren't loaded from the GLFLite files")
+	}
+}
+
+func TestJournalRecordsHashedFilesInIndex(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	file := writeTestFile(t, app, "videos/intro.mp4", "intro video")
+	app.trackedFiles["videos/intro.mp4"] = trackedFile{file: file, isPresent: true}
+	app.sortedTrackedFiles = []string{"videos/intro.mp4"}
+
+	var err error
+
+	app.index, err = app.openIndex()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the update was interrupted after it hashed the file
+	journal, err := app.openUpdateJournal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shaSum, err := journal.getFileShasum(app, "videos/intro.mp4", file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal.close(false)
+
+	// the local index wasn't saved, the resumed update takes the Sha256 sum from the journal
+	app.index, err = app.openIndex()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err = app.openUpdateJournal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer journal.close(true)
+
+	hashed := journal.hashed["videos/intro.mp4"].Hashed
+
+	if hashed.IsZero() || time.Since(hashed) > time.Minute {
+		t.Fatalf("the journal has the date of the hash %s", hashed)
+	}
+
+	if !journal.isHashed("videos/intro.mp4", file) {
+		t.Fatal("the journal doesn't have the Sha256 sum of the file")
+	}
+
+	cachedShasum, err := journal.getFileShasum(app, "videos/intro.mp4", file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, ok := app.index.entries["videos/intro.mp4"]
+
+	if cachedShasum != shaSum || !ok || entry.Sha256Sum != shaSum || !entry.Hashed.Equal(hashed) || entry.Size != file.size {
+		t.Errorf("the local index has %v for the file hashed by the interrupted update", entry)
+	}
+}
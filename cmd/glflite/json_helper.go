@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"time"
 )
@@ -17,6 +18,82 @@ type fileData struct {
 	Sha256Sum    string    `json:"sha256sum"`
 }
 
+type remoteConfig struct {
+	Name string `json:"-"`
+	URL  string `json:"url"`
+
+	// encryption of the objects, the key file is kept out of the repository
+	Encrypt bool   `json:"encrypt"`
+	KeyFile string `json:"key_file"`
+
+	// S3 remotes
+	Endpoint           string `json:"endpoint"`
+	Region             string `json:"region"`
+	Profile            string `json:"profile"`
+	StorageClass       string `json:"storage_class"`
+	MultipartThreshold int64  `json:"multipart_threshold_mb"`
+
+	// HTTP remotes, only read to refuse the tokens written in the setup file
+	Token string `json:"token"`
+}
+
+// sizeRule changes the size threshold of the files of a folder or a pattern,
+// or excludes them from the size check.
+type sizeRule struct {
+	Path      string `json:"path"`
+	Threshold int64  `json:"threshold_mb"`
+	Exclude   bool   `json:"exclude"`
+}
+
+type setupData struct {
+	DefaultRemote string                  `json:"default_remote"`
+	Remotes       map[string]remoteConfig `json:"remotes"`
+
+	// files stored compressed with zstd on the remotes, the level goes from 1 to 22
+	Compress         []string `json:"compress"`
+	CompressionLevel int      `json:"compression_level"`
+
+	// files bigger than the threshold that aren't tracked nor ignored by git are reported by check
+	SizeThreshold int64      `json:"size_threshold_mb"`
+	SizeRules     []sizeRule `json:"size_rules"`
+
+	// folders and files left out of the walk, like the rules of the .glfliteignore file
+	WalkExclude []string `json:"walk_exclude"`
+
+	// the folders ignored by git are left out of the walk unless this is set
+	WalkIgnoredFolders bool `json:"walk_ignored_folders"`
+
+	// the walk doesn't enter the file systems mounted inside the repository
+	OneFileSystem bool `json:"one_file_system"`
+
+	// the quick check hashes the files whose inode or change time changed since they were hashed on this clone
+	CheckInode bool `json:"check_inode"`
+}
+
+func readSetupFile(folder string) (setupData, error) {
+	var data setupData
+
+	setupFilePath := folder + "/" + setupFile
+
+	if !fileExists(setupFilePath) {
+		return data, nil
+	}
+
+	jsonData, err := ioutil.ReadFile(setupFilePath)
+
+	if err != nil {
+		return data, err
+	}
+
+	err = json.Unmarshal(jsonData, &data)
+
+	if err != nil {
+		return data, errors.New(fmt.Sprintf("Invalid setup file %s: %s", setupFilePath, err.Error()))
+	}
+
+	return data, nil
+}
+
 func (app *application) getFullPath(filePath string) string {
 	return app.config.rootFolder + "/" + filePath
 }
@@ -62,7 +139,7 @@ func (app *application) writeJSONFile(filePath string, data fileData) error {
 		return err
 	}
 
-	err = ioutil.WriteFile(app.getFullPath(glfFile), jsonData, 0644)
+	err = writeFileAtomic(app.getFullPath(glfFile), jsonData, 0644)
 
 	if err != nil {
 		return err
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const lockRetryInterval = 500 * time.Millisecond
+
+// lockOwner is the content of the lock file, it tells which process holds the
+// lock so that the lock of a process that died can be detected. The start of
+// the process tells if its PID was reused after a crash or a reboot.
+type lockOwner struct {
+	PID      int       `json:"pid"`
+	Started  string    `json:"started,omitempty"`
+	Hostname string    `json:"hostname"`
+	Action   string    `json:"action"`
+	Since    time.Time `json:"since"`
+}
+
+// repositoryLock is an advisory lock that keeps two glflite runs from writing
+// the same GLFLite files and lists, or the same objects of the local store, at
+// the same time.
+type repositoryLock struct {
+	file     string
+	released bool
+}
+
+func readLockOwner(lockFile string) (lockOwner, error) {
+	var owner lockOwner
+
+	content, err := os.ReadFile(lockFile)
+
+	if err != nil {
+		return owner, err
+	}
+
+	err = json.Unmarshal(content, &owner)
+
+	return owner, err
+}
+
+// isStaleLock tells if the process that holds a lock isn't running anymore,
+// or if its PID belongs to another process now. The processes of other hosts
+// can't be checked.
+func isStaleLock(owner lockOwner, hostname string) bool {
+	if owner.Hostname != hostname {
+		return false
+	}
+
+	process, err := os.FindProcess(owner.PID)
+
+	if err != nil {
+		return true
+	}
+
+	if errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone) {
+		return true
+	}
+
+	started := getProcessStart(owner.PID)
+
+	return owner.Started != "" && started != "" && started != owner.Started
+}
+
+// removeStaleLock deletes a stale lock. The lock is renamed before it is
+// deleted, so that a lock taken by another process in between is restored.
+func removeStaleLock(lockFile string, owner lockOwner) {
+	staleFile := fmt.Sprintf("%s.stale-%d", lockFile, os.Getpid())
+
+	if os.Rename(lockFile, staleFile) != nil {
+		return
+	}
+
+	current, err := readLockOwner(staleFile)
+
+	if err == nil && current != owner {
+		os.Rename(staleFile, lockFile)
+		return
+	}
+
+	os.Remove(staleFile)
+}
+
+// lockRepository takes the lock of the repository, with wait it waits until
+// the process that holds it finishes.
+func (app *application) lockRepository(action string, wait bool) (*repositoryLock, error) {
+	return app.takeLock(app.getStateFolder()+"/lock", "repository", action, wait)
+}
+
+// lockLocalStore takes the lock of the local store. The worktrees of a
+// repository share the local store but each one has its own repository lock,
+// so the actions that use the local store also lock it in the git directory
+// of the main repository.
+func (app *application) lockLocalStore(action string, wait bool) (*repositoryLock, error) {
+	return app.takeLock(app.config.commonDirectory+"/glflite/store.lock", "local store", action, wait)
+}
+
+// takeLock creates a lock file, the name tells what is locked in the errors.
+func (app *application) takeLock(lockFile string, name string, action string, wait bool) (*repositoryLock, error) {
+	err := os.MkdirAll(filepath.Dir(lockFile), 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	content, err := json.Marshal(lockOwner{PID: os.Getpid(), Started: getProcessStart(os.Getpid()), Hostname: hostname, Action: action, Since: time.Now()})
+
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := false
+
+	for {
+		file, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+		if err == nil {
+			_, err = file.Write(content)
+
+			if err == nil {
+				err = file.Close()
+			} else {
+				file.Close()
+			}
+
+			if err != nil {
+				os.Remove(lockFile)
+				return nil, err
+			}
+
+			return &repositoryLock{file: lockFile}, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		owner, err := readLockOwner(lockFile)
+
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		// a lock that can't be read may be being written, it is stale when it is old
+		if err != nil {
+			info, statErr := os.Stat(lockFile)
+
+			if statErr == nil && time.Since(info.ModTime()) > time.Minute {
+				removeStaleLock(lockFile, owner)
+				continue
+			}
+		} else if isStaleLock(owner, hostname) {
+			if app.verbose {
+				fmt.Printf("Removing the stale lock of the process %d\n", owner.PID)
+			}
+
+			removeStaleLock(lockFile, owner)
+			continue
+		}
+
+		if !wait {
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("The %s is locked by another glflite process, use the -wait flag to wait until it finishes. If no glflite process is running, delete the file %s", name, lockFile))
+			}
+
+			return nil, errors.New(fmt.Sprintf("The %s is locked by the %s action of the process %d on %s since %s, use the -wait flag to wait until it finishes. If that process isn't running anymore, delete the file %s", name, owner.Action, owner.PID, owner.Hostname, owner.Since.Format(time.DateTime), lockFile))
+		}
+
+		if !waiting && err == nil {
+			fmt.Printf("Waiting for the %s action of the process %d to finish...\n", owner.Action, owner.PID)
+		}
+
+		waiting = true
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *repositoryLock) release() {
+	if l.released {
+		return
+	}
+
+	l.released = true
+
+	os.Remove(l.file)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestLock(t *testing.T, app *application, owner lockOwner) {
+	t.Helper()
+
+	content, err := json.Marshal(owner)
+
+	if err == nil {
+		err = os.MkdirAll(app.getStateFolder(), 0755)
+	}
+
+	if err == nil {
+		err = os.WriteFile(app.getStateFolder()+"/lock", content, 0644)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockRepository(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	lock, err := app.lockRepository("update", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.lockRepository("push", false)
+
+	if err == nil || !strings.Contains(err.Error(), "locked by the update action of the process") {
+		t.Errorf("the repository was locked twice: %v", err)
+	}
+
+	lock.release()
+	lock.release()
+
+	// the lock is released when the other process finishes
+	lock, err = app.lockRepository("update", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(lockRetryInterval)
+		lock.release()
+	}()
+
+	var waitingLock *repositoryLock
+
+	output := captureOutput(t, func() {
+		waitingLock, err = app.lockRepository("push", true)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "Waiting for the update action of the process") {
+		t.Errorf("the lock printed:\n%s", output)
+	}
+
+	waitingLock.release()
+}
+
+func TestStaleLock(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	// the process of the lock finished without releasing it
+	cmd := exec.Command("true")
+
+	err := cmd.Run()
+
+	if err != nil {
+		t.Skip("the process of the test lock can't run: " + err.Error())
+	}
+
+	hostname, _ := os.Hostname()
+
+	writeTestLock(t, app, lockOwner{PID: cmd.Process.Pid, Hostname: hostname, Action: "update", Since: time.Now()})
+
+	lock, err := app.lockRepository("push", false)
+
+	if err != nil {
+		t.Fatalf("the stale lock wasn't removed: %v", err)
+	}
+
+	lock.release()
+
+	// the processes of other hosts can't be checked
+	writeTestLock(t, app, lockOwner{PID: cmd.Process.Pid, Hostname: hostname + "-other", Action: "update", Since: time.Now()})
+
+	_, err = app.lockRepository("push", false)
+
+	if err == nil {
+		t.Error("the lock of another host was removed")
+	}
+
+	// a lock that can't be read is stale only when it is old
+	err = os.WriteFile(app.getStateFolder()+"/lock", []byte("{"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.lockRepository("push", false)
+
+	if err == nil || !strings.Contains(err.Error(), "locked by another glflite process") {
+		t.Errorf("a new lock that can't be read was removed: %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Minute)
+
+	err = os.Chtimes(app.getStateFolder()+"/lock", old, old)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err = app.lockRepository("push", false)
+
+	if err != nil {
+		t.Fatalf("the old lock that can't be read wasn't removed: %v", err)
+	}
+
+	lock.release()
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	folder := t.TempDir()
+	filePath := folder + "/sha256_list_glflite"
+
+	for _, content := range []string{"first version\n", "second\n"} {
+		err := writeFileAtomic(filePath, []byte(content), 0600)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		written, err := os.ReadFile(filePath)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(written) != content {
+			t.Errorf("the file contains %q, expected %q", written, content)
+		}
+	}
+
+	info, err := os.Stat(filePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the permissions of the file are %s", info.Mode().Perm())
+	}
+
+	// the temporary files are removed, also when the rename fails
+	err = writeFileAtomic(folder+"/missing/file", []byte("content"), 0644)
+
+	if err == nil {
+		t.Error("a file was written in a missing folder")
+	}
+
+	err = os.Mkdir(folder+"/folder", 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFileAtomic(folder+"/folder", []byte("content"), 0644)
+
+	if err == nil {
+		t.Error("a folder was replaced")
+	}
+
+	files, err := filepath.Glob(folder + "/.*.tmp-*")
+
+	if err != nil || len(files) != 0 {
+		t.Errorf("the temporary files %v are left", files)
+	}
+}
+
+func TestStaleLockWithReusedPID(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	hostname, _ := os.Hostname()
+
+	started := getProcessStart(os.Getpid())
+
+	if started == "" {
+		t.Skip("the start of the processes can't be read on this system")
+	}
+
+	running := lockOwner{PID: os.Getpid(), Started: started, Hostname: hostname, Action: "update", Since: time.Now()}
+
+	if isStaleLock(running, hostname) {
+		t.Error("the lock of a running process is stale")
+	}
+
+	// the process that took the lock died and its PID was given to this process
+	reused := running
+	reused.Started = "another start"
+
+	if !isStaleLock(reused, hostname) {
+		t.Error("the lock of a process whose PID was reused isn't stale")
+	}
+
+	// the locks of the older versions don't have the start of the process
+	reused.Started = ""
+
+	if isStaleLock(reused, hostname) {
+		t.Error("the lock without the start of the process is stale")
+	}
+
+	reused.Started = "another start"
+
+	writeTestLock(t, app, reused)
+
+	lock, err := app.lockRepository("check", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := readLockOwner(app.getStateFolder() + "/lock")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner.Started != started || owner.Action != "check" {
+		t.Errorf("the lock belongs to %v", owner)
+	}
+
+	lock.release()
+}
+
+func TestLockLocalStoreOfWorktrees(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	// a worktree has its own git directory, the common directory is the one of the main repository
+	worktree := *app
+	worktree.config.gitDirectory = app.config.commonDirectory + "/worktrees/feature"
+
+	lock, err := app.lockRepository("gc", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer lock.release()
+
+	worktreeLock, err := worktree.lockRepository("push", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer worktreeLock.release()
+
+	storeLock, err := app.lockLocalStore("gc", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = worktree.lockLocalStore("push", false)
+
+	if err == nil {
+		t.Fatal("the worktree locked the local store that the main repository holds")
+	}
+
+	storeLock.release()
+
+	worktreeStoreLock, err := worktree.lockLocalStore("push", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worktreeStoreLock.release()
+}
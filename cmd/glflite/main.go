@@ -1,14 +1,13 @@
 package main
 
 import (
-	"bufio"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,12 +19,18 @@ const (
 	setupFile          = ".glflite"
 	fileExtension      = "glflite"
 	gitIgnoreSeparator = "#GitLFSLite"
+	gitIgnoreEndMarker = "#EndGitLFSLite"
 )
 
 type config struct {
-	rootFolder string
-	fileRules  []string
-	instance   struct {
+	rootFolder      string
+	gitDirectory    string
+	commonDirectory string
+	currentFolder   string
+	submoduleFolder string
+	fileRules       []string
+	setup           setupData
+	instance        struct {
 		hostname string
 		path     string
 		ID       string
@@ -37,6 +42,8 @@ type fileInformation struct {
 	isDirectory  bool
 	lastModified time.Time
 	size         int64
+	changed      time.Time
+	inode        uint64
 }
 
 type trackedFile struct {
@@ -49,92 +56,175 @@ type trackedFile struct {
 type application struct {
 	config              config
 	trackedFiles        map[string]trackedFile
+	files               []fileInformation
 	sortedTrackedFiles  []string
 	duplicatedFiles     map[string][]string
 	duplicatedTotalSize int64
+	verbose             bool
+	progress            *progressReporter
+	index               *localIndex
+	scope               []scopePattern
 }
 
 func main() {
 
-	var action string
 	var force bool
 	var quiet bool
 	var filePath string
+	var remoteName string
+	var listenAddress string
+	var token string
+	var store string
+	var allowPut bool
+	var commits int
+	var since string
+	var graceDays int
+	var dryRun bool
+	var difftool bool
+	var removeRule bool
+	var trackLarge bool
+	var installHook bool
+	var wait bool
+	var progressMode string
+	var changeFolder string
+	var recursive bool
 
 	verbose := true
 
-	if len(os.Args) == 2 {
-		if os.Args[1] == "check" || os.Args[1] == "update" {
-			action = os.Args[1]
-		} else {
-			action = "help"
+	// the flags of all the commands, each command only accepts some of them
+	allFlags := flag.NewFlagSet("glflite", flag.ContinueOnError)
+
+	allFlags.BoolVar(&force, "force", false, "Force the action to be performed. The check action checks the Sha256 sum of the files instead of the last modified date and the size, with -remote it downloads the files to verify them. The checkout action replaces a modified file.")
+	allFlags.BoolVar(&quiet, "quiet", false, "Prints only the summary of the files.")
+	allFlags.StringVar(&filePath, "file", "", "File selected by the command. It can be a file, a folder or a pattern like the rules of the .gitignore file, the files can also be given as arguments.")
+	allFlags.StringVar(&remoteName, "remote", "", "Remote to push the files to, pull the files from or check. It can be the name of a remote in the .glflite file or a URL like sftp://user@host/path, s3://bucket/prefix or /path/to/folder. Without this flag, the default_remote of the .glflite file is used.")
+	allFlags.StringVar(&listenAddress, "listen", "127.0.0.1:8080", "Address where the serve action listens. It only accepts the connections of this machine by default, use :8080 to share the files with the other machines of the LAN.")
+	allFlags.StringVar(&token, "token", "", "Token that the clients of the serve action have to send. The GLFLITE_TOKEN environment variable or the glflite.token git config key is used when it is empty.")
+	allFlags.StringVar(&store, "store", "", "Folder with the objects pushed to a folder remote that the serve action shares instead of the files of the repository.")
+	allFlags.BoolVar(&allowPut, "allow-put", false, "Allows the clients of the serve action to upload files. The Sha256 sum of the files is verified.")
+	allFlags.IntVar(&commits, "commits", 0, "Number of commits walked by the gc action to find the referenced files, all the commits of all the refs by default.")
+	allFlags.StringVar(&since, "since", "", "Date of the oldest commit walked by the gc action to find the referenced files, like 2024-01-31 or \"6 months ago\".")
+	allFlags.IntVar(&graceDays, "grace-days", 14, "Days during which the gc action keeps the unreferenced objects.")
+	allFlags.BoolVar(&dryRun, "dry-run", false, "Lists the changes without doing them.")
+	allFlags.BoolVar(&removeRule, "remove-rule", false, "Removes the rule of the .gitignore file equal to the pattern given to the untrack action, so that the update action doesn't track the files again.")
+	allFlags.BoolVar(&trackLarge, "track-large", false, "Adds a rule to the #GitLFSLite section of the .gitignore file for each file bigger than the size_threshold_mb of the .glflite file that git would pick up, and tracks it.")
+	allFlags.BoolVar(&installHook, "install-hook", false, "Installs the guard action as the pre-commit hook of the repository.")
+	allFlags.BoolVar(&wait, "wait", false, "Waits until the other glflite process that locks the repository finishes instead of failing.")
+	allFlags.StringVar(&progressMode, "progress", progressAuto, "Shows the progress of the files hashed on the standard error. auto shows a progress line in a terminal and a log line every 10 seconds otherwise, json prints JSON events, one per line. Possible values: auto, tty, log, json, none.")
+	allFlags.BoolVar(&recursive, "recursive", false, "Checks or updates the files of the initialized submodules too, with their own rules and GLFLite files. The submodules are skipped by default.")
+	allFlags.StringVar(&changeFolder, "C", "", "Runs as if glflite was started in this folder instead of the current folder.")
+	allFlags.BoolVar(&difftool, "difftool", false, "Prints the change of a GLFLite file instead of its JSON, for git difftool -x \"glflite diff -difftool\" or GIT_EXTERNAL_DIFF=\"glflite diff -difftool\".")
+
+	// the command is the first argument, the flags can be placed before or after the arguments: glflite log path/to/file -quiet
+	cmd, args, err := parseCommandLine(allFlags, os.Args[1:])
+
+	if err != nil {
+		printError(err.Error())
+	}
+
+	action := cmd.name
+
+	if quiet {
+		verbose = false
+	}
+
+	if action == "help" {
+		err = printHelp(allFlags, args)
+
+		if err != nil {
+			printError(err.Error())
 		}
-	} else {
-		flag.StringVar(&action, "action", "help", "Action to perform. Possible values: check, update, help.")
-		flag.BoolVar(&force, "force", false, "Force the action to be performed, it checks the files completely to confirm if they are up to date.")
-		flag.BoolVar(&quiet, "quiet", false, "Prints only the summary of the files.")
-		flag.StringVar(&filePath, "file", "", "File to check or update. It can be a file or a folder.")
 
-		flag.Parse()
+		os.Exit(0)
+	}
+
+	if action == "completion" {
+		err = printCompletion(allFlags, args)
 
-		if quiet {
-			verbose = false
+		if err != nil {
+			printError(err.Error())
 		}
+
+		os.Exit(0)
 	}
 
-	if action != "check" && action != "update" && action != "help" {
-		printError("Invalid action. Possible values: check, update, help.")
+	progressMode, err = getProgressMode(progressMode, quiet)
+
+	if err != nil {
+		printError(err.Error())
 	}
 
-	if action == "help" {
-		fmt.Println("GitLFSLite is a tool to help you manage your large files in your git repository. It adds a JSON file to your repository with the information of each file so that you can check if the files are up to date. It also  helps you to keep a remote copy of the files using rsync.")
-		fmt.Println("GitLFSLite version " + version)
-		fmt.Println("Usage: glflite [options]")
-		fmt.Println("Options:")
-		fmt.Println("  -action string")
-		fmt.Println("    	Action to perform. Possible values: check, update, help. (default \"help\")")
-		fmt.Println("    	Actions:")
-		fmt.Println("  		check")
-		fmt.Println("    		Checks if the files are up to date.")
-		fmt.Println("  		update")
-		fmt.Println("    		Creates the JSON file with the information of the new files and updates the information of the existing files.")
-		fmt.Println("  -file string")
-		fmt.Println("    	File to check or update. It can be a file or a folder.")
-		fmt.Println("  -force")
-		fmt.Println("    	Force the action to be performed, it checks the Sha256 sum of the files to confirm if they are up to date. Whitoout this flag, it only checks the last modified date.")
-		fmt.Println("  -quiet")
-		fmt.Println("    	Prints only the summary of the files.")
-		fmt.Println("To sync the files, use the rsync command with the list of files in the rsync_list_glflite file.")
-		fmt.Println("Example:")
-		fmt.Println("   rsync -v -t --ignore-missing-args --files-from=rsync_list_glflite . [destination]")
+	// git runs the difftool mode for each file, it doesn't need to find the tracked files
+	if action == "diff" && difftool {
+		err := printDifftool(args)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
 		os.Exit(0)
 	}
 
 	var cfg config
 
+	if changeFolder != "" {
+		err = os.Chdir(changeFolder)
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
 	// Check if folder belongs to a git repository
-	gitFolder, err := findGitFolder()
+	repository, err := findRepository(getCurrentFolder())
 
 	if err != nil {
 		printError(err.Error())
 	}
 
-	// check if the folder has a .gitignore file, ask the user if they want to create one if it doesn't
-	if !hasGitIgnoreFile(gitFolder) {
-		reader := bufio.NewReader(os.Stdin)
+	gitFolder := repository.rootFolder
+
+	cfg.gitDirectory = repository.gitDirectory
+	cfg.commonDirectory = repository.commonDirectory
+
+	// the paths given on the command line and printed are relative to the current folder
+	cfg.currentFolder = repository.currentFolder
+
+	// the paths of the tracked files are relative to the root folder
+	err = os.Chdir(gitFolder)
+
+	if err != nil {
+		printError(err.Error())
+	}
 
-		fmt.Print("The folder doesn't have a .gitignore file. Do you want to create a .gitignore file? (yes/no): ")
-		response, _ := reader.ReadString('\n')
+	// a relative GIT_DIR or GIT_WORK_TREE would point somewhere else from the root folder
+	if os.Getenv("GIT_DIR") != "" {
+		os.Setenv("GIT_DIR", cfg.gitDirectory)
+	}
 
-		response = strings.TrimSpace(strings.ToLower(response))
+	if os.Getenv("GIT_WORK_TREE") != "" {
+		os.Setenv("GIT_WORK_TREE", gitFolder)
+	}
 
-		if response == "yes" || response == "y" {
+	// check if the folder has a .gitignore file, ask the user if they want to create one if it doesn't
+	if !hasGitIgnoreFile(gitFolder) && action != "guard" {
+		if askConfirmation("The folder doesn't have a .gitignore file. Do you want to create a .gitignore file?") {
 			createGitIgnoreFile(gitFolder)
 		}
 	}
 
-	// Get the content of the .gitignore file
-	fileRules, err := getGitIgnoreContent(gitFolder)
+	var fileRules []string
+
+	// Get the content of the .gitignore file, the pre-commit hook doesn't block the commits of the repositories without one
+	if action != "guard" || hasGitIgnoreFile(gitFolder) {
+		fileRules, err = getGitIgnoreContent(gitFolder)
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
+	setup, err := readSetupFile(gitFolder)
 
 	if err != nil {
 		printError(err.Error())
@@ -142,67 +232,134 @@ func main() {
 
 	cfg.rootFolder = gitFolder
 	cfg.fileRules = fileRules
+	cfg.setup = setup
 
 	app := &application{
 		config:          cfg,
 		trackedFiles:    make(map[string]trackedFile),
 		duplicatedFiles: make(map[string][]string),
+		verbose:         verbose,
+	}
+
+	// the actions that write files lock the repository, so that two runs don't write the same files
+	if action != "log" && action != "diff" && action != "serve" && action != "keygen" && action != "guard" {
+		lock, err := app.lockRepository(action, wait)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		defer lock.release()
+
+		addCleanupFunction(lock.release)
+	}
+
+	// the worktrees share the local store, gc in one of them can't delete the objects that another one pushes or pulls
+	usesLocalStore := action == "push" || action == "pull" || action == "gc" || action == "checkout" || (action == "check" && remoteName != "")
+
+	if usesLocalStore {
+		lock, err := app.lockLocalStore(action, wait)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		defer lock.release()
+
+		addCleanupFunction(lock.release)
+	}
+
+	// the update action finishes the current file on the first Ctrl-C, so it can be resumed
+	handleInterrupts(action == "update")
+
+	// the guard action runs in the pre-commit hook, it only looks at the staged files and doesn't walk the folders
+	if action == "guard" {
+		if installHook {
+			err = app.installGuardHook()
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			exit(0)
+		}
+
+		canCommit, err := app.guardCommit()
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		if !canCommit {
+			exit(1)
+		}
+
+		exit(0)
 	}
 
 	// TODO Add instance information to find out if a files is backed up on another instance easily
 
-	// Find all files and folders in the root folder
-	files, err := findAllFilesAndFolders(cfg.rootFolder)
+	// the commands that process the tracked files can be limited to some files, folders or patterns
+	if action == "check" || action == "update" || action == "push" || action == "pull" || action == "fix-mtimes" {
+		app.scope, err = app.getScope(append([]string{filePath}, args...))
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
+	// the size check and the track actions look at the files that aren't tracked too
+	allFiles := action == "track" || (action == "update" && trackLarge)
+
+	// find the files and the tracked files of the root folder
+	err = app.findTrackedFiles(allFiles || (action == "check" && app.hasSizeRules()))
 
 	if err != nil {
 		printError(err.Error())
 	}
 
-	// find all the present tracked files
-	for _, file := range files {
-		// Check if the file is excluded by the .gitignore file after the #GitLFSLite separator
-		if isFileExcluded(cfg.fileRules, file.path, file.isDirectory) {
-			app.trackedFiles[file.path] = trackedFile{
-				file:       file,
-				isPresent:  true,
-				isUpToDate: false,
-			}
+	// the submodules are checked or updated after the repository, with their own rules and GLFLite files
+	applications := []*application{app}
+
+	if recursive {
+		submodules, err := app.openSubmodules()
+
+		if err != nil {
+			printError(err.Error())
 		}
-	}
 
-	// find all the glflite files
-	for _, file := range files {
-		if isGLFLiteFile(file.path) {
-			trackedFileName := getTrackedFilePath(file.path)
+		for _, submodule := range submodules {
+			lock, err := submodule.lockRepository(action, wait)
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			defer lock.release()
+
+			addCleanupFunction(lock.release)
 
-			if _, ok := app.trackedFiles[trackedFileName]; !ok {
-				trackedFileData, err := app.readJSONFile(trackedFileName)
+			if usesLocalStore {
+				storeLock, err := submodule.lockLocalStore(action, wait)
 
 				if err != nil {
 					printError(err.Error())
 				}
 
-				app.trackedFiles[trackedFileName] = trackedFile{
-					file: fileInformation{
-						path:         trackedFileName,
-						isDirectory:  false,
-						lastModified: trackedFileData.LastModified,
-						size:         trackedFileData.Size,
-					},
-					isPresent:  false,
-					isUpToDate: false,
-				}
+				defer storeLock.release()
+
+				addCleanupFunction(storeLock.release)
 			}
-		}
-	}
 
-	app.sortedTrackedFiles = make([]string, 0, len(app.trackedFiles))
+			err = submodule.findTrackedFiles(allFiles || (action == "check" && submodule.hasSizeRules()))
 
-	for file := range app.trackedFiles {
-		app.sortedTrackedFiles = append(app.sortedTrackedFiles, file)
-	}
+			if err != nil {
+				printError(err.Error())
+			}
+		}
 
-	sort.Strings(app.sortedTrackedFiles)
+		applications = append(applications, submodules...)
+	}
 
 	if action == "check" {
 		filesMissing := 0
@@ -210,132 +367,210 @@ func main() {
 		filesNotUpToDate := 0
 		ignoredLinks := 0
 
-		for _, fileFullPath := range app.sortedTrackedFiles {
-			file := app.trackedFiles[fileFullPath]
-
-			fileData, err := app.readJSONFile(fileFullPath)
+		filesWithDuplicates := 0
+		var duplicatedTotalSize int64
 
-			if errors.Is(err, ErrGLFLiteFileNotFound) {
-				if !isLink(fileFullPath) && verbose {
-					fmt.Printf("File %s is missing the GLFLite file.\n", fileFullPath)
-				}
+		// each repository is checked with its own rules, the counts are added up
+		for _, app := range applications {
+			err = os.Chdir(app.config.rootFolder)
 
-			} else if err != nil {
+			if err != nil {
 				printError(err.Error())
-			} else if err == nil {
+			}
 
-				// Update the Sha256 sum of the file
-				trackedFileData := app.trackedFiles[fileFullPath]
-				trackedFileData.shasum = fileData.Sha256Sum
-				app.trackedFiles[fileFullPath] = trackedFileData
+			if app.config.submoduleFolder != "" && verbose {
+				fmt.Printf("Submodule %s:\n", app.getDisplayPath(""))
+			}
+
+			app.index, err = app.openIndex()
+
+			if err != nil {
+				printError(err.Error())
 			}
 
-			if !file.isPresent {
-				if verbose {
-					fmt.Printf("%s: ", file.file.path)
-					printRed("Missing")
+			if force {
+				filesTotal := 0
+				var bytesTotal int64
+
+				for _, fileFullPath := range app.sortedTrackedFiles {
+					file := app.trackedFiles[fileFullPath]
+
+					if file.isPresent && !isLink(fileFullPath) {
+						filesTotal++
+						bytesTotal += file.file.size
+					}
 				}
-				filesMissing++
-			} else {
 
-				if isLink(fileFullPath) {
-					if verbose {
-						fmt.Printf("Ignoring link file %s\n", fileFullPath)
+				app.progress = startProgress(progressMode, action, filesTotal, bytesTotal)
+
+				addCleanupFunction(app.progress.stop)
+			}
+
+			for _, fileFullPath := range app.sortedTrackedFiles {
+				file := app.trackedFiles[fileFullPath]
+
+				fileData, err := app.readJSONFile(fileFullPath)
+
+				if errors.Is(err, ErrGLFLiteFileNotFound) {
+					if !isLink(fileFullPath) && verbose {
+						fmt.Printf("File %s is missing the GLFLite file.\n", app.getDisplayPath(fileFullPath))
 					}
 
-					ignoredLinks++
-				} else {
-					if force {
-						shaSum, err := app.getFileShasum(fileFullPath)
+				} else if err != nil {
+					printError(err.Error())
+				} else if err == nil {
 
-						if err != nil {
-							printError(err.Error())
-						}
+					// Update the Sha256 sum of the file
+					trackedFileData := app.trackedFiles[fileFullPath]
+					trackedFileData.shasum = fileData.Sha256Sum
+					app.trackedFiles[fileFullPath] = trackedFileData
+				}
 
-						if shaSum == fileData.Sha256Sum {
-							file.isUpToDate = true
-						} else {
-							file.isUpToDate = false
-						}
+				if !file.isPresent {
+					if verbose {
+						fmt.Printf("%s: ", app.getDisplayPath(file.file.path))
+						printRed("Missing")
+					}
+					filesMissing++
+				} else {
 
+					if isLink(fileFullPath) {
 						if verbose {
-							fmt.Printf("File %s is up to date because the Sha256 sum is the same: %s\n", fileFullPath, shaSum)
+							fmt.Printf("Ignoring link file %s\n", app.getDisplayPath(fileFullPath))
 						}
+
+						ignoredLinks++
 					} else {
-						if fileData.LastModified.Unix() == file.file.lastModified.Unix() && fileData.Size == file.file.size {
+						if force {
+							shaSum, err := app.getFileShasum(fileFullPath)
 
-							if verbose {
-								fmt.Printf("File %s is up to date because the last modified date and the size are the same.\n", fileFullPath)
+							if err != nil {
+								printError(err.Error())
+							}
+
+							if shaSum == fileData.Sha256Sum {
+								file.isUpToDate = true
+							} else {
+								file.isUpToDate = false
 							}
 
-							file.isUpToDate = true
-						} else {
 							if verbose {
-								if fileData.LastModified.Unix() != file.file.lastModified.Unix() {
-									fmt.Printf("File %s is not up to date because the last modified date is different. %s != %s\n", fileFullPath, fileData.LastModified, file.file.lastModified)
+								fmt.Printf("File %s is up to date because the Sha256 sum is the same: %s\n", app.getDisplayPath(fileFullPath), shaSum)
+							}
+						} else {
+							status := app.getQuickStatus(fileFullPath, file.file, fileData)
+
+							if status == quickUnchanged {
+
+								if verbose {
+									fmt.Printf("File %s is up to date because the last modified date and the size are the same.\n", app.getDisplayPath(fileFullPath))
 								}
 
-								if fileData.Size != file.file.size {
-									fmt.Printf("File %s is not up to date because the size is different. %d != %d\n", fileFullPath, fileData.Size, file.file.size)
+								file.isUpToDate = true
+							} else if status == quickTouched {
+								if verbose {
+									fmt.Printf("File %s is up to date, only its last modified date changed. Run glflite fix-mtimes to restore it.\n", app.getDisplayPath(fileFullPath))
 								}
-							}
 
-							file.isUpToDate = false
-						}
-					}
+								file.isUpToDate = true
+							} else if status == quickRacy {
+								// the last modified date can't be trusted, the file is hashed
+								shaSum, err := app.getFileShasum(fileFullPath)
 
-					if file.isUpToDate {
-						if verbose {
-							fmt.Printf("%s: ", file.file.path)
-							printGreen("Up to date")
+								if err != nil {
+									printError(err.Error())
+								}
+
+								file.isUpToDate = shaSum == fileData.Sha256Sum
+
+								if verbose {
+									fmt.Printf("File %s was hashed because it was modified close to the date of its GLFLite file or it was replaced.\n", app.getDisplayPath(fileFullPath))
+								}
+							} else {
+								if verbose {
+									if !isSameModificationTime(fileData.LastModified, file.file.lastModified) {
+										fmt.Printf("File %s is not up to date because the last modified date is different. %s != %s\n", app.getDisplayPath(fileFullPath), fileData.LastModified, file.file.lastModified)
+									}
+
+									if fileData.Size != file.file.size {
+										fmt.Printf("File %s is not up to date because the size is different. %d != %d\n", app.getDisplayPath(fileFullPath), fileData.Size, file.file.size)
+									}
+								}
+
+								file.isUpToDate = false
+							}
 						}
-						filesUpToDate++
-					} else {
-						if verbose {
-							fmt.Printf("%s: ", file.file.path)
-							printRed("Not up to date")
+
+						if file.isUpToDate {
+							if verbose {
+								fmt.Printf("%s: ", app.getDisplayPath(file.file.path))
+								printGreen("Up to date")
+							}
+							filesUpToDate++
+						} else {
+							if verbose {
+								fmt.Printf("%s: ", app.getDisplayPath(file.file.path))
+								printRed("Not up to date")
+							}
+							filesNotUpToDate++
 						}
-						filesNotUpToDate++
 					}
 				}
 			}
-		}
 
-		err = app.generateRsyncFileList(true)
+			app.progress.stop()
 
-		if err != nil {
-			printError(err.Error())
-		}
+			err = app.saveIndex()
 
-		err = app.generateRsyncFileList(false)
+			if err != nil {
+				printError(err.Error())
+			}
 
-		if err != nil {
-			printError(err.Error())
-		}
+			err = app.generateRsyncFileList(true)
 
-		err = app.generateSha256FileList()
+			if err != nil {
+				printError(err.Error())
+			}
 
-		if err != nil {
-			printError(err.Error())
-		}
+			err = app.generateRsyncFileList(false)
 
-		if verbose {
-			fmt.Println()
-		}
+			if err != nil {
+				printError(err.Error())
+			}
 
-		if app.duplicatedFiles != nil && verbose {
-			for shaSum, files := range app.duplicatedFiles {
-				printRed("  " + shaSum + ":")
-				for i, file := range files {
-					fmt.Printf("     %s\n", file)
+			err = app.generateSha256FileList()
 
-					if i > 0 {
-						fmt.Printf("Command to remove duplicates: mv -i \"%s\" ~/duplicatedFiles && ln -s \"%s\" \"%s.glflitelink\"\n", file, files[0], file)
-					}
+			if err != nil {
+				printError(err.Error())
+			}
+
+			if verbose {
+				fmt.Println()
+			}
+
+			if app.duplicatedFiles != nil && verbose {
+				for shaSum, files := range app.duplicatedFiles {
+					printRed("  " + shaSum + ":")
+					for i, file := range files {
+						fmt.Printf("     %s\n", file)
+
+						if i > 0 {
+							fmt.Printf("Command to remove duplicates: mv -i \"%s\" ~/duplicatedFiles && ln -s \"%s\" \"%s.glflitelink\"\n", file, files[0], file)
+						}
 
+					}
 				}
+				fmt.Println()
 			}
-			fmt.Println()
+
+			filesWithDuplicates += len(app.duplicatedFiles)
+			duplicatedTotalSize += app.duplicatedTotalSize
+		}
+
+		err = os.Chdir(gitFolder)
+
+		if err != nil {
+			printError(err.Error())
 		}
 
 		fmt.Printf("Files missing: ")
@@ -350,22 +585,65 @@ func main() {
 		fmt.Printf("Ignored links: ")
 		printGreen(strconv.Itoa(ignoredLinks))
 
-		if app.duplicatedTotalSize > 0 {
-			printRed("Files with duplicates:" + strconv.Itoa(len(app.duplicatedFiles)))
+		if duplicatedTotalSize > 0 {
+			printRed("Files with duplicates:" + strconv.Itoa(filesWithDuplicates))
 
 			var humanSize int64
 
-			if app.duplicatedTotalSize > 1024*1024*1024 {
-				humanSize = app.duplicatedTotalSize / (1024 * 1024 * 1024)
+			if duplicatedTotalSize > 1024*1024*1024 {
+				humanSize = duplicatedTotalSize / (1024 * 1024 * 1024)
 				printRed(fmt.Sprintf("Total size of duplicated files: %d GB\n", humanSize))
-			} else if app.duplicatedTotalSize > 1024*1024 {
-				humanSize = app.duplicatedTotalSize / (1024 * 1024)
+			} else if duplicatedTotalSize > 1024*1024 {
+				humanSize = duplicatedTotalSize / (1024 * 1024)
 				printRed(fmt.Sprintf("Total size of duplicated files: %d MB\n", humanSize))
-			} else if app.duplicatedTotalSize > 1024 {
-				humanSize = app.duplicatedTotalSize / 1024
+			} else if duplicatedTotalSize > 1024 {
+				humanSize = duplicatedTotalSize / 1024
 				printRed(fmt.Sprintf("Total size of duplicated files: %d KB\n", humanSize))
 			} else {
-				printRed(fmt.Sprintf("Total size of duplicated files: %d B\n", app.duplicatedTotalSize))
+				printRed(fmt.Sprintf("Total size of duplicated files: %d B\n", duplicatedTotalSize))
+			}
+		}
+
+		for _, app := range applications {
+			if !app.hasSizeRules() && remoteName == "" {
+				continue
+			}
+
+			err = os.Chdir(app.config.rootFolder)
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			if app.config.submoduleFolder != "" {
+				fmt.Println()
+				fmt.Printf("Submodule %s:\n", app.getDisplayPath(""))
+			}
+
+			if app.hasSizeRules() {
+				err = app.printLargeFiles(app.files)
+
+				if err != nil {
+					printError(err.Error())
+				}
+			}
+
+			if remoteName != "" {
+				r, err := app.openRemote(remoteName)
+
+				if err != nil {
+					printError(err.Error())
+				}
+
+				fmt.Println()
+
+				err = app.checkRemote(r, force)
+
+				r.close()
+
+				if err != nil {
+					printError(err.Error())
+				}
 			}
 		}
 
@@ -377,95 +655,376 @@ func main() {
 	}
 
 	if action == "update" {
-		for _, fileFullPath := range app.sortedTrackedFiles {
-			file := app.trackedFiles[fileFullPath]
-
-			if fileFullPath != file.file.path {
-				printError("The file path is different from the file name.")
+		// each repository is updated with its own rules and journal
+		for _, app := range applications {
+			if interrupted.Load() {
+				break
 			}
 
-			if file.isPresent {
-				data, err := app.readJSONFile(fileFullPath)
+			err = os.Chdir(app.config.rootFolder)
 
-				if errors.Is(err, ErrGLFLiteFileNotFound) {
+			if err != nil {
+				printError(err.Error())
+			}
 
-					if isLink(fileFullPath) {
-						if verbose {
-							fmt.Println("Ignoring link file " + fileFullPath)
-						}
-					} else {
-						if verbose {
-							fmt.Println("Creating GLFLite file for " + fileFullPath)
-						}
+			if app.config.submoduleFolder != "" && verbose {
+				fmt.Println()
+				fmt.Printf("Submodule %s:\n", app.getDisplayPath(""))
+			}
 
-						shasum, err := app.getFileShasum(fileFullPath)
+			app.index, err = app.openIndex()
 
-						if err != nil {
-							printError(err.Error())
-						}
+			if err != nil {
+				printError(err.Error())
+			}
 
-						data = fileData{
-							FilePath:     fileFullPath,
-							TrackedSince: time.Now(),
-							LastModified: file.file.lastModified,
-							Size:         file.file.size,
-							Sha256Sum:    shasum,
-						}
+			if trackLarge {
+				err = app.trackLargeFiles(app.files)
 
-						newTrackedFile := trackedFile{
-							file:       file.file,
-							isPresent:  true,
-							isUpToDate: true,
-							shasum:     shasum,
-						}
+				if err != nil {
+					printError(err.Error())
+				}
+			}
 
-						app.trackedFiles[fileFullPath] = newTrackedFile
+			// the moved files keep their GLFLite file instead of being tracked again
+			_, err = app.detectMovedFiles()
 
-						err = app.writeJSONFile(fileFullPath, data)
+			if err != nil {
+				printError(err.Error())
+			}
 
-						if err != nil {
-							printError(err.Error())
-						}
-					}
+			journal, err := app.openUpdateJournal()
 
-				} else if err != nil {
-					printError(err.Error())
-				} else if err == nil {
-					// Update the Sha256 sum of the file
-					trackedFileData := app.trackedFiles[fileFullPath]
-					trackedFileData.shasum = data.Sha256Sum
-					app.trackedFiles[fileFullPath] = trackedFileData
+			if err != nil {
+				printError(err.Error())
+			}
 
-					if data.LastModified.Unix() == file.file.lastModified.Unix() && data.Size == file.file.size {
-						if verbose {
-							fmt.Println("File " + fileFullPath + " is up to date.")
-						}
-					} else {
-						if verbose {
-							fmt.Println("Updating GLFLite file for " + fileFullPath)
-						}
+			filesTotal := 0
+			var bytesTotal int64
+
+			for _, fileFullPath := range journal.pending {
+				file := app.trackedFiles[fileFullPath]
+
+				if !journal.isHashed(fileFullPath, file.file) {
+					filesTotal++
+					bytesTotal += file.file.size
+				}
+			}
+
+			app.progress = startProgress(progressMode, action, filesTotal, bytesTotal)
+
+			addCleanupFunction(app.progress.stop)
+
+			for _, fileFullPath := range app.sortedTrackedFiles {
+				if interrupted.Load() {
+					break
+				}
+
+				file := app.trackedFiles[fileFullPath]
+
+				if fileFullPath != file.file.path {
+					printError("The file path is different from the file name.")
+				}
+
+				if file.isPresent {
+					data, err := app.readJSONFile(fileFullPath)
+
+					if errors.Is(err, ErrGLFLiteFileNotFound) {
+
+						if isLink(fileFullPath) {
+							if verbose {
+								fmt.Println("Ignoring link file " + app.getDisplayPath(fileFullPath))
+							}
+						} else {
+							if verbose {
+								fmt.Println("Creating GLFLite file for " + app.getDisplayPath(fileFullPath))
+							}
 
-						data.LastModified = file.file.lastModified
-						data.Size = file.file.size
+							shasum, err := journal.getFileShasum(app, fileFullPath, file.file)
+
+							if err != nil {
+								printError(err.Error())
+							}
+
+							data = fileData{
+								FilePath:     fileFullPath,
+								TrackedSince: time.Now(),
+								LastModified: file.file.lastModified,
+								Size:         file.file.size,
+								Sha256Sum:    shasum,
+							}
+
+							newTrackedFile := trackedFile{
+								file:       file.file,
+								isPresent:  true,
+								isUpToDate: true,
+								shasum:     shasum,
+							}
 
-						shaSum, err := app.getFileShasum(fileFullPath)
+							app.trackedFiles[fileFullPath] = newTrackedFile
 
-						if err != nil {
-							printError(err.Error())
+							err = app.writeJSONFile(fileFullPath, data)
+
+							if err != nil {
+								printError(err.Error())
+							}
 						}
 
-						data.Sha256Sum = shaSum
+					} else if err != nil {
+						printError(err.Error())
+					} else if err == nil {
+						// Update the Sha256 sum of the file
+						trackedFileData := app.trackedFiles[fileFullPath]
+						trackedFileData.shasum = data.Sha256Sum
+						app.trackedFiles[fileFullPath] = trackedFileData
 
-						err = app.writeJSONFile(fileFullPath, data)
+						status := app.getQuickStatus(fileFullPath, file.file, data)
+
+						if status == quickUnchanged {
+							if verbose {
+								fmt.Println("File " + app.getDisplayPath(fileFullPath) + " is up to date.")
+							}
+						} else if status == quickTouched {
+							if verbose {
+								fmt.Println("File " + app.getDisplayPath(fileFullPath) + " is up to date, only its last modified date changed.")
+							}
+						} else {
+							// a file with the same size can have the same content, it is only known after the hash
+							sameSize := data.Size == file.file.size
 
-						if err != nil {
-							printError(err.Error())
+							if verbose && !sameSize {
+								fmt.Println("Updating GLFLite file for " + app.getDisplayPath(fileFullPath))
+							}
+
+							shaSum, err := journal.getFileShasum(app, fileFullPath, file.file)
+
+							if err != nil {
+								printError(err.Error())
+							}
+
+							trackedFileData.shasum = shaSum
+							app.trackedFiles[fileFullPath] = trackedFileData
+
+							// the GLFLite file is kept when only the last modified date changed, so the other clones don't get a new version
+							if sameSize && shaSum == data.Sha256Sum {
+								if verbose && isSameModificationTime(data.LastModified, file.file.lastModified) {
+									fmt.Println("File " + app.getDisplayPath(fileFullPath) + " is up to date.")
+								} else if verbose {
+									fmt.Println("File " + app.getDisplayPath(fileFullPath) + " is up to date, only its last modified date changed.")
+								}
+							} else {
+								if verbose && sameSize {
+									fmt.Println("Updating GLFLite file for " + app.getDisplayPath(fileFullPath))
+								}
+
+								data.LastModified = file.file.lastModified
+								data.Size = file.file.size
+								data.Sha256Sum = shaSum
+
+								err = app.writeJSONFile(fileFullPath, data)
+
+								if err != nil {
+									printError(err.Error())
+								}
+							}
 						}
+					} else {
+						printError("Unknown error.")
 					}
-				} else {
-					printError("Unknown error.")
 				}
 			}
+
+			app.progress.stop()
+
+			err = app.saveIndex()
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			// the files not reached yet keep the Sha256 sum of their GLFLite file in the lists
+			if interrupted.Load() {
+				app.loadShasums()
+			}
+
+			err = app.generateRsyncFileList(true)
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			err = app.generateRsyncFileList(false)
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			err = app.generateSha256FileList()
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			err = journal.close(!interrupted.Load())
+
+			if err != nil {
+				printError(err.Error())
+			}
+		}
+
+		if interrupted.Load() {
+			printRed("Update interrupted, run the update action again to resume it.")
+			exit(130)
+		}
+	}
+
+	if action == "push" || action == "pull" {
+		r, err := app.openRemote(remoteName)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		defer r.close()
+
+		if action == "push" {
+			err = app.pushFiles(r)
+		} else {
+			err = app.pullFiles(r)
+		}
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		err = app.generateRsyncFileList(true)
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
+	if action == "fix-mtimes" {
+		app.index, err = app.openIndex()
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		err = app.fixModificationTimes(dryRun)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		err = app.saveIndex()
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
+	if action == "gc" {
+		referenced, err := app.getReferencedShasums(commits, since)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		remoteNames := []string{}
+
+		if isDirectory(app.getLocalStoreFolder()) {
+			remoteNames = append(remoteNames, localRemoteName)
+		}
+
+		if remoteName != "" && remoteName != localRemoteName {
+			remoteNames = append(remoteNames, remoteName)
+		}
+
+		if len(remoteNames) == 0 {
+			fmt.Println("There is no local store, use the -remote flag to collect the objects of a remote.")
+		}
+
+		for _, name := range remoteNames {
+			r, err := app.openRemote(name)
+
+			if err != nil {
+				printError(err.Error())
+			}
+
+			fmt.Println("Collecting the unreferenced objects of " + name)
+
+			err = app.collectGarbage(r, referenced, graceDays, dryRun)
+
+			r.close()
+
+			if err != nil {
+				printError(err.Error())
+			}
+		}
+	}
+
+	if action == "log" || action == "checkout" {
+		if len(args) > 0 {
+			filePath = args[0]
+		}
+
+		if filePath == "" {
+			printError("No file specified. Usage: glflite log <path> or glflite checkout <path>@<rev>")
+		}
+
+		var trackedFilePath, revision string
+
+		// the paths of log never have a revision
+		if action == "log" {
+			trackedFilePath, err = app.resolvePath(filePath)
+		} else {
+			trackedFilePath, revision, err = app.parseRevisionPath(filePath)
+		}
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		if action == "log" {
+			err = app.printFileHistory(trackedFilePath)
+		} else {
+			err = app.checkoutFile(trackedFilePath, revision, remoteName, force)
+		}
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
+	if action == "diff" {
+		oldRevision := "HEAD"
+		newRevision := ""
+
+		if len(args) > 0 {
+			oldRevision = args[0]
+		}
+
+		if len(args) > 1 {
+			newRevision = args[1]
+		}
+
+		err = app.diffRevisions(oldRevision, newRevision)
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+
+	if action == "mv" {
+		if len(args) != 2 {
+			printError("Usage: glflite mv <old path> <new path>")
+		}
+
+		err = app.moveFile(args[0], args[1])
+
+		if err != nil {
+			printError(err.Error())
 		}
 
 		err = app.generateRsyncFileList(true)
@@ -479,19 +1038,141 @@ func main() {
 		if err != nil {
 			printError(err.Error())
 		}
+	}
+
+	if action == "untrack" || action == "prune" {
+		if action == "untrack" {
+			if len(args) > 0 {
+				filePath = args[0]
+			}
+
+			if filePath == "" {
+				printError("No file specified. Usage: glflite untrack <path|pattern>")
+			}
+
+			// the patterns are rules of the .gitignore file, the paths are relative to the current folder
+			if !isGlobPattern(filePath) {
+				filePath, err = app.resolvePath(filePath)
+
+				if err != nil {
+					printError(err.Error())
+				}
+			}
+
+			err = app.untrackFiles(filePath, removeRule, dryRun)
+		} else {
+			err = app.pruneFiles(dryRun)
+		}
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		if !dryRun {
+			err = app.generateRsyncFileList(true)
+
+			if err != nil {
+				printError(err.Error())
+			}
 
-		err = app.generateSha256FileList()
+			err = app.generateRsyncFileList(false)
+
+			if err != nil {
+				printError(err.Error())
+			}
+		}
+	}
+
+	if action == "track" || action == "untrack-pattern" {
+		if len(args) > 0 {
+			filePath = args[0]
+		}
+
+		pattern := strings.TrimSpace(filePath)
+
+		if pattern == "" {
+			printError("No pattern specified. Usage: glflite " + action + " <pattern>")
+		}
+
+		if action == "track" {
+			err = app.trackPattern(pattern, app.files, dryRun)
+		} else {
+			err = app.untrackPattern(pattern, dryRun)
+		}
 
 		if err != nil {
 			printError(err.Error())
 		}
+	}
 
+	if action == "keygen" {
+		remoteData, err := app.getRemoteConfig(remoteName)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		keyFile, err := getKeyFile(remoteData)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		err = generateKeyFile(keyFile)
+
+		if err != nil {
+			printError(err.Error())
+		}
+
+		fmt.Println("Key file created: " + keyFile)
+		printRed("Keep a copy of the key file in a safe place, the files of the remote can't be decrypted without it.")
+	}
+
+	if action == "serve" {
+		if token == "" {
+			token, err = app.getHTTPToken("")
+
+			if err != nil {
+				printError(err.Error())
+			}
+		}
+
+		err = app.serve(listenAddress, store, token, allowPut)
+
+		if err != nil {
+			printError(err.Error())
+		}
+	}
+}
+
+// cleanupFunctions run before the program exits, also when it exits with
+// an error. The mutex is held until the program exits, so that Ctrl-C doesn't
+// run them while they are added or while they already run.
+var (
+	cleanupFunctions []func()
+	cleanupMutex     sync.Mutex
+)
+
+func addCleanupFunction(cleanup func()) {
+	cleanupMutex.Lock()
+	defer cleanupMutex.Unlock()
+
+	cleanupFunctions = append(cleanupFunctions, cleanup)
+}
+
+func exit(code int) {
+	cleanupMutex.Lock()
+
+	for i := len(cleanupFunctions) - 1; i >= 0; i-- {
+		cleanupFunctions[i]()
 	}
+
+	os.Exit(code)
 }
 
 func printError(message string) {
 	printRed(message)
-	os.Exit(1)
+	exit(1)
 }
 
 func printRed(message string) {
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestApplication creates a repository folder with the given files and
+// their GLFLite files, and returns its application with the files tracked,
+// like after the update action. The current folder is the root folder until
+// the end of the test, like when glflite runs.
+func newTestApplication(t *testing.T, files map[string]string) *application {
+	t.Helper()
+
+	rootFolder := t.TempDir()
+
+	err := os.Mkdir(rootFolder+"/.git", 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		config: config{
+			rootFolder:      rootFolder,
+			gitDirectory:    rootFolder + "/.git",
+			commonDirectory: rootFolder + "/.git",
+		},
+		trackedFiles:    make(map[string]trackedFile),
+		duplicatedFiles: make(map[string][]string),
+	}
+
+	for filePath, content := range files {
+		file := writeTestFile(t, app, filePath, content)
+
+		// the files were modified long before their GLFLite files, they aren't racy
+		file.lastModified = time.Now().Add(-time.Minute)
+
+		err = os.Chtimes(app.getFullPath(filePath), file.lastModified, file.lastModified)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = app.writeJSONFile(filePath, fileData{
+			FilePath:     filePath,
+			TrackedSince: time.Now(),
+			LastModified: file.lastModified,
+			Size:         file.size,
+			Sha256Sum:    getTestShasum(content),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app.trackedFiles[filePath] = trackedFile{
+			file:       file,
+			isPresent:  true,
+			isUpToDate: true,
+			shasum:     getTestShasum(content),
+		}
+
+		app.sortedTrackedFiles = append(app.sortedTrackedFiles, filePath)
+	}
+
+	sort.Strings(app.sortedTrackedFiles)
+
+	currentFolder, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(currentFolder)
+	})
+
+	return app
+}
+
+// writeTestFile writes a file of the repository and returns its information.
+func writeTestFile(t *testing.T, app *application, filePath string, content string) fileInformation {
+	t.Helper()
+
+	fullPath := app.getFullPath(filePath)
+
+	err := os.MkdirAll(filepath.Dir(fullPath), 0755)
+
+	if err == nil {
+		err = os.WriteFile(fullPath, []byte(content), 0644)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(fullPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fileInformation{path: filePath, lastModified: info.ModTime(), size: info.Size()}
+}
+
+func getTestShasum(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+// readTestFile returns the content of a file of the repository, or an empty
+// string when it doesn't exist.
+func readTestFile(t *testing.T, app *application, filePath string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(app.getFullPath(filePath))
+
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+// captureOutput returns what a function prints, without the colors.
+func captureOutput(t *testing.T, print func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	output := make(chan string)
+
+	go func() {
+		content, _ := io.ReadAll(reader)
+		output <- string(content)
+	}()
+
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	print()
+
+	writer.Close()
+
+	content := <-output
+
+	for _, color := range []string{colorRed, colorGreen, colorReset} {
+		content = strings.ReplaceAll(content, color, "")
+	}
+
+	return content
+}
+
+// initTestRepository makes the folder of the application a git repository
+// with a first commit of the given files.
+func initTestRepository(t *testing.T, app *application, files map[string]string) {
+	t.Helper()
+
+	t.Setenv("GIT_AUTHOR_NAME", "glflite")
+	t.Setenv("GIT_AUTHOR_EMAIL", "glflite@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "glflite")
+	t.Setenv("GIT_COMMITTER_EMAIL", "glflite@example.com")
+
+	runTestGit(t, app, "init", "--quiet")
+
+	for filePath, content := range files {
+		writeTestFile(t, app, filePath, content)
+		runTestGit(t, app, "add", "--", filePath)
+	}
+
+	runTestGit(t, app, "commit", "--quiet", "--allow-empty", "-m", "first commit")
+}
+
+func runTestGit(t *testing.T, app *application, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = app.config.rootFolder
+
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err.Error(), output)
+	}
+
+	return string(output)
+}
+
+// answerQuestions gives the answers to the questions that glflite asks until
+// the end of the test.
+func answerQuestions(t *testing.T, answers ...string) {
+	t.Helper()
+
+	reader := stdinReader
+	stdinReader = bufio.NewReader(strings.NewReader(strings.Join(answers, "\n") + "\n"))
+
+	t.Cleanup(func() {
+		stdinReader = reader
+	})
+}
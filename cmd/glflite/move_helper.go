@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+func (app *application) removeTrackedFile(filePath string) {
+	delete(app.trackedFiles, filePath)
+
+	i := sort.SearchStrings(app.sortedTrackedFiles, filePath)
+
+	if i < len(app.sortedTrackedFiles) && app.sortedTrackedFiles[i] == filePath {
+		app.sortedTrackedFiles = append(app.sortedTrackedFiles[:i], app.sortedTrackedFiles[i+1:]...)
+	}
+}
+
+func (app *application) addTrackedFile(file trackedFile) {
+	if _, ok := app.trackedFiles[file.file.path]; !ok {
+		i := sort.SearchStrings(app.sortedTrackedFiles, file.file.path)
+
+		app.sortedTrackedFiles = append(app.sortedTrackedFiles, "")
+		copy(app.sortedTrackedFiles[i+1:], app.sortedTrackedFiles[i:])
+		app.sortedTrackedFiles[i] = file.file.path
+	}
+
+	app.trackedFiles[file.file.path] = file
+}
+
+// moveGLFLiteFile moves the GLFLite file of a file to its new path. The
+// committed GLFLite files are moved with git mv, so that git can follow the
+// history of the file.
+func (app *application) moveGLFLiteFile(oldPath string, newPath string, data fileData) error {
+	oldFile := getGLFLiteFilePath(oldPath)
+	newFile := getGLFLiteFilePath(newPath)
+
+	err := os.MkdirAll(filepath.Dir(app.getFullPath(newFile)), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = app.runGit("ls-files", "--error-unmatch", "--", oldFile)
+
+	if err == nil {
+		_, err = app.runGit("mv", "--", oldFile, newFile)
+	} else {
+		err = os.Rename(app.getFullPath(oldFile), app.getFullPath(newFile))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	data.FilePath = newPath
+
+	return app.writeJSONFile(newPath, data)
+}
+
+// detectMovedFiles finds the files that were moved, a missing file and a new
+// file without GLFLite file with the same size and Sha256 sum. The GLFLite
+// file is moved to the new path so that it keeps its TrackedSince date.
+func (app *application) detectMovedFiles() (int, error) {
+	missingFiles := make(map[int64][]string)
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent {
+			missingFiles[file.file.size] = append(missingFiles[file.file.size], fileFullPath)
+		}
+	}
+
+	if len(missingFiles) == 0 {
+		return 0, nil
+	}
+
+	// only the new files with the size of a missing file are hashed
+	var newFiles []string
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent || file.file.isDirectory || len(missingFiles[file.file.size]) == 0 {
+			continue
+		}
+
+		if isLink(app.getFullPath(fileFullPath)) || fileExists(app.getFullPath(getGLFLiteFilePath(fileFullPath))) {
+			continue
+		}
+
+		newFiles = append(newFiles, fileFullPath)
+	}
+
+	filesMoved := 0
+
+	for _, newPath := range newFiles {
+		file := app.trackedFiles[newPath]
+		candidates := missingFiles[file.file.size]
+
+		if len(candidates) == 0 {
+			continue
+		}
+
+		shaSum, err := app.getFileShasum(newPath)
+
+		if err != nil {
+			return filesMoved, err
+		}
+
+		for i, oldPath := range candidates {
+			data, err := app.readJSONFile(oldPath)
+
+			if err != nil {
+				return filesMoved, err
+			}
+
+			if data.Sha256Sum != shaSum {
+				continue
+			}
+
+			data.LastModified = file.file.lastModified
+
+			err = app.moveGLFLiteFile(oldPath, newPath, data)
+
+			if err != nil {
+				return filesMoved, err
+			}
+
+			if app.verbose {
+				fmt.Printf("File %s was moved to %s\n", app.getDisplayPath(oldPath), app.getDisplayPath(newPath))
+			}
+
+			missingFiles[file.file.size] = append(candidates[:i:i], candidates[i+1:]...)
+
+			file.isUpToDate = true
+			file.shasum = shaSum
+			app.trackedFiles[newPath] = file
+
+			app.removeTrackedFile(oldPath)
+
+			filesMoved++
+			break
+		}
+	}
+
+	return filesMoved, nil
+}
+
+// moveFile moves a tracked file and its GLFLite file, the destination can be
+// a folder.
+func (app *application) moveFile(oldPath string, newPath string) error {
+	oldPath, err := app.resolvePath(oldPath)
+
+	if err != nil {
+		return err
+	}
+
+	newPath, err = app.resolvePath(newPath)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := app.readJSONFile(oldPath)
+
+	if errors.Is(err, ErrGLFLiteFileNotFound) {
+		return errors.New(fmt.Sprintf("The file %s doesn't have a GLFLite file, run the update action first", oldPath))
+	} else if err != nil {
+		return err
+	}
+
+	if isDirectory(app.getFullPath(newPath)) {
+		newPath = path.Join(newPath, path.Base(oldPath))
+	}
+
+	if newPath == oldPath {
+		return errors.New(fmt.Sprintf("The file %s is already at that path", oldPath))
+	}
+
+	if fileExists(app.getFullPath(newPath)) || fileExists(app.getFullPath(getGLFLiteFilePath(newPath))) {
+		return errors.New(fmt.Sprintf("The file %s already exists", newPath))
+	}
+
+	if !isFileExcluded(app.config.fileRules, newPath, false) {
+		return errors.New(fmt.Sprintf("The path %s isn't matched by the rules after %s in the .gitignore file, the file would be committed to git", newPath, gitIgnoreSeparator))
+	}
+
+	file := app.trackedFiles[oldPath]
+
+	if file.isPresent {
+		err = os.MkdirAll(filepath.Dir(app.getFullPath(newPath)), 0755)
+
+		if err != nil {
+			return err
+		}
+
+		err = os.Rename(app.getFullPath(oldPath), app.getFullPath(newPath))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = app.moveGLFLiteFile(oldPath, newPath, data)
+
+	if err != nil {
+		return err
+	}
+
+	app.removeTrackedFile(oldPath)
+
+	file.file.path = newPath
+	app.addTrackedFile(file)
+
+	fmt.Printf("Moved %s to %s\n", app.getDisplayPath(oldPath), app.getDisplayPath(newPath))
+
+	return nil
+}
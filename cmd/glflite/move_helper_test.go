@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectMovedFiles(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"videos/outro.mp4": "outro video",
+		"photos/cover.raw": "cover photo",
+	})
+
+	trackedSince := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	data, err := app.readJSONFile("videos/intro.mp4")
+
+	if err == nil {
+		data.TrackedSince = trackedSince
+		err = app.writeJSONFile("videos/intro.mp4", data)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the intro was moved, the outro was removed and a new file has its size
+	for _, filePath := range []string{"videos/intro.mp4", "videos/outro.mp4"} {
+		file := app.trackedFiles[filePath]
+		file.isPresent = false
+		app.trackedFiles[filePath] = file
+	}
+
+	for filePath, content := range map[string]string{"archive/intro.mp4": "intro video", "videos/other.mp4": "other video"} {
+		app.addTrackedFile(trackedFile{file: writeTestFile(t, app, filePath, content), isPresent: true})
+	}
+
+	filesMoved, err := app.detectMovedFiles()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filesMoved != 1 {
+		t.Errorf("%d files were moved, expected 1", filesMoved)
+	}
+
+	data, err = app.readJSONFile("archive/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.FilePath != "archive/intro.mp4" || !data.TrackedSince.Equal(trackedSince) || data.Sha256Sum != getTestShasum("intro video") {
+		t.Errorf("the GLFLite file of the moved file is %v", data)
+	}
+
+	if fileExists(app.getFullPath(getGLFLiteFilePath("videos/intro.mp4"))) || !fileExists(app.getFullPath(getGLFLiteFilePath("videos/outro.mp4"))) {
+		t.Error("the GLFLite file of the wrong file was moved")
+	}
+
+	if strings.Join(app.sortedTrackedFiles, ",") != "archive/intro.mp4,photos/cover.raw,videos/other.mp4,videos/outro.mp4" {
+		t.Errorf("the tracked files are %v", app.sortedTrackedFiles)
+	}
+
+	if !app.trackedFiles["archive/intro.mp4"].isUpToDate || app.trackedFiles["videos/other.mp4"].isUpToDate {
+		t.Error("the new file that wasn't moved is up to date")
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"videos/outro.mp4": "outro video",
+	})
+
+	initTestRepository(t, app, map[string]string{".gitignore": ""})
+	runTestGit(t, app, "add", "--", getGLFLiteFilePath("videos/intro.mp4"))
+	runTestGit(t, app, "commit", "--quiet", "-m", "intro video")
+
+	app.config.fileRules = []string{"*.mp4"}
+
+	var err error
+
+	output := captureOutput(t, func() {
+		err = app.moveFile("videos/intro.mp4", "archive/intro.mp4")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != "Moved videos/intro.mp4 to archive/intro.mp4\n" || readTestFile(t, app, "archive/intro.mp4") != "intro video" || readTestFile(t, app, "videos/intro.mp4") != "" {
+		t.Errorf("the file wasn't moved:\n%s", output)
+	}
+
+	// the committed GLFLite file is moved with git, the other one is renamed
+	status := runTestGit(t, app, "status", "--porcelain")
+
+	if !strings.HasPrefix(status, "R") || !strings.Contains(status, " videos/intro.mp4.glflite -> archive/intro.mp4.glflite\n") {
+		t.Errorf("the GLFLite file wasn't moved with git:\n%s", status)
+	}
+
+	// the destination can be a folder
+	err = app.moveFile("videos/outro.mp4", "archive")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := app.readJSONFile("archive/outro.mp4")
+
+	if err != nil || data.FilePath != "archive/outro.mp4" {
+		t.Errorf("the GLFLite file of the outro is %v: %v", data, err)
+	}
+
+	if strings.Join(app.sortedTrackedFiles, ",") != "archive/intro.mp4,archive/outro.mp4" {
+		t.Errorf("the tracked files are %v", app.sortedTrackedFiles)
+	}
+
+	writeTestFile(t, app, "notes.txt", "notes")
+
+	for _, test := range []struct {
+		oldPath string
+		newPath string
+		message string
+	}{
+		{"notes.txt", "archive/notes.txt", "doesn't have a GLFLite file"},
+		{"archive/intro.mp4", "archive", "is already at that path"},
+		{"archive/intro.mp4", "archive/outro.mp4", "already exists"},
+		{"archive/intro.mp4", "archive/intro.txt", "isn't matched by the rules"},
+	} {
+		err = app.moveFile(test.oldPath, test.newPath)
+
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("the move of %s to %s returned %v", test.oldPath, test.newPath, err)
+		}
+	}
+}
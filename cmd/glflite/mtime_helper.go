@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// fixModificationTimes sets the last modified date of the GLFLite file back
+// on the files whose content didn't change, like the files copied without
+// their dates or restored from a backup. The content is verified with the
+// Sha256 sum, the local index gives it when the file was already hashed.
+func (app *application) fixModificationTimes(dryRun bool) error {
+	filesFixed := 0
+	filesModified := 0
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent || file.file.isDirectory || isLink(app.getFullPath(fileFullPath)) {
+			continue
+		}
+
+		data, err := app.readJSONFile(fileFullPath)
+
+		if errors.Is(err, ErrGLFLiteFileNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if isSameModificationTime(data.LastModified, file.file.lastModified) {
+			continue
+		}
+
+		if data.Size != file.file.size || app.getQuickStatus(fileFullPath, file.file, data) != quickTouched {
+			shaSum := ""
+
+			if data.Size == file.file.size {
+				shaSum, err = app.getFileShasum(fileFullPath)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			if shaSum != data.Sha256Sum {
+				if app.verbose {
+					fmt.Printf("File %s was modified, run the update action to update its GLFLite file.\n", app.getDisplayPath(fileFullPath))
+				}
+
+				filesModified++
+
+				continue
+			}
+		}
+
+		if app.verbose {
+			if dryRun {
+				fmt.Printf("The last modified date of %s would be set back to %s\n", app.getDisplayPath(fileFullPath), data.LastModified)
+			} else {
+				fmt.Printf("Setting the last modified date of %s back to %s\n", app.getDisplayPath(fileFullPath), data.LastModified)
+			}
+		}
+
+		filesFixed++
+
+		if dryRun {
+			continue
+		}
+
+		err = os.Chtimes(app.getFullPath(fileFullPath), data.LastModified, data.LastModified)
+
+		if err != nil {
+			return err
+		}
+
+		// the local index gets the new date, so the quick check trusts it
+		info, err := os.Lstat(app.getFullPath(fileFullPath))
+
+		if err != nil {
+			return err
+		}
+
+		file.file.lastModified = info.ModTime()
+		file.file.changed, file.file.inode = getChangeInformation(info)
+		app.trackedFiles[fileFullPath] = file
+
+		app.index.record(fileFullPath, file.file, data.Sha256Sum, time.Now())
+	}
+
+	if dryRun {
+		fmt.Printf("Files whose last modified date would be set back: ")
+	} else {
+		fmt.Printf("Files whose last modified date was set back: ")
+	}
+
+	printGreen(strconv.Itoa(filesFixed))
+
+	fmt.Printf("Files modified: ")
+	printRed(strconv.Itoa(filesModified))
+
+	if dryRun {
+		fmt.Println("Dry run, the last modified dates weren't changed.")
+	}
+
+	return nil
+}
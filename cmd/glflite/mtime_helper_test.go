@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetQuickStatusTouched(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	data, err := app.readJSONFile("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	touched := time.Now().Add(-time.Hour)
+
+	err = os.Chtimes(app.getFullPath("videos/intro.mp4"), touched, touched)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["videos/intro.mp4"].file
+	file.lastModified = touched
+
+	if status := app.getQuickStatus("videos/intro.mp4", file, data); status != quickModified {
+		t.Errorf("the status of the file without index is %d", status)
+	}
+
+	// the file was hashed on this clone since it was touched
+	app.index = &localIndex{entries: make(map[string]indexEntry)}
+	app.index.record("videos/intro.mp4", file, data.Sha256Sum, time.Now())
+
+	if status := app.getQuickStatus("videos/intro.mp4", file, data); status != quickTouched {
+		t.Errorf("the status of the touched file is %d", status)
+	}
+
+	if len(app.getPendingFiles()) != 0 {
+		t.Errorf("the pending files are %v", app.getPendingFiles())
+	}
+}
+
+func TestFixModificationTimes(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"videos/outro.mp4": "outro video",
+		"photos/cover.raw": "cover photo",
+	})
+
+	app.verbose = true
+
+	// the intro was copied without its date, the outro changed with the same size
+	copied := time.Now().Add(-time.Hour)
+
+	for filePath, content := range map[string]string{"videos/intro.mp4": "intro video", "videos/outro.mp4": "OUTRO VIDEO"} {
+		file := writeTestFile(t, app, filePath, content)
+
+		err := os.Chtimes(app.getFullPath(filePath), copied, copied)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file.lastModified = copied
+
+		app.trackedFiles[filePath] = trackedFile{file: file, isPresent: true}
+	}
+
+	var err error
+
+	output := captureOutput(t, func() {
+		err = app.fixModificationTimes(true)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"The last modified date of videos/intro.mp4 would be set back",
+		"File videos/outro.mp4 was modified, run the update action",
+		"Files whose last modified date would be set back: 1",
+		"Files modified: 1",
+		"Dry run",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("the output doesn't contain %q: %s", expected, output)
+		}
+	}
+
+	if info, _ := os.Stat(app.getFullPath("videos/intro.mp4")); !info.ModTime().Equal(copied) {
+		t.Error("the dry run changed the last modified date")
+	}
+
+	captureOutput(t, func() {
+		err = app.fixModificationTimes(false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := app.readJSONFile("videos/intro.mp4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info, _ := os.Stat(app.getFullPath("videos/intro.mp4")); !isSameModificationTime(info.ModTime(), data.LastModified) {
+		t.Errorf("the last modified date of the intro is %v, expected %v", info.ModTime(), data.LastModified)
+	}
+
+	if info, _ := os.Stat(app.getFullPath("videos/outro.mp4")); !info.ModTime().Equal(copied) {
+		t.Error("the last modified date of the modified file was changed")
+	}
+}
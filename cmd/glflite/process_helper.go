@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// getProcessStart returns when a process started, in a form that is only
+// compared with another value of the same process, or an empty string when
+// it can't be found. A process that reuses the PID of a process that died
+// has another start, also after a reboot.
+func getProcessStart(pid int) string {
+	content, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+
+	if err == nil {
+		// the name of the command is between parentheses and can have spaces, the start time is the 22nd field
+		end := strings.LastIndex(string(content), ")")
+
+		if end < 0 {
+			return ""
+		}
+
+		fields := strings.Fields(string(content)[end+1:])
+
+		if len(fields) < 20 {
+			return ""
+		}
+
+		// the start time counts the clock ticks since the boot
+		bootID, _ := os.ReadFile("/proc/sys/kernel/random/boot_id")
+
+		return strings.TrimSpace(string(bootID)) + "/" + fields[19]
+	}
+
+	// the systems without /proc have ps, it prints the start date with seconds
+	output, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(output))
+}
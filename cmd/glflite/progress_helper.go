@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	progressAuto = "auto"
+	progressTTY  = "tty"
+	progressLog  = "log"
+	progressJSON = "json"
+	progressNone = "none"
+)
+
+// the intervals between the updates of the progress display, the log lines
+// and the JSON events
+const (
+	progressTTYInterval  = 200 * time.Millisecond
+	progressLogInterval  = 10 * time.Second
+	progressJSONInterval = time.Second
+)
+
+// progressEvent is a line of the JSON progress mode.
+type progressEvent struct {
+	Event          string  `json:"event"`
+	Action         string  `json:"action"`
+	FilesDone      int     `json:"files_done"`
+	FilesTotal     int     `json:"files_total"`
+	BytesDone      int64   `json:"bytes_done"`
+	BytesTotal     int64   `json:"bytes_total"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ETASeconds     float64 `json:"eta_seconds"`
+	CurrentFile    string  `json:"current_file,omitempty"`
+}
+
+// progressReporter shows the progress of the files hashed by an action on
+// the standard error, so it doesn't mix with the output of the action.
+type progressReporter struct {
+	mutex       sync.Mutex
+	mode        string
+	action      string
+	filesTotal  int
+	bytesTotal  int64
+	filesDone   int
+	bytesDone   int64
+	currentFile string
+	started     time.Time
+	lineShown   bool
+	stopped     bool
+	done        chan struct{}
+}
+
+// getProgressMode returns the progress mode used for a mode given by the
+// -progress flag, auto shows the progress display in a terminal and log lines
+// otherwise. Without a terminal, the quiet mode doesn't print log lines.
+func getProgressMode(mode string, quiet bool) (string, error) {
+	switch mode {
+	case progressTTY, progressLog, progressJSON, progressNone:
+		return mode, nil
+	case progressAuto, "":
+		if isTerminalFile(os.Stderr) {
+			return progressTTY, nil
+		}
+
+		if quiet {
+			return progressNone, nil
+		}
+
+		return progressLog, nil
+	}
+
+	return "", errors.New(fmt.Sprintf("Invalid progress mode %s. Possible values: auto, tty, log, json, none.", mode))
+}
+
+// startProgress starts reporting the progress of the hash of the given number
+// of files and bytes, nil when the progress isn't shown.
+func startProgress(mode string, action string, filesTotal int, bytesTotal int64) *progressReporter {
+	if mode == progressNone || filesTotal == 0 {
+		return nil
+	}
+
+	progress := &progressReporter{
+		mode:       mode,
+		action:     action,
+		filesTotal: filesTotal,
+		bytesTotal: bytesTotal,
+		started:    time.Now(),
+		done:       make(chan struct{}),
+	}
+
+	interval := progressTTYInterval
+
+	if mode == progressLog {
+		interval = progressLogInterval
+	} else if mode == progressJSON {
+		interval = progressJSONInterval
+		progress.printEvent("start")
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				progress.mutex.Lock()
+				progress.print()
+				progress.mutex.Unlock()
+			case <-progress.done:
+				return
+			}
+		}
+	}()
+
+	return progress
+}
+
+// startFile records the file being hashed, the progress is only shown
+// during the hash so the terminal line doesn't mix with the other output.
+func (p *progressReporter) startFile(filePath string) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.currentFile = filePath
+}
+
+// finishFile records the end of the hash of a file.
+func (p *progressReporter) finishFile() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.filesDone++
+
+	p.clearLine()
+
+	// the event of a file tells which file was hashed
+	if p.mode == progressJSON {
+		p.printEvent("file")
+	}
+
+	p.currentFile = ""
+}
+
+func (p *progressReporter) addBytes(n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.bytesDone += int64(n)
+}
+
+// stop prints the last progress line, it can be called several times.
+func (p *progressReporter) stop() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	p.stopped = true
+	close(p.done)
+
+	p.clearLine()
+
+	if p.mode == progressJSON {
+		p.printEvent("done")
+	} else if p.mode == progressLog && time.Since(p.started) >= progressLogInterval {
+		fmt.Fprintf(os.Stderr, "Hashed %d files (%s) in %s\n", p.filesDone, formatSize(p.bytesDone), time.Since(p.started).Round(time.Second))
+	}
+}
+
+// getSpeed returns the bytes hashed per second and the seconds left, -1 when
+// they can't be estimated yet.
+func (p *progressReporter) getSpeed() (float64, float64) {
+	elapsed := time.Since(p.started).Seconds()
+
+	if elapsed <= 0 || p.bytesDone == 0 {
+		return 0, -1
+	}
+
+	speed := float64(p.bytesDone) / elapsed
+
+	remaining := p.bytesTotal - p.bytesDone
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return speed, float64(remaining) / speed
+}
+
+func (p *progressReporter) getLine() string {
+	speed, eta := p.getSpeed()
+
+	line := fmt.Sprintf("Hashed %s of %s, %d of %d files", formatSize(p.bytesDone), formatSize(p.bytesTotal), p.filesDone, p.filesTotal)
+
+	if eta >= 0 {
+		line += fmt.Sprintf(", %s/s, ETA %s", formatSize(int64(speed)), (time.Duration(eta) * time.Second).Round(time.Second))
+	}
+
+	if p.currentFile != "" {
+		line += ", " + p.currentFile
+	}
+
+	return line
+}
+
+// print shows the progress, it is called with the mutex locked.
+func (p *progressReporter) print() {
+	if p.stopped {
+		return
+	}
+
+	switch p.mode {
+	case progressTTY:
+		if p.currentFile == "" {
+			return
+		}
+
+		// the line is cut so it doesn't wrap, a wrapped line can't be cleared
+		line := []rune(p.getLine())
+
+		if len(line) > 120 {
+			line = append(line[:119], '…')
+		}
+
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", string(line))
+		p.lineShown = true
+	case progressLog:
+		fmt.Fprintln(os.Stderr, p.getLine())
+	case progressJSON:
+		p.printEvent("progress")
+	}
+}
+
+func (p *progressReporter) clearLine() {
+	if p.lineShown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.lineShown = false
+	}
+}
+
+func (p *progressReporter) printEvent(event string) {
+	speed, eta := p.getSpeed()
+
+	line, err := json.Marshal(progressEvent{
+		Event:          event,
+		Action:         p.action,
+		FilesDone:      p.filesDone,
+		FilesTotal:     p.filesTotal,
+		BytesDone:      p.bytesDone,
+		BytesTotal:     p.bytesTotal,
+		BytesPerSecond: speed,
+		ETASeconds:     eta,
+		CurrentFile:    p.currentFile,
+	})
+
+	if err == nil {
+		fmt.Fprintln(os.Stderr, string(line))
+	}
+}
+
+// progressReader counts the bytes read from a file being hashed.
+type progressReader struct {
+	reader   io.Reader
+	progress *progressReporter
+}
+
+func (r *progressReader) Read(buffer []byte) (int, error) {
+	n, err := r.reader.Read(buffer)
+
+	if n > 0 {
+		r.progress.addBytes(n)
+	}
+
+	return n, err
+}
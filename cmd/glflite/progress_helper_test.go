@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureErrorOutput returns what a function prints on the standard error,
+// where the progress is shown.
+func captureErrorOutput(t *testing.T, print func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stderr := os.Stderr
+	os.Stderr = writer
+
+	output := make(chan string)
+
+	go func() {
+		content, _ := io.ReadAll(reader)
+		output <- string(content)
+	}()
+
+	defer func() {
+		os.Stderr = stderr
+	}()
+
+	print()
+
+	writer.Close()
+
+	return <-output
+}
+
+func TestGetProgressMode(t *testing.T) {
+	for _, test := range []struct {
+		mode     string
+		quiet    bool
+		expected string
+	}{
+		{"tty", true, progressTTY},
+		{"json", false, progressJSON},
+		{"none", false, progressNone},
+		{"auto", false, progressLog},
+		{"", false, progressLog},
+		{"auto", true, progressNone},
+	} {
+		var mode string
+		var err error
+
+		// the standard error isn't a terminal
+		captureErrorOutput(t, func() {
+			mode, err = getProgressMode(test.mode, test.quiet)
+		})
+
+		if err != nil || mode != test.expected {
+			t.Errorf("the mode %q with quiet %t is %q: %v", test.mode, test.quiet, mode, err)
+		}
+	}
+
+	_, err := getProgressMode("bar", false)
+
+	if err == nil {
+		t.Error("an invalid mode was accepted")
+	}
+}
+
+func TestProgressJSONEvents(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": strings.Repeat("intro video ", 1000),
+		"videos/outro.mp4": "outro video",
+	})
+
+	output := captureErrorOutput(t, func() {
+		app.progress = startProgress(progressJSON, "update", 2, 12011)
+
+		for _, filePath := range app.sortedTrackedFiles {
+			shaSum, err := app.getFileShasum(filePath)
+
+			if err != nil || shaSum != app.trackedFiles[filePath].shasum {
+				t.Errorf("the Sha256 sum of %s is %s: %v", filePath, shaSum, err)
+			}
+		}
+
+		app.progress.stop()
+		app.progress.stop()
+	})
+
+	var events []progressEvent
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var event progressEvent
+
+		err := json.Unmarshal([]byte(line), &event)
+
+		if err != nil {
+			t.Fatalf("the line %q isn't a JSON event: %v", line, err)
+		}
+
+		// the progress events depend on the time the hash takes
+		if event.Event != "progress" {
+			events = append(events, event)
+		}
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("the events are %v", events)
+	}
+
+	for i, expected := range []progressEvent{
+		{Event: "start", Action: "update", FilesDone: 0, BytesDone: 0},
+		{Event: "file", Action: "update", FilesDone: 1, BytesDone: 12000, CurrentFile: "videos/intro.mp4"},
+		{Event: "file", Action: "update", FilesDone: 2, BytesDone: 12011, CurrentFile: "videos/outro.mp4"},
+		{Event: "done", Action: "update", FilesDone: 2, BytesDone: 12011},
+	} {
+		event := events[i]
+
+		if event.Event != expected.Event || event.Action != expected.Action || event.FilesDone != expected.FilesDone || event.BytesDone != expected.BytesDone || event.CurrentFile != expected.CurrentFile {
+			t.Errorf("the event %d is %v, expected %v", i, event, expected)
+		}
+
+		if event.FilesTotal != 2 || event.BytesTotal != 12011 {
+			t.Errorf("the totals of the event %d are %d files and %d bytes", i, event.FilesTotal, event.BytesTotal)
+		}
+	}
+
+	if events[0].ETASeconds != -1 || events[3].ETASeconds != 0 {
+		t.Errorf("the estimated time left is %f at the start and %f at the end", events[0].ETASeconds, events[3].ETASeconds)
+	}
+}
+
+func TestProgressLines(t *testing.T) {
+	progress := &progressReporter{
+		mode:        progressTTY,
+		filesTotal:  3,
+		bytesTotal:  30 * 1024 * 1024,
+		filesDone:   1,
+		bytesDone:   10 * 1024 * 1024,
+		currentFile: "videos/" + strings.Repeat("a", 200) + ".mp4",
+		started:     time.Now().Add(-10 * time.Second),
+		done:        make(chan struct{}),
+	}
+
+	line := progress.getLine()
+
+	// the speed changes with the time the test takes
+	if !strings.HasPrefix(line, "Hashed 10.0 MB of 30.0 MB, 1 of 3 files, 102") || !strings.Contains(line, " KB/s, ETA 20s, videos/aaa") {
+		t.Errorf("the progress line is %q", line)
+	}
+
+	// the terminal line is cut so it doesn't wrap, and cleared when the file is hashed
+	output := captureErrorOutput(t, func() {
+		progress.print()
+		progress.finishFile()
+	})
+
+	shown := strings.TrimSuffix(strings.TrimPrefix(output, "\r\033[K"), "\r\033[K")
+
+	if !strings.HasPrefix(shown, "Hashed 10.0 MB") || !strings.HasSuffix(shown, "aaa…") || len([]rune(shown)) != 120 {
+		t.Errorf("the terminal line is %q", output)
+	}
+
+	// the log lines are printed without a current file, and at the end of a long hash
+	progress.mode = progressLog
+
+	output = captureErrorOutput(t, func() {
+		progress.print()
+		progress.stop()
+	})
+
+	if !strings.HasPrefix(output, "Hashed 10.0 MB of 30.0 MB, 2 of 3 files, ") || !strings.HasSuffix(output, " KB/s, ETA 20s\nHashed 2 files (10.0 MB) in 10s\n") {
+		t.Errorf("the log lines are %q", output)
+	}
+
+	// the progress isn't shown without files nor with the none mode
+	var nothing *progressReporter
+
+	if startProgress(progressNone, "update", 3, 100) != nil || startProgress(progressLog, "update", 0, 0) != nil {
+		t.Error("the progress is shown without files or with the none mode")
+	}
+
+	nothing.startFile("videos/intro.mp4")
+	nothing.finishFile()
+	nothing.stop()
+}
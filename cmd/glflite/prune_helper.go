@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// matchesFilePattern tells if a tracked file is selected by a path, a folder
+// or a pattern like the ones of the .gitignore file.
+func matchesFilePattern(pattern string, filePath string) bool {
+	pattern = strings.TrimSuffix(cleanHistoryPath(pattern), "/")
+
+	if pattern == "." || filePath == pattern || strings.HasPrefix(filePath, pattern+"/") {
+		return true
+	}
+
+	if matched, _ := path.Match(pattern, filePath); matched {
+		return true
+	}
+
+	return isFileExcluded([]string{pattern}, filePath, false)
+}
+
+// removeGLFLiteFile deletes the GLFLite file of a file, the committed
+// GLFLite files are removed with git rm so that the deletion is staged.
+func (app *application) removeGLFLiteFile(filePath string) error {
+	glfFile := getGLFLiteFilePath(filePath)
+
+	_, err := app.runGit("ls-files", "--error-unmatch", "--", glfFile)
+
+	if err == nil {
+		_, err = app.runGit("rm", "--quiet", "--force", "--", glfFile)
+
+		return err
+	}
+
+	return os.Remove(app.getFullPath(glfFile))
+}
+
+// isIgnoredByGit tells if git ignores a file, the files that aren't tracked
+// by GLFLite anymore could be committed to git otherwise.
+func (app *application) isIgnoredByGit(filePath string) bool {
+	_, err := app.runGit("check-ignore", "--quiet", "--no-index", "--", filePath)
+
+	return err == nil
+}
+
+// untrackFiles removes the GLFLite files of the files selected by a path or
+// a pattern, the files are kept. With removeRule, the rule of the .gitignore
+// file equal to the pattern is removed too, otherwise the update action would
+// track the files again.
+func (app *application) untrackFiles(pattern string, removeRule bool, dryRun bool) error {
+	var untrackedFiles []string
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		if !matchesFilePattern(pattern, fileFullPath) || !fileExists(app.getFullPath(getGLFLiteFilePath(fileFullPath))) {
+			continue
+		}
+
+		if app.verbose {
+			fmt.Printf("Untracking %s\n", app.getDisplayPath(fileFullPath))
+		}
+
+		untrackedFiles = append(untrackedFiles, fileFullPath)
+	}
+
+	if removeRule {
+		if dryRun {
+			fmt.Printf("The rule %s would be removed from the .gitignore file.\n", pattern)
+		} else {
+			removed, err := removeGitIgnoreRule(app.config.rootFolder, pattern)
+
+			if err != nil {
+				return err
+			}
+
+			if !removed {
+				printRed(fmt.Sprintf("The rule %s is not in the .gitignore file after the %s line.", pattern, gitIgnoreSeparator))
+			}
+
+			app.config.fileRules, err = getGitIgnoreContent(app.config.rootFolder)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Files to untrack: ")
+		printGreen(strconv.Itoa(len(untrackedFiles)))
+		fmt.Println("Dry run, no GLFLite files were removed.")
+
+		return nil
+	}
+
+	for _, fileFullPath := range untrackedFiles {
+		err := app.removeGLFLiteFile(fileFullPath)
+
+		if err != nil {
+			return err
+		}
+
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent {
+			app.removeTrackedFile(fileFullPath)
+		} else if isFileExcluded(app.config.fileRules, fileFullPath, false) {
+			printRed(fmt.Sprintf("File %s still matches the rules of the .gitignore file, the update action will track it again.", fileFullPath))
+		} else {
+			app.removeTrackedFile(fileFullPath)
+
+			if !app.isIgnoredByGit(fileFullPath) {
+				printRed(fmt.Sprintf("File %s isn't ignored by git anymore, add a rule outside of the %s section of the .gitignore file to keep it out of the repository.", fileFullPath, gitIgnoreSeparator))
+			}
+		}
+	}
+
+	fmt.Printf("Files untracked: ")
+	printGreen(strconv.Itoa(len(untrackedFiles)))
+
+	return nil
+}
+
+// pruneFiles removes the orphaned GLFLite files, the ones of the files that
+// are missing and don't match the rules of the .gitignore file anymore.
+func (app *application) pruneFiles(dryRun bool) error {
+	var orphanedFiles []string
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if file.isPresent || isFileExcluded(app.config.fileRules, fileFullPath, false) {
+			continue
+		}
+
+		if app.verbose {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printRed("Missing and not matched by the rules of the .gitignore file")
+		}
+
+		orphanedFiles = append(orphanedFiles, fileFullPath)
+	}
+
+	fmt.Printf("Orphaned GLFLite files: ")
+	printRed(strconv.Itoa(len(orphanedFiles)))
+
+	if len(orphanedFiles) == 0 {
+		return nil
+	}
+
+	if dryRun {
+		fmt.Println("Dry run, no GLFLite files were removed.")
+		return nil
+	}
+
+	if !askConfirmation(fmt.Sprintf("Do you want to remove %d GLFLite files?", len(orphanedFiles))) {
+		return nil
+	}
+
+	for _, fileFullPath := range orphanedFiles {
+		err := app.removeGLFLiteFile(fileFullPath)
+
+		if err != nil {
+			return err
+		}
+
+		app.removeTrackedFile(fileFullPath)
+	}
+
+	fmt.Printf("GLFLite files removed: ")
+	printGreen(strconv.Itoa(len(orphanedFiles)))
+
+	return nil
+}
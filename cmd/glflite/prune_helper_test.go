@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchesFilePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		filePath string
+		matches  bool
+	}{
+		{"videos/intro.mp4", "videos/intro.mp4", true},
+		{"./videos/", "videos/intro.mp4", true},
+		{"videos", "videos2/intro.mp4", false},
+		{".", "videos/intro.mp4", true},
+		{"*.mp4", "videos/intro.mp4", true},
+		{"videos/*.mp4", "videos/intro.mp4", true},
+		{"*.wav", "videos/intro.mp4", false},
+	} {
+		if matchesFilePattern(test.pattern, test.filePath) != test.matches {
+			t.Errorf("the pattern %s matches %s: %t", test.pattern, test.filePath, !test.matches)
+		}
+	}
+}
+
+func TestUntrackFiles(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"audio/intro.wav":  "intro audio",
+		"audio/outro.wav":  "outro audio",
+		"videos/intro.mp4": "intro video",
+	})
+
+	initTestRepository(t, app, map[string]string{".gitignore": "\n" + gitIgnoreSeparator + "\n*.wav\n*.mp4\n"})
+	runTestGit(t, app, "add", "--", getGLFLiteFilePath("audio/intro.wav"))
+	runTestGit(t, app, "commit", "--quiet", "-m", "intro audio")
+
+	var err error
+
+	app.config.fileRules, err = getGitIgnoreContent(app.config.rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureOutput(t, func() {
+		err = app.untrackFiles("*.wav", true, true)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "Files to untrack: 2\n") || !fileExists(app.getFullPath(getGLFLiteFilePath("audio/outro.wav"))) {
+		t.Errorf("the dry run printed:\n%s", output)
+	}
+
+	output = captureOutput(t, func() {
+		err = app.untrackFiles("*.wav", true, false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "Files untracked: 2\n") {
+		t.Errorf("the untrack action printed:\n%s", output)
+	}
+
+	// the files are kept, the rule is removed and git doesn't ignore them anymore
+	for _, filePath := range []string{"audio/intro.wav", "audio/outro.wav"} {
+		if fileExists(app.getFullPath(getGLFLiteFilePath(filePath))) || readTestFile(t, app, filePath) == "" {
+			t.Errorf("%s wasn't untracked", filePath)
+		}
+
+		if !strings.Contains(output, "File "+filePath+" isn't ignored by git anymore") {
+			t.Errorf("the untrack action didn't warn about %s:\n%s", filePath, output)
+		}
+	}
+
+	if strings.Join(app.config.fileRules, ",") != "*.mp4" || strings.Join(app.sortedTrackedFiles, ",") != "videos/intro.mp4" {
+		t.Errorf("the rules are %v and the tracked files %v", app.config.fileRules, app.sortedTrackedFiles)
+	}
+
+	// the committed GLFLite file is removed with git
+	status := runTestGit(t, app, "status", "--porcelain", "--", getGLFLiteFilePath("audio/intro.wav"))
+
+	if status != "D  "+getGLFLiteFilePath("audio/intro.wav")+"\n" {
+		t.Errorf("the removal of the GLFLite file wasn't staged: %s", status)
+	}
+
+	// the files of a rule that is kept are tracked again by the update action
+	output = captureOutput(t, func() {
+		err = app.untrackFiles("videos", false, false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "File videos/intro.mp4 still matches the rules") {
+		t.Errorf("the untrack action didn't warn about the rule:\n%s", output)
+	}
+}
+
+func TestPruneFiles(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"videos/outro.mov": "outro video",
+		"videos/other.mov": "other video",
+	})
+
+	app.config.fileRules = []string{"*.mp4"}
+
+	// the missing files that match the rules aren't orphaned
+	for _, filePath := range []string{"videos/intro.mp4", "videos/outro.mov"} {
+		file := app.trackedFiles[filePath]
+		file.isPresent = false
+		app.trackedFiles[filePath] = file
+	}
+
+	var err error
+
+	for _, answer := range []string{"", "no", "yes"} {
+		answerQuestions(t, answer)
+
+		output := captureOutput(t, func() {
+			err = app.pruneFiles(answer == "")
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(output, "Orphaned GLFLite files: 1\n") {
+			t.Errorf("the prune action printed:\n%s", output)
+		}
+
+		if fileExists(app.getFullPath(getGLFLiteFilePath("videos/outro.mov"))) != (answer != "yes") {
+			t.Errorf("the orphaned GLFLite file exists after the answer %q", answer)
+		}
+	}
+
+	if strings.Join(app.sortedTrackedFiles, ",") != "videos/intro.mp4,videos/other.mov" {
+		t.Errorf("the tracked files are %v", app.sortedTrackedFiles)
+	}
+}
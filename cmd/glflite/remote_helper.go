@@ -0,0 +1,977 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrRemoteObjectNotFound = errors.New("remote object not found")
+
+var ErrRemoteNotSupported = errors.New("the remote doesn't support this action")
+
+var ErrFileChanged = errors.New("the file changed since the GLFLite file was updated")
+
+const localRemoteName = "local"
+
+const partialObjectSuffix = ".partial"
+
+// remoteObject describes a file stored on a remote. Files are stored by their
+// Sha256 sum so that every version of a file is kept only once. The shasum is
+// the Sha256 sum of the stored content when the remote knows it.
+type remoteObject struct {
+	key      string
+	size     int64
+	shasum   string
+	modified time.Time
+}
+
+type remote interface {
+	statObject(key string) (remoteObject, error)
+	putObject(object remoteObject, content io.ReadSeeker) error
+	getObject(key string, offset int64) (io.ReadCloser, error)
+	listObjects() ([]remoteObject, error)
+	deleteObject(key string) error
+	close() error
+}
+
+// remoteConnection is an open remote with the settings used to store the
+// objects on it.
+type remoteConnection struct {
+	remote
+	cipher *objectCipher
+}
+
+// getObjectPath returns the path of an object inside a remote folder, the
+// objects are split in subfolders to avoid having too many files in a folder.
+func getObjectPath(key string) string {
+	if len(key) < 4 {
+		return key
+	}
+
+	return key[0:2] + "/" + key[2:4] + "/" + key
+}
+
+// isShasum tells if a string is a Sha256 sum in lowercase hexadecimal.
+func isShasum(shaSum string) bool {
+	if len(shaSum) != sha256.Size*2 {
+		return false
+	}
+
+	for _, char := range shaSum {
+		if !(char >= '0' && char <= '9' || char >= 'a' && char <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isObjectKey tells if a name is the one of an object: a Sha256 sum, or its
+// HMAC on the remotes with encryption, with the suffix of the compressed
+// objects or of the partial uploads. The other files of a remote aren't
+// objects, so gc never deletes them.
+func isObjectKey(key string) bool {
+	key = strings.TrimSuffix(key, partialObjectSuffix)
+	key = strings.TrimSuffix(key, compressedObjectSuffix)
+
+	return isShasum(key)
+}
+
+func (app *application) getStateFolder() string {
+	return app.config.gitDirectory + "/glflite"
+}
+
+// getLocalStoreFolder returns the folder of the local remote, it keeps the
+// versions of the files pushed to it inside the .git folder. The worktrees of
+// a repository share it.
+func (app *application) getLocalStoreFolder() string {
+	return app.config.commonDirectory + "/glflite/objects"
+}
+
+// getRemoteConfig returns the settings of a remote of the setup file, if
+// there isn't a remote with that name, the name is used as the remote URL.
+func (app *application) getRemoteConfig(remoteName string) (remoteConfig, error) {
+	if remoteName == "" {
+		remoteName = app.config.setup.DefaultRemote
+	}
+
+	if remoteName == "" {
+		return remoteConfig{}, errors.New("No remote specified. Use the -remote flag or set default_remote in the " + setupFile + " file.")
+	}
+
+	if remoteData, ok := app.config.setup.Remotes[remoteName]; ok {
+		remoteData.Name = remoteName
+
+		return remoteData, nil
+	}
+
+	if remoteName == localRemoteName {
+		err := os.MkdirAll(app.getLocalStoreFolder(), 0755)
+
+		if err != nil {
+			return remoteConfig{}, err
+		}
+
+		return remoteConfig{Name: remoteName, URL: app.getLocalStoreFolder()}, nil
+	}
+
+	return remoteConfig{Name: remoteName, URL: remoteName}, nil
+}
+
+func getKeyFile(remoteData remoteConfig) (string, error) {
+	if remoteData.KeyFile != "" {
+		homeFolder, err := os.UserHomeDir()
+
+		if err != nil {
+			return "", err
+		}
+
+		return expandHomeFolder(remoteData.KeyFile, homeFolder), nil
+	}
+
+	return getDefaultKeyFile(remoteData.Name)
+}
+
+func (app *application) openRemote(remoteName string) (*remoteConnection, error) {
+	remoteData, err := app.getRemoteConfig(remoteName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &remoteConnection{}
+
+	if remoteData.Encrypt {
+		keyFile, err := getKeyFile(remoteData)
+
+		if err != nil {
+			return nil, err
+		}
+
+		conn.cipher, err = readObjectCipher(keyFile)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parsedURL, err := url.Parse(remoteData.URL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsedURL.Scheme {
+	case "sftp", "ssh":
+		conn.remote, err = newSFTPRemote(parsedURL)
+	case "s3":
+		conn.remote, err = newS3Remote(parsedURL, remoteData)
+	case "http", "https":
+		var token string
+
+		token, err = app.getHTTPRemoteToken(remoteData)
+
+		if err == nil {
+			conn.remote, err = newHTTPRemote(parsedURL, token)
+		}
+	case "file":
+		conn.remote, err = newFolderRemote(parsedURL.Path)
+	case "":
+		conn.remote, err = newFolderRemote(remoteData.URL)
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported remote %s", remoteData.URL))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// getObjectKey returns the name of the object of a file on the remote.
+func (c *remoteConnection) getObjectKey(shaSum string) string {
+	if c.cipher != nil {
+		return c.cipher.getObjectKey(shaSum)
+	}
+
+	return shaSum
+}
+
+// getStoredSize returns the size of the object of a file on the remote, the
+// size of the compressed objects is only known once they are compressed.
+func (c *remoteConnection) getStoredSize(size int64) int64 {
+	if c.cipher != nil {
+		return c.cipher.getEncryptedSize(size)
+	}
+
+	return size
+}
+
+func isCompressedObject(object remoteObject) bool {
+	return strings.HasSuffix(object.key, compressedObjectSuffix)
+}
+
+// hasValidSize tells if the size of an object is the expected for a file.
+// The size of the compressed objects is only known once they are compressed,
+// they have to hold at least a zstd frame, and nothing for an empty file.
+func (c *remoteConnection) hasValidSize(object remoteObject, size int64) bool {
+	if !isCompressedObject(object) || size == 0 {
+		return object.size == c.getStoredSize(size)
+	}
+
+	return object.size >= c.getStoredSize(minimumCompressedSize)
+}
+
+// hasValidHeader reads the start of a compressed object to verify that it is
+// a zstd frame, or an encrypted object on the remotes with encryption.
+func (c *remoteConnection) hasValidHeader(object remoteObject) (bool, error) {
+	if object.size == 0 {
+		return true, nil
+	}
+
+	header := zstdMagic
+
+	if c.cipher != nil {
+		header = []byte(encryptionMagic)
+	}
+
+	content, err := c.getObject(object.key, 0)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer content.Close()
+
+	start := make([]byte, len(header))
+
+	_, err = io.ReadFull(content, start)
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(start, header), nil
+}
+
+// findObject returns the object of a file, compressed or not.
+func (c *remoteConnection) findObject(shaSum string) (remoteObject, error) {
+	key := c.getObjectKey(shaSum)
+
+	object, err := c.statObject(key)
+
+	if !errors.Is(err, ErrRemoteObjectNotFound) {
+		return object, err
+	}
+
+	return c.statObject(key + compressedObjectSuffix)
+}
+
+// encodeObject writes the content stored on the remote, the files are
+// compressed before they are encrypted.
+func (c *remoteConnection) encodeObject(object remoteObject, compressionLevel int, destination io.Writer, source io.Reader) error {
+	if !isCompressedObject(object) {
+		return c.cipher.encrypt(object.key, destination, source)
+	}
+
+	if c.cipher == nil {
+		return compressContent(compressionLevel, destination, source)
+	}
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(compressContent(compressionLevel, writer, source))
+	}()
+
+	err := c.cipher.encrypt(object.key, destination, reader)
+
+	reader.Close()
+
+	return err
+}
+
+// decodeObject writes the original content of an object.
+func (c *remoteConnection) decodeObject(object remoteObject, destination io.Writer, source io.Reader) error {
+	if !isCompressedObject(object) {
+		if c.cipher == nil {
+			_, err := io.Copy(destination, source)
+			return err
+		}
+
+		return c.cipher.decrypt(object.key, destination, source)
+	}
+
+	if c.cipher == nil {
+		return decompressContent(destination, source)
+	}
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(c.cipher.decrypt(object.key, writer, source))
+	}()
+
+	err := decompressContent(destination, reader)
+
+	reader.Close()
+
+	return err
+}
+
+// prepareObject returns the content to upload for a file after verifying
+// that it didn't change since the GLFLite file was updated. Compressed and
+// encrypted objects are written to the state folder and kept until the upload
+// succeeds, so an interrupted upload is resumed with the same content.
+func (app *application) prepareObject(conn *remoteConnection, filePath string, data fileData) (remoteObject, *os.File, error) {
+	object := remoteObject{
+		key:    conn.getObjectKey(data.Sha256Sum),
+		size:   data.Size,
+		shasum: data.Sha256Sum,
+	}
+
+	if app.shouldCompress(filePath) {
+		object.key += compressedObjectSuffix
+	}
+
+	if conn.cipher == nil && !isCompressedObject(object) {
+		shaSum, err := app.getFileShasum(filePath)
+
+		if err != nil {
+			return object, nil, err
+		}
+
+		if shaSum != data.Sha256Sum {
+			return object, nil, ErrFileChanged
+		}
+
+		content, err := os.Open(app.getFullPath(filePath))
+
+		return object, content, err
+	}
+
+	tmpFolder := app.getStateFolder() + "/tmp"
+
+	err := os.MkdirAll(tmpFolder, 0755)
+
+	if err != nil {
+		return object, nil, err
+	}
+
+	objectFile := tmpFolder + "/" + object.key + ".encoded"
+
+	if !fileExists(objectFile) {
+		source, err := os.Open(app.getFullPath(filePath))
+
+		if err != nil {
+			return object, nil, err
+		}
+
+		defer source.Close()
+
+		destination, err := os.Create(objectFile + ".tmp")
+
+		if err != nil {
+			return object, nil, err
+		}
+
+		hash := sha256.New()
+
+		err = conn.encodeObject(object, app.config.setup.CompressionLevel, destination, io.TeeReader(source, hash))
+
+		if err == nil {
+			err = destination.Close()
+		} else {
+			destination.Close()
+		}
+
+		if err == nil && fmt.Sprintf("%x", hash.Sum(nil)) != data.Sha256Sum {
+			err = ErrFileChanged
+		}
+
+		if err != nil {
+			os.Remove(objectFile + ".tmp")
+			return object, nil, err
+		}
+
+		err = os.Rename(objectFile+".tmp", objectFile)
+
+		if err != nil {
+			return object, nil, err
+		}
+	}
+
+	info, err := os.Stat(objectFile)
+
+	if err != nil {
+		return object, nil, err
+	}
+
+	object.size = info.Size()
+
+	// the Sha256 sum of the encrypted content doesn't reveal the one of the file
+	object.shasum, err = getShasum(objectFile)
+
+	if err != nil {
+		return object, nil, err
+	}
+
+	content, err := os.Open(objectFile)
+
+	return object, content, err
+}
+
+func (app *application) pushFiles(conn *remoteConnection) error {
+	filesPushed := 0
+	filesSkipped := 0
+	filesFailed := 0
+
+	var pushedSize int64
+	var storedSize int64
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent || isLink(app.getFullPath(fileFullPath)) {
+			continue
+		}
+
+		data, err := app.readJSONFile(fileFullPath)
+
+		if errors.Is(err, ErrGLFLiteFileNotFound) {
+			if app.verbose {
+				fmt.Printf("File %s is missing the GLFLite file. Run the update action first.\n", app.getDisplayPath(fileFullPath))
+			}
+
+			filesFailed++
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		object, err := conn.findObject(data.Sha256Sum)
+
+		if err == nil && conn.hasValidSize(object, data.Size) {
+			if app.verbose {
+				fmt.Printf("File %s is already on the remote.\n", app.getDisplayPath(fileFullPath))
+			}
+
+			filesSkipped++
+			continue
+		} else if err != nil && !errors.Is(err, ErrRemoteObjectNotFound) {
+			return err
+		}
+
+		if app.verbose {
+			fmt.Printf("Pushing %s\n", app.getDisplayPath(fileFullPath))
+		}
+
+		object, content, err := app.prepareObject(conn, fileFullPath, data)
+
+		if errors.Is(err, ErrFileChanged) {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printRed("Not up to date, run the update action before pushing it")
+
+			filesFailed++
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		err = conn.putObject(object, content)
+
+		content.Close()
+
+		if err != nil {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printRed(err.Error())
+
+			filesFailed++
+			continue
+		}
+
+		if content.Name() != app.getFullPath(fileFullPath) {
+			os.Remove(content.Name())
+		}
+
+		pushedSize += data.Size
+		storedSize += object.size
+
+		filesPushed++
+	}
+
+	fmt.Printf("Files pushed: ")
+	printGreen(strconv.Itoa(filesPushed))
+
+	fmt.Printf("Files already on the remote: ")
+	printGreen(strconv.Itoa(filesSkipped))
+
+	fmt.Printf("Files failed: ")
+	printRed(strconv.Itoa(filesFailed))
+
+	if len(app.config.setup.Compress) > 0 {
+		printCompressionSummary(pushedSize, storedSize)
+	}
+
+	return nil
+}
+
+func printCompressionSummary(filesSize int64, storedSize int64) {
+	fmt.Printf("Size of the files: %s, size on the remote: %s\n", formatSize(filesSize), formatSize(storedSize))
+
+	if filesSize > 0 && storedSize < filesSize {
+		fmt.Printf("Space saved by compression: ")
+		printGreen(fmt.Sprintf("%s (%.1f%%)", formatSize(filesSize-storedSize), float64(filesSize-storedSize)*100/float64(filesSize)))
+	}
+}
+
+// checkRemote confirms that the files are stored on the remote. With force,
+// the files are downloaded to verify their Sha256 sum, encrypted files are
+// decrypted in memory without writing them to the disk.
+func (app *application) checkRemote(conn *remoteConnection, force bool) error {
+	filesOnRemote := 0
+	filesNotOnRemote := 0
+	filesCorrupted := 0
+
+	var filesSize int64
+	var storedSize int64
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		// the file can be modified and not updated yet, the remote has the version of the GLFLite file
+		data, err := app.readJSONFile(fileFullPath)
+
+		if errors.Is(err, ErrGLFLiteFileNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		object, err := conn.findObject(data.Sha256Sum)
+
+		if errors.Is(err, ErrRemoteObjectNotFound) {
+			if app.verbose {
+				fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+				printRed("Not on the remote")
+			}
+
+			filesNotOnRemote++
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		isValid := conn.hasValidSize(object, data.Size)
+
+		if conn.cipher == nil && !isCompressedObject(object) && object.shasum != "" && object.shasum != data.Sha256Sum {
+			isValid = false
+		}
+
+		// the size of the compressed objects isn't known, their header is checked
+		if isValid && !force && isCompressedObject(object) {
+			isValid, err = conn.hasValidHeader(object)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if isValid && force {
+			content, err := conn.getObject(object.key, 0)
+
+			if err != nil {
+				return err
+			}
+
+			hash := sha256.New()
+
+			err = conn.decodeObject(object, hash, content)
+
+			content.Close()
+
+			if err != nil && app.verbose {
+				fmt.Printf("%s: %s\n", app.getDisplayPath(fileFullPath), err.Error())
+			}
+
+			isValid = err == nil && fmt.Sprintf("%x", hash.Sum(nil)) == data.Sha256Sum
+		}
+
+		if !isValid {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printRed("Corrupted on the remote")
+
+			filesCorrupted++
+			continue
+		}
+
+		if app.verbose {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printGreen("On the remote")
+		}
+
+		filesSize += data.Size
+		storedSize += object.size
+
+		filesOnRemote++
+	}
+
+	fmt.Printf("Files on the remote: ")
+	printGreen(strconv.Itoa(filesOnRemote))
+
+	fmt.Printf("Files not on the remote: ")
+	printRed(strconv.Itoa(filesNotOnRemote))
+
+	fmt.Printf("Files corrupted on the remote: ")
+	printRed(strconv.Itoa(filesCorrupted))
+
+	if len(app.config.setup.Compress) > 0 {
+		printCompressionSummary(filesSize, storedSize)
+	}
+
+	return nil
+}
+
+func (app *application) pullFiles(conn *remoteConnection) error {
+	filesPulled := 0
+	filesNotFound := 0
+	filesFailed := 0
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if file.isPresent {
+			continue
+		}
+
+		data, err := app.readJSONFile(fileFullPath)
+
+		if err != nil {
+			return err
+		}
+
+		if app.verbose {
+			fmt.Printf("Pulling %s\n", app.getDisplayPath(fileFullPath))
+		}
+
+		err = app.pullFile(conn, fileFullPath, data)
+
+		if errors.Is(err, ErrRemoteObjectNotFound) {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printRed("Not found on the remote")
+
+			filesNotFound++
+			continue
+		} else if err != nil {
+			fmt.Printf("%s: ", app.getDisplayPath(fileFullPath))
+			printRed(err.Error())
+
+			filesFailed++
+			continue
+		}
+
+		file.isPresent = true
+		file.isUpToDate = true
+		file.shasum = data.Sha256Sum
+		app.trackedFiles[fileFullPath] = file
+
+		filesPulled++
+	}
+
+	fmt.Printf("Files pulled: ")
+	printGreen(strconv.Itoa(filesPulled))
+
+	fmt.Printf("Files not found on the remote: ")
+	printRed(strconv.Itoa(filesNotFound))
+
+	fmt.Printf("Files failed: ")
+	printRed(strconv.Itoa(filesFailed))
+
+	return nil
+}
+
+// downloadObject downloads an object to a partial file, if the partial file
+// already exists the download continues from its end.
+func downloadObject(r remote, object remoteObject, partialFile string) error {
+	file, err := os.OpenFile(partialFile, os.O_RDWR|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return err
+	}
+
+	if offset > object.size {
+		err = file.Truncate(0)
+
+		if err != nil {
+			return err
+		}
+
+		offset, err = file.Seek(0, io.SeekStart)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if offset < object.size {
+		content, err := r.getObject(object.key, offset)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, content)
+
+		content.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return file.Close()
+}
+
+// pullFile downloads a file to a partial file in the state folder so that an
+// interrupted download can be resumed, and moves it to its place once its
+// Sha256 sum matches the one in the GLFLite file.
+func (app *application) pullFile(conn *remoteConnection, filePath string, data fileData) error {
+	object, err := conn.findObject(data.Sha256Sum)
+
+	if err != nil {
+		return err
+	}
+
+	if !conn.hasValidSize(object, data.Size) {
+		return errors.New(fmt.Sprintf("the remote file size is %d, expected %d", object.size, conn.getStoredSize(data.Size)))
+	}
+
+	tmpFolder := app.getStateFolder() + "/tmp"
+
+	err = os.MkdirAll(tmpFolder, 0755)
+
+	if err != nil {
+		return err
+	}
+
+	partialFile := tmpFolder + "/" + object.key + ".partial"
+
+	if object.size > 0 && app.verbose && fileExists(partialFile) {
+		fmt.Printf("Resuming download of %s\n", filePath)
+	}
+
+	err = downloadObject(conn, object, partialFile)
+
+	if err != nil {
+		return err
+	}
+
+	downloadedFile := partialFile
+
+	if conn.cipher != nil || isCompressedObject(object) {
+		downloadedFile = tmpFolder + "/" + object.key + ".decoded"
+
+		err = conn.decodeFile(object, partialFile, downloadedFile)
+
+		if err != nil {
+			os.Remove(partialFile)
+			os.Remove(downloadedFile)
+			return err
+		}
+
+		os.Remove(partialFile)
+	}
+
+	shaSum, err := getShasum(downloadedFile)
+
+	if err != nil {
+		return err
+	}
+
+	if shaSum != data.Sha256Sum {
+		os.Remove(downloadedFile)
+
+		return errors.New(fmt.Sprintf("the Sha256 sum of the downloaded file is %s, expected %s", shaSum, data.Sha256Sum))
+	}
+
+	fullPath := app.getFullPath(filePath)
+
+	err = os.MkdirAll(filepath.Dir(fullPath), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(downloadedFile, fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(fullPath, data.LastModified, data.LastModified)
+}
+
+func (c *remoteConnection) decodeFile(object remoteObject, source string, destination string) error {
+	sourceFile, err := os.Open(source)
+
+	if err != nil {
+		return err
+	}
+
+	defer sourceFile.Close()
+
+	destinationFile, err := os.Create(destination)
+
+	if err != nil {
+		return err
+	}
+
+	err = c.decodeObject(object, destinationFile, sourceFile)
+
+	if err != nil {
+		destinationFile.Close()
+		return err
+	}
+
+	return destinationFile.Close()
+}
+
+// folderRemote stores the files in a local folder, like an external drive.
+type folderRemote struct {
+	folder string
+}
+
+func newFolderRemote(folder string) (*folderRemote, error) {
+	if !isDirectory(folder) {
+		return nil, errors.New(fmt.Sprintf("The remote folder %s doesn't exist", folder))
+	}
+
+	return &folderRemote{folder: folder}, nil
+}
+
+func (r *folderRemote) statObject(key string) (remoteObject, error) {
+	info, err := os.Stat(r.folder + "/" + getObjectPath(key))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return remoteObject{}, ErrRemoteObjectNotFound
+	} else if err != nil {
+		return remoteObject{}, err
+	}
+
+	return remoteObject{key: key, size: info.Size(), modified: info.ModTime()}, nil
+}
+
+func (r *folderRemote) putObject(object remoteObject, content io.ReadSeeker) error {
+	objectFile := r.folder + "/" + getObjectPath(object.key)
+
+	err := os.MkdirAll(filepath.Dir(objectFile), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(objectFile + partialObjectSuffix)
+
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(file, content)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if written != object.size {
+		return errors.New(fmt.Sprintf("wrote %d bytes, expected %d", written, object.size))
+	}
+
+	return os.Rename(objectFile+partialObjectSuffix, objectFile)
+}
+
+func (r *folderRemote) getObject(key string, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(r.folder + "/" + getObjectPath(key))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRemoteObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// listObjects returns the objects stored in the subfolders of the remote
+// folder, including the partial uploads.
+func (r *folderRemote) listObjects() ([]remoteObject, error) {
+	var objects []remoteObject
+
+	err := filepath.WalkDir(r.folder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(r.folder, path)
+
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || getObjectPath(entry.Name()) != filepath.ToSlash(relativePath) || !isObjectKey(entry.Name()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, remoteObject{key: entry.Name(), size: info.Size(), modified: info.ModTime()})
+
+		return nil
+	})
+
+	return objects, err
+}
+
+func (r *folderRemote) deleteObject(key string) error {
+	return os.Remove(r.folder + "/" + getObjectPath(key))
+}
+
+func (r *folderRemote) close() error {
+	return nil
+}
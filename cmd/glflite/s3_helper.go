@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const defaultMultipartThreshold = 64
+
+// s3Remote stores the files in a bucket of an S3 compatible object storage,
+// the URL is s3://bucket/prefix and the credentials are read from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables or from
+// the ~/.aws/credentials file.
+type s3Remote struct {
+	client             *minio.Client
+	bucket             string
+	prefix             string
+	storageClass       string
+	multipartThreshold int64
+}
+
+func newS3Remote(remoteURL *url.URL, remoteData remoteConfig) (*s3Remote, error) {
+	endpoint := remoteData.Endpoint
+	secure := true
+
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	if strings.HasPrefix(endpoint, "http://") {
+		secure = false
+	}
+
+	endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{Profile: remoteData.Profile},
+	})
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: remoteData.Region,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	multipartThreshold := remoteData.MultipartThreshold
+
+	if multipartThreshold <= 0 {
+		multipartThreshold = defaultMultipartThreshold
+	}
+
+	// S3 doesn't accept parts smaller than 5 MB
+	if multipartThreshold < 5 {
+		multipartThreshold = 5
+	}
+
+	prefix := strings.Trim(remoteURL.Path, "/")
+
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Remote{
+		client:             client,
+		bucket:             remoteURL.Host,
+		prefix:             prefix,
+		storageClass:       remoteData.StorageClass,
+		multipartThreshold: multipartThreshold * 1024 * 1024,
+	}, nil
+}
+
+func (r *s3Remote) getObjectName(key string) string {
+	return r.prefix + key
+}
+
+func isS3NotFound(err error) bool {
+	response := minio.ToErrorResponse(err)
+
+	return response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey"
+}
+
+func (r *s3Remote) statObject(key string) (remoteObject, error) {
+	info, err := r.client.StatObject(context.Background(), r.bucket, r.getObjectName(key), minio.StatObjectOptions{})
+
+	if isS3NotFound(err) {
+		return remoteObject{}, ErrRemoteObjectNotFound
+	} else if err != nil {
+		return remoteObject{}, err
+	}
+
+	return remoteObject{
+		key:      key,
+		size:     info.Size,
+		shasum:   info.UserMetadata["Sha256"],
+		modified: info.LastModified,
+	}, nil
+}
+
+// putObject uploads the file in a single request with the Sha256 sum in the
+// checksum header so that the server verifies it. Files bigger than the
+// multipart threshold are uploaded in parts, each with its own Sha256 checksum.
+func (r *s3Remote) putObject(object remoteObject, content io.ReadSeeker) error {
+	_, err := content.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return err
+	}
+
+	opts := minio.PutObjectOptions{
+		StorageClass: r.storageClass,
+		UserMetadata: map[string]string{"Sha256": object.shasum},
+		PartSize:     uint64(r.multipartThreshold),
+	}
+
+	if object.size <= r.multipartThreshold {
+		shaSum, err := hex.DecodeString(object.shasum)
+
+		if err != nil {
+			return err
+		}
+
+		opts.DisableMultipart = true
+		opts.UserMetadata["x-amz-checksum-sha256"] = base64.StdEncoding.EncodeToString(shaSum)
+	} else {
+		opts.AutoChecksum = minio.ChecksumSHA256
+	}
+
+	// S3 accepts up to 10000 parts, let the client choose the part size for huge files
+	if object.size/r.multipartThreshold >= 10000 {
+		opts.PartSize = 0
+	}
+
+	_, err = r.client.PutObject(context.Background(), r.bucket, r.getObjectName(object.key), content, object.size, opts)
+
+	return err
+}
+
+func (r *s3Remote) getObject(key string, offset int64) (io.ReadCloser, error) {
+	object, err := r.client.GetObject(context.Background(), r.bucket, r.getObjectName(key), minio.GetObjectOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the request is sent on the first read, stat it to find out if the object exists
+	_, err = object.Stat()
+
+	if isS3NotFound(err) {
+		object.Close()
+		return nil, ErrRemoteObjectNotFound
+	} else if err != nil {
+		object.Close()
+		return nil, err
+	}
+
+	_, err = object.Seek(offset, io.SeekStart)
+
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func (r *s3Remote) listObjects() ([]remoteObject, error) {
+	var objects []remoteObject
+
+	for object := range r.client.ListObjects(context.Background(), r.bucket, minio.ListObjectsOptions{Prefix: r.prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		key := strings.TrimPrefix(object.Key, r.prefix)
+
+		// the bucket or the prefix can be shared with other data, only the objects are listed
+		if strings.Contains(key, "/") || !isObjectKey(key) {
+			continue
+		}
+
+		objects = append(objects, remoteObject{key: key, size: object.Size, modified: object.LastModified})
+	}
+
+	return objects, nil
+}
+
+func (r *s3Remote) deleteObject(key string) error {
+	return r.client.RemoveObject(context.Background(), r.bucket, r.getObjectName(key), minio.RemoveObjectOptions{})
+}
+
+func (r *s3Remote) close() error {
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+const testBucket = "glflite"
+
+// startTestS3Server starts a fake S3 server with an empty bucket and adds it
+// to the remotes of the setup file of the application as "offsite", with the
+// objects under the backups/ prefix.
+func startTestS3Server(t *testing.T, app *application) *s3mem.Backend {
+	t.Helper()
+
+	backend := s3mem.New()
+
+	err := backend.CreateBucket(testBucket)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(fixTestS3Requests(gofakes3.New(backend).Server()))
+
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "glflite")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "glflite-secret")
+
+	app.config.setup.Remotes = map[string]remoteConfig{
+		"offsite": {
+			URL:                "s3://" + testBucket + "/backups",
+			Endpoint:           server.URL,
+			Region:             "us-east-1",
+			MultipartThreshold: 5,
+		},
+	}
+
+	return backend
+}
+
+// fixTestS3Requests adapts the requests of minio-go to the fake server like
+// S3 reads them: the empty delimiter of the recursive listings is no
+// delimiter, and the aws-chunked bodies sent over http are decoded, the fake
+// server only decodes the single uploads without a trailing checksum.
+func fixTestS3Requests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if _, ok := query["delimiter"]; ok && query.Get("delimiter") == "" {
+			query.Del("delimiter")
+			r.URL.RawQuery = query.Encode()
+		}
+
+		if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		var body bytes.Buffer
+
+		reader := bufio.NewReader(r.Body)
+
+		for {
+			// each chunk is "<hex size>[;chunk-signature=<signature>]\r\n<data>\r\n", the last one is empty
+			line, err := reader.ReadString('\n')
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			size, err := strconv.ParseInt(strings.TrimSpace(strings.Split(line, ";")[0]), 16, 64)
+
+			if err == nil && size > 0 {
+				_, err = io.CopyN(&body, reader, size+2)
+				body.Truncate(body.Len() - 2)
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if size == 0 {
+				break
+			}
+		}
+
+		r.Body = io.NopCloser(&body)
+		r.ContentLength = int64(body.Len())
+		r.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+		r.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+		r.Header.Del("X-Amz-Decoded-Content-Length")
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func openTestS3Remote(t *testing.T, app *application) *remoteConnection {
+	t.Helper()
+
+	conn, err := app.openRemote("offsite")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.close()
+	})
+
+	return conn
+}
+
+func putTestS3Object(t *testing.T, backend *s3mem.Backend, key string, content string) {
+	t.Helper()
+
+	metadata := map[string]string{"Last-Modified": time.Now().UTC().Format(http.TimeFormat)}
+
+	_, err := backend.PutObject(testBucket, "backups/"+key, metadata, bytes.NewReader([]byte(content)), int64(len(content)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3PushAndPull(t *testing.T) {
+	// the big file is uploaded in parts of 5 MB
+	files := map[string]string{
+		"videos/intro.mp4": strings.Repeat("intro video ", 1024*1024),
+		"photos/cover.raw": "cover photo",
+	}
+
+	app := newTestApplication(t, files)
+	startTestS3Server(t, app)
+	conn := openTestS3Remote(t, app)
+
+	err := app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		object, err := conn.statObject(getTestShasum(content))
+
+		if err != nil {
+			t.Fatalf("the object of %s wasn't pushed: %s", filePath, err.Error())
+		}
+
+		if object.size != int64(len(content)) || object.shasum != getTestShasum(content) {
+			t.Errorf("the object of %s has the size %d and the Sha256 sum %s", filePath, object.size, object.shasum)
+		}
+
+		err = os.Remove(app.getFullPath(filePath))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := app.trackedFiles[filePath]
+		file.isPresent = false
+		app.trackedFiles[filePath] = file
+	}
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		if readTestFile(t, app, filePath) != content {
+			t.Errorf("%s wasn't pulled", filePath)
+		}
+	}
+}
+
+func TestS3PullVerifiesShasum(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"intro.mp4": "intro video"})
+	backend := startTestS3Server(t, app)
+	conn := openTestS3Remote(t, app)
+
+	// an object of the right size with another content
+	putTestS3Object(t, backend, getTestShasum("intro video"), "INTRO VIDEO")
+
+	err := os.Remove(app.getFullPath("intro.mp4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["intro.mp4"]
+	file.isPresent = false
+	app.trackedFiles["intro.mp4"] = file
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileExists(app.getFullPath("intro.mp4")) {
+		t.Error("the corrupted object was pulled")
+	}
+}
+
+func TestS3CheckRemote(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"intro.mp4": "intro video",
+		"outro.mp4": "outro video",
+		"cover.raw": "cover photo",
+	})
+
+	backend := startTestS3Server(t, app)
+	conn := openTestS3Remote(t, app)
+
+	err := app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote has the version of the GLFLite file, the new version isn't updated yet
+	file := app.trackedFiles["intro.mp4"]
+	file.file = writeTestFile(t, app, "intro.mp4", "intro video, second version")
+	app.trackedFiles["intro.mp4"] = file
+
+	// the upload of this object was cut, and this one was deleted
+	putTestS3Object(t, backend, getTestShasum("outro video"), "outro")
+
+	_, err = backend.DeleteObject(testBucket, "backups/"+getTestShasum("cover photo"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureOutput(t, func() {
+		err = app.checkRemote(conn, false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, summary := range []string{"Files on the remote: 1\n", "Files not on the remote: 1\n", "Files corrupted on the remote: 1\n", "outro.mp4: Corrupted on the remote\n"} {
+		if !strings.Contains(output, summary) {
+			t.Errorf("the check of the remote didn't print %q:\n%s", summary, output)
+		}
+	}
+
+	// the content is verified with force
+	putTestS3Object(t, backend, getTestShasum("outro video"), "OUTRO VIDEO")
+
+	output = captureOutput(t, func() {
+		err = app.checkRemote(conn, true)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "Files corrupted on the remote: 1\n") {
+		t.Errorf("the check of the remote with force didn't find the corrupted object:\n%s", output)
+	}
+}
+
+func TestS3ListObjectsSkipsOtherData(t *testing.T) {
+	app := newTestApplication(t, nil)
+	backend := startTestS3Server(t, app)
+
+	// the bucket has other data next to the objects, with and without the prefix
+	shaSum := getTestShasum("intro video")
+
+	for _, key := range []string{shaSum, shaSum + compressedObjectSuffix, "notes.txt", "report-2024.pdf", strings.ToUpper(shaSum), "archive/" + shaSum} {
+		putTestS3Object(t, backend, key, "content")
+	}
+
+	_, err := backend.PutObject(testBucket, "photos/cover.raw", map[string]string{}, strings.NewReader("cover"), 5)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, remotePath := range []string{"/backups", ""} {
+		app.config.setup.Remotes["offsite"] = remoteConfig{
+			URL:      "s3://" + testBucket + remotePath,
+			Endpoint: app.config.setup.Remotes["offsite"].Endpoint,
+			Region:   "us-east-1",
+		}
+
+		conn := openTestS3Remote(t, app)
+
+		objects, err := conn.listObjects()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var keys []string
+
+		for _, object := range objects {
+			keys = append(keys, object.key)
+		}
+
+		expected := []string{shaSum, shaSum + compressedObjectSuffix}
+
+		if remotePath == "" {
+			expected = nil
+		}
+
+		if strings.Join(keys, ",") != strings.Join(expected, ",") {
+			t.Errorf("the objects of s3://%s%s are %v, expected %v", testBucket, remotePath, keys, expected)
+		}
+	}
+}
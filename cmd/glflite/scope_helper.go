@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// scopePattern selects the files of a folder of the repository with a path
+// or a pattern relative to that folder, like the pathspecs of git. The
+// patterns without a folder match at any depth of the folder.
+type scopePattern struct {
+	folder  string
+	pattern string
+}
+
+func (s scopePattern) matches(filePath string) bool {
+	if s.folder != "" {
+		if filePath != s.folder && !strings.HasPrefix(filePath, s.folder+"/") {
+			return false
+		}
+
+		filePath = strings.TrimPrefix(strings.TrimPrefix(filePath, s.folder), "/")
+	}
+
+	return s.pattern == "." || matchesFilePattern(s.pattern, filePath)
+}
+
+// isInScope tells if a file is selected by one of the patterns of the scope,
+// all the files are selected when the scope is empty.
+func isInScope(scope []scopePattern, filePath string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+
+	for _, pattern := range scope {
+		if pattern.matches(filePath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canHaveFilesInScope tells if a folder can contain files selected by the
+// scope, the other folders aren't walked.
+func canHaveFilesInScope(scope []scopePattern, folder string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+
+	for _, pattern := range scope {
+		if pattern.canMatchInFolder(folder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canMatchInFolder tells if the pattern can select a file inside a folder,
+// like matchesFilePattern selects them.
+func (s scopePattern) canMatchInFolder(folder string) bool {
+	if s.folder != "" {
+		// the folder of the pattern is inside the folder
+		if folder == s.folder || strings.HasPrefix(s.folder, folder+"/") {
+			return true
+		}
+
+		if !strings.HasPrefix(folder, s.folder+"/") {
+			return false
+		}
+
+		folder = strings.TrimPrefix(folder, s.folder+"/")
+	}
+
+	pattern := strings.TrimSuffix(cleanHistoryPath(s.pattern), "/")
+
+	if pattern == "." || folder == pattern || strings.HasPrefix(folder, pattern+"/") || strings.HasPrefix(pattern, folder+"/") {
+		return true
+	}
+
+	if !isGlobPattern(pattern) {
+		return false
+	}
+
+	// the patterns that start with * match the files of any folder
+	if strings.HasPrefix(pattern, "*") {
+		return true
+	}
+
+	// the other patterns match the paths with as many parts, * doesn't match a /
+	patternParts := strings.Split(pattern, "/")
+	folderParts := strings.Split(folder, "/")
+
+	if len(folderParts) >= len(patternParts) {
+		return false
+	}
+
+	for i, part := range folderParts {
+		if matched, _ := path.Match(patternParts[i], part); !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isGlobPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// resolvePath returns a path given on the command line relative to the root
+// folder, the relative paths are relative to the current folder.
+func (app *application) resolvePath(filePath string) (string, error) {
+	if filepath.IsAbs(filePath) {
+		relativePath, err := filepath.Rel(app.config.rootFolder, filePath)
+
+		if err != nil {
+			return "", err
+		}
+
+		filePath = relativePath
+	} else {
+		filePath = path.Join(app.config.currentFolder, filepath.ToSlash(filePath))
+	}
+
+	cleanPath := cleanHistoryPath(filePath)
+
+	if cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		return "", errors.New(fmt.Sprintf("%s is outside of the repository", filePath))
+	}
+
+	return cleanPath, nil
+}
+
+// getScope returns the files, folders and patterns given to a command. The
+// current folder is selected when none is given.
+func (app *application) getScope(patterns []string) ([]scopePattern, error) {
+	var scope []scopePattern
+
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+
+		cleanPattern, err := app.resolvePath(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !isGlobPattern(cleanPattern) {
+			scope = append(scope, scopePattern{pattern: cleanPattern})
+			continue
+		}
+
+		// the folders before the first glob are the folder of the pattern
+		segments := strings.Split(cleanPattern, "/")
+
+		folderSegments := 0
+
+		for folderSegments < len(segments)-1 && !isGlobPattern(segments[folderSegments]) {
+			folderSegments++
+		}
+
+		scope = append(scope, scopePattern{
+			folder:  strings.Join(segments[:folderSegments], "/"),
+			pattern: strings.Join(segments[folderSegments:], "/"),
+		})
+	}
+
+	if len(scope) == 0 && app.config.currentFolder != "" {
+		scope = append(scope, scopePattern{pattern: app.config.currentFolder})
+	}
+
+	return scope, nil
+}
+
+// getWalkPaths returns the files and folders to walk to find the files of
+// the scope, relative to the root folder and starting with a slash.
+func getWalkPaths(folder string, scope []scopePattern) ([]string, error) {
+	if len(scope) == 0 {
+		return []string{""}, nil
+	}
+
+	var walkPaths []string
+
+	for _, pattern := range scope {
+		if pattern.pattern == "." && pattern.folder == "" {
+			return []string{""}, nil
+		}
+
+		if isGlobPattern(pattern.pattern) {
+			if pattern.folder == "" {
+				return []string{""}, nil
+			}
+
+			if isDirectory(folder + "/" + pattern.folder) {
+				walkPaths = append(walkPaths, "/"+pattern.folder)
+			}
+
+			continue
+		}
+
+		found := false
+
+		// the GLFLite file is walked too, it is the only one left of a missing file
+		for _, filePath := range []string{pattern.pattern, getGLFLiteFilePath(pattern.pattern)} {
+			if _, err := os.Lstat(folder + "/" + filePath); err == nil {
+				walkPaths = append(walkPaths, "/"+filePath)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, errors.New(fmt.Sprintf("%s does not exist", pattern.pattern))
+		}
+	}
+
+	return walkPaths, nil
+}
+
+// getListLinesOutsideScope returns the lines of a file list whose file is
+// outside of the scope, so that a run on some files keeps the other files in
+// the list. The path of a line starts after "./".
+func (app *application) getListLinesOutsideScope(fileName string) ([]string, error) {
+	if len(app.scope) == 0 {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(app.getFullPath(fileName))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+
+	for _, line := range strings.Split(string(content), "\n") {
+		i := strings.Index(line, "./")
+
+		if i < 0 {
+			continue
+		}
+
+		if !isInScope(app.scope, line[i+2:]) {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// getDisplayPath returns the path of a file relative to the current folder,
+// like git prints them. The files of the submodules are printed from the
+// superproject.
+func (app *application) getDisplayPath(filePath string) string {
+	filePath = path.Join(app.config.submoduleFolder, filePath)
+
+	if app.config.currentFolder == "" {
+		return filePath
+	}
+
+	relativePath, err := filepath.Rel(app.config.currentFolder, filePath)
+
+	if err != nil {
+		return filePath
+	}
+
+	return filepath.ToSlash(relativePath)
+}
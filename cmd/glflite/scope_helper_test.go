@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGetScope(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	for _, test := range []struct {
+		currentFolder string
+		patterns      []string
+		scope         []scopePattern
+	}{
+		{"", nil, nil},
+		{"", []string{"", "./videos/", app.config.rootFolder + "/photos/cover.raw", "*.wav", "videos/../audio"}, []scopePattern{
+			{pattern: "videos"},
+			{pattern: "photos/cover.raw"},
+			{pattern: "*.wav"},
+			{pattern: "audio"},
+		}},
+		{"", []string{"videos/*/outro.mp4", "videos/2024/*.mp4"}, []scopePattern{
+			{folder: "videos", pattern: "*/outro.mp4"},
+			{folder: "videos/2024", pattern: "*.mp4"},
+		}},
+		// the paths are relative to the current folder, which is selected without paths
+		{"videos", nil, []scopePattern{{pattern: "videos"}}},
+		{"videos", []string{"intro.mp4", "*.mp4", "../photos", "."}, []scopePattern{
+			{pattern: "videos/intro.mp4"},
+			{folder: "videos", pattern: "*.mp4"},
+			{pattern: "photos"},
+			{pattern: "videos"},
+		}},
+	} {
+		app.config.currentFolder = test.currentFolder
+
+		scope, err := app.getScope(test.patterns)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fmt.Sprint(scope) != fmt.Sprint(test.scope) {
+			t.Errorf("the scope of %v in %q is %v, expected %v", test.patterns, test.currentFolder, scope, test.scope)
+		}
+	}
+
+	app.config.currentFolder = "videos"
+
+	for _, pattern := range []string{"../..", "../../other/intro.mp4", "/tmp"} {
+		_, err := app.getScope([]string{pattern})
+
+		if err == nil || !strings.Contains(err.Error(), "is outside of the repository") {
+			t.Errorf("the path %s outside of the repository was accepted: %v", pattern, err)
+		}
+	}
+}
+
+func TestScopePatternMatches(t *testing.T) {
+	for _, test := range []struct {
+		pattern  scopePattern
+		filePath string
+		matches  bool
+	}{
+		{scopePattern{pattern: "videos"}, "videos/2024/intro.mp4", true},
+		{scopePattern{pattern: "videos"}, "videos2/intro.mp4", false},
+		{scopePattern{pattern: "*.mp4"}, "videos/2024/intro.mp4", true},
+		{scopePattern{folder: "videos", pattern: "*.mp4"}, "videos/2024/intro.mp4", true},
+		{scopePattern{folder: "videos", pattern: "*.mp4"}, "archive/intro.mp4", false},
+		{scopePattern{folder: "videos", pattern: "*.mp4"}, "videos2/intro.mp4", false},
+		{scopePattern{folder: "videos", pattern: "2024/*.mp4"}, "videos/2024/intro.mp4", true},
+		{scopePattern{folder: "videos", pattern: "2024/*.mp4"}, "videos/old/2024/intro.mp4", false},
+	} {
+		if test.pattern.matches(test.filePath) != test.matches {
+			t.Errorf("the pattern %v matches %s: %t", test.pattern, test.filePath, !test.matches)
+		}
+	}
+}
+
+func TestCanHaveFilesInScope(t *testing.T) {
+	for _, test := range []struct {
+		scope  []scopePattern
+		folder string
+		can    bool
+	}{
+		{nil, "archive", true},
+		{[]scopePattern{{pattern: "videos/2024"}}, "videos", true},
+		{[]scopePattern{{pattern: "videos/2024"}}, "videos/2024/raw", true},
+		{[]scopePattern{{pattern: "videos/2024"}}, "videos/2023", false},
+		{[]scopePattern{{pattern: "videos/2024"}}, "archive", false},
+		{[]scopePattern{{pattern: "*.mp4"}}, "archive/2024", true},
+		{[]scopePattern{{folder: "videos", pattern: "*.mp4"}}, "videos/2024", true},
+		{[]scopePattern{{folder: "videos/2024", pattern: "*.mp4"}}, "videos", true},
+		{[]scopePattern{{folder: "videos", pattern: "*.mp4"}}, "archive", false},
+		{[]scopePattern{{folder: "videos", pattern: "20?4/*.mp4"}}, "videos/2024", true},
+		{[]scopePattern{{folder: "videos", pattern: "20?4/*.mp4"}}, "videos/2024/raw", false},
+		{[]scopePattern{{folder: "videos", pattern: "20?4/*.mp4"}}, "videos/old", false},
+		{[]scopePattern{{pattern: "cover?.raw"}}, "photos", false},
+		{[]scopePattern{{pattern: "videos/2024"}, {pattern: "*.raw"}}, "archive", true},
+	} {
+		if canHaveFilesInScope(test.scope, test.folder) != test.can {
+			t.Errorf("the scope %v can have files in %s: %t", test.scope, test.folder, !test.can)
+		}
+	}
+}
+
+func TestGetWalkPaths(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4":      "intro video",
+		"videos/2024/outro.mp4": "outro video",
+		"photos/cover.raw":      "cover photo",
+	})
+
+	for _, test := range []struct {
+		scope     []string
+		walkPaths string
+	}{
+		{nil, ""},
+		{[]string{"videos"}, "/videos"},
+		{[]string{"videos/intro.mp4", "photos"}, "/videos/intro.mp4,/videos/intro.mp4.glflite,/photos"},
+		{[]string{"*.mp4"}, ""},
+		{[]string{"videos/*/outro.mp4"}, "/videos"},
+		{[]string{"videos/2024/*.mp4", "."}, ""},
+		{[]string{"*/2024/*.mp4"}, ""},
+		{[]string{"audio/*.wav"}, ""},
+	} {
+		scope, err := app.getScope(test.scope)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walkPaths, err := getWalkPaths(app.config.rootFolder, scope)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a pattern in a missing folder doesn't select anything
+		if len(test.scope) == 1 && test.scope[0] == "audio/*.wav" {
+			if len(walkPaths) != 0 {
+				t.Errorf("the missing folder is walked: %v", walkPaths)
+			}
+
+			continue
+		}
+
+		if strings.Join(walkPaths, ",") != test.walkPaths {
+			t.Errorf("the walked paths of %v are %v", test.scope, walkPaths)
+		}
+	}
+
+	// a missing file whose GLFLite file exists is still walked
+	err := os.Remove(app.getFullPath("videos/intro.mp4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walkPaths, err := getWalkPaths(app.config.rootFolder, []scopePattern{{pattern: "videos/intro.mp4"}})
+
+	if err != nil || strings.Join(walkPaths, ",") != "/videos/intro.mp4.glflite" {
+		t.Errorf("the walked paths of the missing file are %v: %v", walkPaths, err)
+	}
+
+	_, err = getWalkPaths(app.config.rootFolder, []scopePattern{{pattern: "videos/missing.mp4"}})
+
+	if err == nil {
+		t.Error("a missing file was walked")
+	}
+}
+
+func TestFindFilesInScope(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4":      "intro video",
+		"videos/2024/outro.mp4": "outro video",
+		"photos/cover.raw":      "cover photo",
+		"audio/intro.wav":       "intro audio",
+	})
+
+	for _, test := range []struct {
+		scope string
+		files string
+	}{
+		{"videos/2024", "videos/2024,videos/2024/outro.mp4,videos/2024/outro.mp4.glflite"},
+		{"*.wav,photos/cover.raw", "audio/intro.wav,audio/intro.wav.glflite,photos/cover.raw,photos/cover.raw.glflite"},
+		{"videos/2024,videos", "videos,videos/2024,videos/2024/outro.mp4,videos/2024/outro.mp4.glflite,videos/intro.mp4,videos/intro.mp4.glflite"},
+	} {
+		scope, err := app.getScope(strings.Split(test.scope, ","))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := walkTestFiles(t, app, scope, walkExclusions{}, true)
+
+		var filePaths []string
+
+		for _, file := range files {
+			filePaths = append(filePaths, file.path)
+		}
+
+		sort.Strings(filePaths)
+
+		if strings.Join(filePaths, ",") != test.files {
+			t.Errorf("the files of the scope %s are %v", test.scope, filePaths)
+		}
+	}
+}
+
+func TestFileListsKeepLinesOutsideScope(t *testing.T) {
+	app := newTestApplication(t, map[string]string{
+		"videos/intro.mp4": "intro video",
+		"photos/cover.raw": "cover photo",
+	})
+
+	err := app.generateRsyncFileList(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a run on the videos only knows the videos, a new one was added
+	app.scope = []scopePattern{{pattern: "videos"}}
+
+	app.removeTrackedFile("photos/cover.raw")
+	app.addTrackedFile(trackedFile{file: writeTestFile(t, app, "videos/outro.mp4", "outro video"), isPresent: true})
+
+	err = app.generateRsyncFileList(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list := readTestFile(t, app, "rsync_list_glflite"); list != "./photos/cover.raw\n./videos/intro.mp4\n./videos/outro.mp4\n" {
+		t.Errorf("the list is:\n%s", list)
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video", "photos/cover.raw": "cover photo"})
+
+	app.config.currentFolder = "videos"
+
+	for arg, expected := range map[string]string{
+		"intro.mp4":           "videos/intro.mp4",
+		"./intro.mp4.glflite": "videos/intro.mp4",
+		"../photos/cover.raw": "photos/cover.raw",
+		"..":                  ".",
+		app.config.rootFolder + "/photos/cover.raw": "photos/cover.raw",
+	} {
+		filePath, err := app.resolvePath(arg)
+
+		if err != nil || filePath != expected {
+			t.Errorf("the path %s is %s: %v", arg, filePath, err)
+		}
+	}
+
+	if app.getDisplayPath("videos/intro.mp4") != "intro.mp4" || app.getDisplayPath("photos/cover.raw") != "../photos/cover.raw" {
+		t.Errorf("the paths are printed as %s and %s", app.getDisplayPath("videos/intro.mp4"), app.getDisplayPath("photos/cover.raw"))
+	}
+
+	filePath, revision, err := app.parseRevisionPath("intro.mp4@HEAD~1")
+
+	if err != nil || filePath != "videos/intro.mp4" || revision != "HEAD~1" {
+		t.Errorf("the revision path is %s at %s: %v", filePath, revision, err)
+	}
+
+	app.config.currentFolder = ""
+
+	if app.getDisplayPath("videos/intro.mp4") != "videos/intro.mp4" {
+		t.Errorf("the path is printed as %s from the root folder", app.getDisplayPath("videos/intro.mp4"))
+	}
+}
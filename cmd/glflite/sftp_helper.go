@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpRemote stores the files in a folder of a server reachable by SSH, the
+// connection settings are read from the user's ~/.ssh/config file and the keys
+// are taken from the SSH agent and the identity files.
+type sftpRemote struct {
+	sshClient *ssh.Client
+	client    *sftp.Client
+	folder    string
+
+	// the connection to the SSH agent signs with the keys of the agent, it is
+	// closed with the remote
+	agentConn net.Conn
+}
+
+type sshHostConfig struct {
+	hostName        string
+	user            string
+	port            string
+	identityFiles   []string
+	knownHostsFiles []string
+}
+
+func newSFTPRemote(remoteURL *url.URL) (*sftpRemote, error) {
+	hostConfig, err := readSSHConfig(remoteURL.Hostname())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if remoteURL.User != nil && remoteURL.User.Username() != "" {
+		hostConfig.user = remoteURL.User.Username()
+	}
+
+	if remoteURL.Port() != "" {
+		hostConfig.port = remoteURL.Port()
+	}
+
+	hostKeyCallback, err := knownhosts.New(hostConfig.knownHostsFiles...)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to read the known hosts files: %s", err.Error()))
+	}
+
+	authMethods, agentConn := getSSHAuthMethods(hostConfig.identityFiles)
+
+	sshConfig := &ssh.ClientConfig{
+		User:            hostConfig.user,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	sshClient, err := ssh.Dial("tcp", net.JoinHostPort(hostConfig.hostName, hostConfig.port), sshConfig)
+
+	if err != nil {
+		closeSSHAgent(agentConn)
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(sshClient)
+
+	if err != nil {
+		sshClient.Close()
+		closeSSHAgent(agentConn)
+		return nil, err
+	}
+
+	// paths starting with /~/ are relative to the home folder of the user
+	folder := strings.TrimPrefix(remoteURL.Path, "/~/")
+
+	if folder == "" {
+		folder = "."
+	}
+
+	folder = path.Clean(folder)
+
+	return &sftpRemote{sshClient: sshClient, client: client, folder: folder, agentConn: agentConn}, nil
+}
+
+// getSSHAuthMethods returns the keys of the SSH agent and of the identity
+// files, and the connection to the agent that has to stay open while the
+// remote is used. The keys of the agent are listed when the server asks for
+// them, the agent signs with them through the connection.
+func getSSHAuthMethods(identityFiles []string) ([]ssh.AuthMethod, net.Conn) {
+	var agentConn net.Conn
+	var agentClient agent.ExtendedAgent
+
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+
+		if err == nil {
+			agentConn = conn
+			agentClient = agent.NewClient(conn)
+		}
+	}
+
+	var fileSigners []ssh.Signer
+
+	for _, identityFile := range identityFiles {
+		key, err := os.ReadFile(identityFile)
+
+		if err != nil {
+			continue
+		}
+
+		// keys protected with a passphrase have to be added to the SSH agent
+		signer, err := ssh.ParsePrivateKey(key)
+
+		if err != nil {
+			continue
+		}
+
+		fileSigners = append(fileSigners, signer)
+	}
+
+	// the client tries each method only once, so the keys of the agent and of the files are in the same one
+	getSigners := func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+
+		if agentClient != nil {
+			agentSigners, err := agentClient.Signers()
+
+			if err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+
+		return append(signers, fileSigners...), nil
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeysCallback(getSigners)}, agentConn
+}
+
+func closeSSHAgent(agentConn net.Conn) {
+	if agentConn != nil {
+		agentConn.Close()
+	}
+}
+
+// readSSHConfig gets the settings of a host from the ~/.ssh/config file, only
+// the options needed to open the connection are supported.
+func readSSHConfig(host string) (sshHostConfig, error) {
+	homeFolder, err := os.UserHomeDir()
+
+	if err != nil {
+		return sshHostConfig{}, err
+	}
+
+	hostConfig := sshHostConfig{}
+
+	configFile, err := os.Open(homeFolder + "/.ssh/config")
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return hostConfig, err
+	}
+
+	if err == nil {
+		defer configFile.Close()
+
+		matching := true
+		scanner := bufio.NewScanner(configFile)
+
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			// the keyword and the value are separated by spaces or an equal sign
+			separator := strings.IndexAny(line, " \t=")
+
+			if separator < 0 {
+				continue
+			}
+
+			key := strings.ToLower(line[:separator])
+			value := strings.TrimSpace(line[separator:])
+			value = strings.Trim(strings.TrimSpace(strings.TrimPrefix(value, "=")), "\"")
+
+			switch key {
+			case "host":
+				matching = matchSSHHost(host, strings.Fields(value))
+			case "match":
+				// Match blocks are not supported, their options are ignored
+				matching = false
+			}
+
+			if !matching {
+				continue
+			}
+
+			// the first value found is the one used, like ssh does
+			switch key {
+			case "hostname":
+				if hostConfig.hostName == "" {
+					hostConfig.hostName = strings.ReplaceAll(value, "%h", host)
+				}
+			case "user":
+				if hostConfig.user == "" {
+					hostConfig.user = value
+				}
+			case "port":
+				if hostConfig.port == "" {
+					hostConfig.port = value
+				}
+			case "identityfile":
+				hostConfig.identityFiles = append(hostConfig.identityFiles, expandHomeFolder(value, homeFolder))
+			case "userknownhostsfile":
+				if len(hostConfig.knownHostsFiles) == 0 {
+					for _, knownHostsFile := range strings.Fields(value) {
+						hostConfig.knownHostsFiles = append(hostConfig.knownHostsFiles, expandHomeFolder(knownHostsFile, homeFolder))
+					}
+				}
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return hostConfig, err
+		}
+	}
+
+	if hostConfig.hostName == "" {
+		hostConfig.hostName = host
+	}
+
+	if hostConfig.user == "" {
+		hostConfig.user = os.Getenv("USER")
+	}
+
+	if hostConfig.port == "" {
+		hostConfig.port = "22"
+	}
+
+	if len(hostConfig.identityFiles) == 0 {
+		for _, keyName := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			hostConfig.identityFiles = append(hostConfig.identityFiles, homeFolder+"/.ssh/"+keyName)
+		}
+	}
+
+	if len(hostConfig.knownHostsFiles) == 0 {
+		hostConfig.knownHostsFiles = []string{homeFolder + "/.ssh/known_hosts"}
+	}
+
+	return hostConfig, nil
+}
+
+func matchSSHHost(host string, patterns []string) bool {
+	matched := false
+
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if ok, _ := path.Match(pattern, host); ok {
+			if negate {
+				return false
+			}
+
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+func expandHomeFolder(file string, homeFolder string) string {
+	if file == "~" {
+		return homeFolder
+	}
+
+	if strings.HasPrefix(file, "~/") {
+		return homeFolder + file[1:]
+	}
+
+	return file
+}
+
+func (r *sftpRemote) getObjectFile(key string) string {
+	return r.folder + "/" + getObjectPath(key)
+}
+
+func (r *sftpRemote) statObject(key string) (remoteObject, error) {
+	info, err := r.client.Stat(r.getObjectFile(key))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return remoteObject{}, ErrRemoteObjectNotFound
+	} else if err != nil {
+		return remoteObject{}, err
+	}
+
+	return remoteObject{key: key, size: info.Size(), modified: info.ModTime()}, nil
+}
+
+// putObject uploads the file to a partial file that is renamed once the
+// upload is complete. If a previous upload was interrupted it continues from
+// the end of the partial file and then verifies the Sha256 sum of the whole
+// remote file, like rsync --append-verify.
+func (r *sftpRemote) putObject(object remoteObject, content io.ReadSeeker) error {
+	objectFile := r.getObjectFile(object.key)
+	partialFile := objectFile + partialObjectSuffix
+
+	err := r.client.MkdirAll(path.Dir(objectFile))
+
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+
+	if info, err := r.client.Stat(partialFile); err == nil && info.Size() <= object.size {
+		offset = info.Size()
+	}
+
+	file, err := r.client.OpenFile(partialFile, os.O_WRONLY|os.O_CREATE)
+
+	if err != nil {
+		return err
+	}
+
+	if offset == 0 {
+		err = file.Truncate(0)
+	} else {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+
+	if err == nil {
+		_, err = content.Seek(offset, io.SeekStart)
+	}
+
+	if err == nil {
+		_, err = io.Copy(file, content)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		err = r.verifyPartialFile(partialFile, content)
+
+		if err != nil {
+			r.client.Remove(partialFile)
+			return err
+		}
+	}
+
+	info, err := r.client.Stat(partialFile)
+
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != object.size {
+		return errors.New(fmt.Sprintf("the remote file size is %d, expected %d", info.Size(), object.size))
+	}
+
+	err = r.client.PosixRename(partialFile, objectFile)
+
+	if err != nil {
+		// the server doesn't support the posix-rename extension
+		r.client.Remove(objectFile)
+
+		return r.client.Rename(partialFile, objectFile)
+	}
+
+	return nil
+}
+
+func (r *sftpRemote) verifyPartialFile(partialFile string, content io.ReadSeeker) error {
+	file, err := r.client.Open(partialFile)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	remoteHash := sha256.New()
+
+	_, err = io.Copy(remoteHash, file)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = content.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return err
+	}
+
+	localHash := sha256.New()
+
+	_, err = io.Copy(localHash, content)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(remoteHash.Sum(nil), localHash.Sum(nil)) {
+		return errors.New("the Sha256 sum of the resumed upload doesn't match, the upload will start again on the next push")
+	}
+
+	return nil
+}
+
+func (r *sftpRemote) getObject(key string, offset int64) (io.ReadCloser, error) {
+	file, err := r.client.Open(r.getObjectFile(key))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRemoteObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (r *sftpRemote) listObjects() ([]remoteObject, error) {
+	var objects []remoteObject
+
+	walker := r.client.Walk(r.folder)
+
+	for walker.Step() {
+		if walker.Err() != nil {
+			return nil, walker.Err()
+		}
+
+		info := walker.Stat()
+		relativePath := strings.TrimPrefix(walker.Path(), r.folder+"/")
+
+		if info.IsDir() || getObjectPath(info.Name()) != relativePath || !isObjectKey(info.Name()) {
+			continue
+		}
+
+		objects = append(objects, remoteObject{key: info.Name(), size: info.Size(), modified: info.ModTime()})
+	}
+
+	return objects, nil
+}
+
+func (r *sftpRemote) deleteObject(key string) error {
+	return r.client.Remove(r.getObjectFile(key))
+}
+
+func (r *sftpRemote) close() error {
+	r.client.Close()
+
+	err := r.sshClient.Close()
+
+	closeSSHAgent(r.agentConn)
+
+	return err
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startTestSFTPServer starts an SSH server with the SFTP subsystem on a local
+// port, and writes the ~/.ssh/config, the key and the known_hosts files of a
+// temporary home folder so that the remote connects to it like to a NAS. It
+// returns the URL of the remote and the folder where the objects are stored.
+func startTestSFTPServer(t *testing.T) (string, string) {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientPublicKey, clientKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizedKey, err := ssh.NewPublicKey(clientPublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "tester" && bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go serveTestSSHConnection(conn, serverConfig)
+		}
+	}()
+
+	homeFolder := t.TempDir()
+
+	err = os.Mkdir(homeFolder+"/.ssh", 0700)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	sshConfig := fmt.Sprintf("Host nas\n\tHostName 127.0.0.1\n\tPort %d\n\tUser tester\n\tIdentityFile ~/.ssh/id_test\n\tUserKnownHostsFile ~/.ssh/known_hosts_test\n", port)
+
+	pemKey, err := ssh.MarshalPrivateKey(clientKey, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	knownHost := knownhosts.Line([]string{fmt.Sprintf("[127.0.0.1]:%d", port)}, hostSigner.PublicKey())
+
+	for fileName, content := range map[string]string{
+		"config":           sshConfig,
+		"id_test":          string(pem.EncodeToMemory(pemKey)),
+		"known_hosts_test": knownHost + "\n",
+	} {
+		err = os.WriteFile(homeFolder+"/.ssh/"+fileName, []byte(content), 0600)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("HOME", homeFolder)
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	storeFolder := t.TempDir()
+
+	return "sftp://nas" + storeFolder, storeFolder
+}
+
+func serveTestSSHConnection(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for request := range channelRequests {
+				// the payload of the subsystem request is the name of the subsystem, prefixed with its length
+				isSFTP := request.Type == "subsystem" && len(request.Payload) > 4 && string(request.Payload[4:]) == "sftp"
+
+				request.Reply(isSFTP, nil)
+
+				if !isSFTP {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+
+				if err != nil {
+					channel.Close()
+					return
+				}
+
+				go func() {
+					server.Serve()
+					server.Close()
+				}()
+			}
+		}()
+	}
+}
+
+func openTestSFTPRemote(t *testing.T, app *application, remoteURL string) *remoteConnection {
+	t.Helper()
+
+	conn, err := app.openRemote(remoteURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.close()
+	})
+
+	return conn
+}
+
+func readTestObject(t *testing.T, storeFolder string, shaSum string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(storeFolder + "/" + getObjectPath(shaSum))
+
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestSFTPPushAndPull(t *testing.T) {
+	remoteURL, storeFolder := startTestSFTPServer(t)
+
+	files := map[string]string{
+		"videos/intro.mp4": strings.Repeat("intro video ", 1000),
+		"photos/cover.raw": "cover photo",
+	}
+
+	app := newTestApplication(t, files)
+	conn := openTestSFTPRemote(t, app, remoteURL)
+
+	err := app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		if readTestObject(t, storeFolder, getTestShasum(content)) != content {
+			t.Errorf("the object of %s wasn't pushed", filePath)
+		}
+
+		err = os.Remove(app.getFullPath(filePath))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file := app.trackedFiles[filePath]
+		file.isPresent = false
+		app.trackedFiles[filePath] = file
+	}
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filePath, content := range files {
+		if readTestFile(t, app, filePath) != content {
+			t.Errorf("%s wasn't pulled", filePath)
+		}
+	}
+}
+
+func TestSFTPAgentKeys(t *testing.T) {
+	remoteURL, storeFolder := startTestSFTPServer(t)
+
+	// the key is only in the SSH agent
+	keyFile := os.Getenv("HOME") + "/.ssh/id_test"
+
+	pemKey, err := os.ReadFile(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ssh.ParseRawPrivateKey(pemKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+
+	err = keyring.Add(agent.AddedKey{PrivateKey: key})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := t.TempDir() + "/agent.sock"
+
+	listener, err := net.Listen("unix", socket)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	agentClosed := make(chan bool, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		agent.ServeAgent(keyring, conn)
+
+		agentClosed <- true
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	app := newTestApplication(t, map[string]string{"intro.mp4": "intro video"})
+
+	conn, err := app.openRemote(remoteURL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, getTestShasum("intro video")) != "intro video" {
+		t.Error("the file wasn't pushed with the key of the agent")
+	}
+
+	conn.close()
+
+	select {
+	case <-agentClosed:
+	case <-time.After(5 * time.Second):
+		t.Error("the connection to the SSH agent wasn't closed with the remote")
+	}
+}
+
+func TestSFTPPushSkipsModifiedFile(t *testing.T) {
+	remoteURL, storeFolder := startTestSFTPServer(t)
+
+	app := newTestApplication(t, map[string]string{"intro.mp4": "intro video"})
+	conn := openTestSFTPRemote(t, app, remoteURL)
+
+	// same size, the Sha256 sum doesn't match the one of the GLFLite file anymore
+	writeTestFile(t, app, "intro.mp4", "INTRO VIDEO")
+
+	err := app.pushFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, getTestShasum("intro video")) != "" {
+		t.Error("the modified file was pushed with the Sha256 sum of its GLFLite file")
+	}
+}
+
+func TestSFTPPullVerifiesShasum(t *testing.T) {
+	remoteURL, storeFolder := startTestSFTPServer(t)
+
+	app := newTestApplication(t, map[string]string{"intro.mp4": "intro video"})
+	conn := openTestSFTPRemote(t, app, remoteURL)
+
+	// an object of the right size with another content
+	objectFile := storeFolder + "/" + getObjectPath(getTestShasum("intro video"))
+
+	err := os.MkdirAll(objectFile[:strings.LastIndex(objectFile, "/")], 0755)
+
+	if err == nil {
+		err = os.WriteFile(objectFile, []byte("INTRO VIDEO"), 0644)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(app.getFullPath("intro.mp4"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := app.trackedFiles["intro.mp4"]
+	file.isPresent = false
+	app.trackedFiles["intro.mp4"] = file
+
+	err = app.pullFiles(conn)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileExists(app.getFullPath("intro.mp4")) {
+		t.Error("the corrupted object was pulled")
+	}
+
+	if app.trackedFiles["intro.mp4"].isPresent {
+		t.Error("the corrupted file is marked as present")
+	}
+}
+
+func TestSFTPResumePartialUpload(t *testing.T) {
+	remoteURL, storeFolder := startTestSFTPServer(t)
+
+	content := strings.Repeat("0123456789", 10000)
+
+	app := newTestApplication(t, nil)
+	conn := openTestSFTPRemote(t, app, remoteURL)
+
+	object := remoteObject{key: getTestShasum(content), size: int64(len(content)), shasum: getTestShasum(content)}
+	objectFile := storeFolder + "/" + getObjectPath(object.key)
+
+	err := os.MkdirAll(objectFile[:strings.LastIndex(objectFile, "/")], 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first half was uploaded before the connection was lost
+	err = os.WriteFile(objectFile+".partial", []byte(content[:len(content)/2]), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.putObject(object, strings.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, object.key) != content {
+		t.Error("the resumed upload doesn't have the content of the file")
+	}
+
+	if fileExists(objectFile + ".partial") {
+		t.Error("the partial file wasn't renamed")
+	}
+}
+
+func TestSFTPResumeVerifiesPartialUpload(t *testing.T) {
+	remoteURL, storeFolder := startTestSFTPServer(t)
+
+	content := strings.Repeat("0123456789", 10000)
+
+	app := newTestApplication(t, nil)
+	conn := openTestSFTPRemote(t, app, remoteURL)
+
+	object := remoteObject{key: getTestShasum(content), size: int64(len(content)), shasum: getTestShasum(content)}
+	objectFile := storeFolder + "/" + getObjectPath(object.key)
+
+	err := os.MkdirAll(objectFile[:strings.LastIndex(objectFile, "/")], 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the partial file has the size of the first half but not its content
+	err = os.WriteFile(objectFile+".partial", []byte(strings.Repeat("x", len(content)/2)), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = conn.putObject(object, strings.NewReader(content))
+
+	if err == nil {
+		t.Fatal("the resumed upload of a corrupted partial file succeeded")
+	}
+
+	if fileExists(objectFile) || fileExists(objectFile+".partial") {
+		t.Fatal("the corrupted partial file was kept")
+	}
+
+	// the next push starts again from the beginning
+	err = conn.putObject(object, strings.NewReader(content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if readTestObject(t, storeFolder, object.key) != content {
+		t.Error("the upload after the failed resume doesn't have the content of the file")
+	}
+}
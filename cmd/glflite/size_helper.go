@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func (app *application) hasSizeRules() bool {
+	return app.config.setup.SizeThreshold > 0 || len(app.config.setup.SizeRules) > 0
+}
+
+// getSizeThreshold returns the size in bytes from which a file should be
+// tracked, 0 when its size isn't checked. The last size rule that matches the
+// file overrides the threshold of the setup file.
+func (app *application) getSizeThreshold(filePath string) int64 {
+	threshold := app.config.setup.SizeThreshold
+
+	for _, rule := range app.config.setup.SizeRules {
+		if !matchesFilePattern(rule.Path, filePath) {
+			continue
+		}
+
+		if rule.Exclude {
+			threshold = 0
+		} else {
+			threshold = rule.Threshold
+		}
+	}
+
+	return threshold * 1024 * 1024
+}
+
+// findLargeFiles returns the files bigger than their size threshold that
+// aren't tracked by GLFLite nor ignored by git, so git would pick them up.
+func (app *application) findLargeFiles(files []fileInformation) ([]fileInformation, error) {
+	var candidates []fileInformation
+	var candidatePaths []string
+
+	for _, file := range files {
+		if file.isDirectory || isGLFLiteFile(file.path) || isFileExcluded(app.config.fileRules, file.path, false) {
+			continue
+		}
+
+		threshold := app.getSizeThreshold(file.path)
+
+		if threshold == 0 || file.size < threshold || isLink(app.getFullPath(file.path)) {
+			continue
+		}
+
+		candidates = append(candidates, file)
+		candidatePaths = append(candidatePaths, file.path)
+	}
+
+	ignoredFiles, err := app.getIgnoredFiles(candidatePaths)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var largeFiles []fileInformation
+
+	for _, file := range candidates {
+		if !ignoredFiles[file.path] {
+			largeFiles = append(largeFiles, file)
+		}
+	}
+
+	return largeFiles, nil
+}
+
+// printLargeFiles warns about the large files that would be committed to git.
+func (app *application) printLargeFiles(files []fileInformation) error {
+	largeFiles, err := app.findLargeFiles(files)
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range largeFiles {
+		if app.verbose {
+			fmt.Printf("%s: ", app.getDisplayPath(file.path))
+			printRed(fmt.Sprintf("Large file not tracked (%s)", formatSize(file.size)))
+		}
+	}
+
+	fmt.Printf("Large files not tracked: ")
+	printRed(strconv.Itoa(len(largeFiles)))
+
+	if len(largeFiles) > 0 {
+		fmt.Println("To track the large files, use the update action with the -track-large flag.")
+	}
+
+	return nil
+}
+
+// trackLargeFiles adds a rule for each large file to the GitLFSLite section
+// of the .gitignore file, so the update action creates their GLFLite files.
+func (app *application) trackLargeFiles(files []fileInformation) error {
+	largeFiles, err := app.findLargeFiles(files)
+
+	if err != nil {
+		return err
+	}
+
+	committedFiles, err := app.getCommittedFiles()
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range largeFiles {
+		// the paths can have the characters of the patterns, like # or *
+		rule := escapeGitIgnoreRule(file.path)
+
+		err = addGitIgnoreRule(app.config.rootFolder, rule)
+
+		if err != nil {
+			return err
+		}
+
+		app.config.fileRules = append(app.config.fileRules, rule)
+
+		app.addTrackedFile(trackedFile{
+			file:       file,
+			isPresent:  true,
+			isUpToDate: false,
+		})
+
+		if app.verbose {
+			fmt.Printf("Tracking large file %s (%s)\n", app.getDisplayPath(file.path), formatSize(file.size))
+		}
+
+		if committedFiles[file.path] {
+			printRed(fmt.Sprintf("File %s is committed to git, remove it from the index with git rm --cached.", file.path))
+		}
+	}
+
+	return nil
+}
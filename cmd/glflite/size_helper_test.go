@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGetSizeThreshold(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	app.config.setup.SizeThreshold = 10
+	app.config.setup.SizeRules = []sizeRule{
+		{Path: "assets", Threshold: 50},
+		{Path: "*.psd", Threshold: 1},
+		{Path: "assets/fonts", Exclude: true},
+	}
+
+	for filePath, threshold := range map[string]int64{
+		"notes.txt":          10,
+		"assets/logo.png":    50,
+		"assets/logo.psd":    1,
+		"assets/fonts/a.ttf": 0,
+		"assets2/logo.png":   10,
+		"designs/cover.psd":  1,
+		"assets/fonts/a.psd": 0,
+	} {
+		if app.getSizeThreshold(filePath) != threshold*1024*1024 {
+			t.Errorf("the threshold of %s is %d, expected %d MB", filePath, app.getSizeThreshold(filePath), threshold)
+		}
+	}
+}
+
+func TestTrackLargeFiles(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	initTestRepository(t, app, map[string]string{
+		".gitignore":     "build\n" + gitIgnoreSeparator + "\n*.mp4\n",
+		"data/small.csv": "1,2\n",
+	})
+
+	app.config.fileRules = []string{"*.mp4"}
+	app.config.setup.SizeThreshold = 1
+	app.verbose = true
+
+	large := strings.Repeat("x", 1024*1024)
+
+	var files []fileInformation
+
+	for _, filePath := range []string{"data/large.csv", "data/small.csv", "build/app.bin", "videos/outro.mp4"} {
+		content := large
+
+		if filePath == "data/small.csv" {
+			content = "1,2\n"
+		}
+
+		files = append(files, writeTestFile(t, app, filePath, content))
+	}
+
+	// the large committed file is found too, it has to be removed from the index
+	runTestGit(t, app, "add", "--force", "--", "data/large.csv")
+	runTestGit(t, app, "commit", "--quiet", "-m", "large file")
+
+	var err error
+
+	output := captureOutput(t, func() {
+		err = app.printLargeFiles(files)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "data/large.csv: Large file not tracked (1024.0 KB)") || !strings.Contains(output, "Large files not tracked: 1\n") {
+		t.Errorf("the check printed:\n%s", output)
+	}
+
+	output = captureOutput(t, func() {
+		err = app.trackLargeFiles(files)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "File data/large.csv is committed to git") {
+		t.Errorf("the update printed:\n%s", output)
+	}
+
+	rules, err := getGitIgnoreContent(app.config.rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(rules, ",") != "*.mp4,/data/large.csv" || strings.Join(app.config.fileRules, ",") != "*.mp4,/data/large.csv" {
+		t.Errorf("the rules are %v", rules)
+	}
+
+	if file, ok := app.trackedFiles["data/large.csv"]; !ok || file.isUpToDate {
+		t.Error("the large file isn't tracked")
+	}
+
+	largeFiles, err := app.findLargeFiles(files)
+
+	if err != nil || len(largeFiles) != 0 {
+		t.Errorf("the large files are still found: %v %v", largeFiles, err)
+	}
+}
+
+func TestTrackLargeFileAtRoot(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	initTestRepository(t, app, map[string]string{".gitignore": gitIgnoreSeparator + "\n"})
+
+	app.config.setup.SizeThreshold = 1
+
+	// the small file of the backup folder has the name of the large file
+	large := writeTestFile(t, app, "dump.sql", strings.Repeat("x", 1024*1024))
+	writeTestFile(t, app, "backup/dump.sql", "small dump")
+
+	var err error
+
+	captureOutput(t, func() {
+		err = app.trackLargeFiles([]fileInformation{large})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(app.config.fileRules, ",") != "/dump.sql" {
+		t.Fatalf("the rules are %v", app.config.fileRules)
+	}
+
+	for filePath, tracked := range map[string]bool{"dump.sql": true, "backup/dump.sql": false} {
+		if isFileExcluded(app.config.fileRules, filePath, false) != tracked {
+			t.Errorf("the rules track %s: %t", filePath, !tracked)
+		}
+
+		// git check-ignore exits with 1 when the file isn't ignored
+		err = exec.Command("git", "-C", app.config.rootFolder, "check-ignore", "--quiet", "--", filePath).Run()
+
+		if (err == nil) != tracked {
+			t.Errorf("git ignores %s: %t", filePath, !tracked)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build darwin || freebsd || netbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// getDevice returns the device of the file system of a file.
+func getDevice(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(stat.Dev), true
+}
+
+// getChangeInformation returns the change time and the inode of a file, they
+// change when the file is replaced or rewritten, even if its last modified
+// date is set back.
+func getChangeInformation(info os.FileInfo) (time.Time, uint64) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return time.Time{}, 0
+	}
+
+	return time.Unix(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec)), uint64(stat.Ino)
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !openbsd && !darwin && !freebsd && !netbsd
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// getDevice returns the device of the file system of a file, the mount
+// points aren't detected on this system.
+func getDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// getChangeInformation returns the change time and the inode of a file, this
+// system doesn't have them.
+func getChangeInformation(info os.FileInfo) (time.Time, uint64) {
+	return time.Time{}, 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// getSubmodules returns the paths of the submodules of the repository, the
+// gitlinks of the index.
+func (app *application) getSubmodules() ([]string, error) {
+	output, err := app.runGit("ls-files", "--stage", "-z")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var submodules []string
+
+	for _, entry := range strings.Split(string(output), "\x00") {
+		// the entries are "<mode> <hash> <stage>\t<path>", the submodules have the mode 160000
+		info, filePath, found := strings.Cut(entry, "\t")
+
+		if found && strings.HasPrefix(info, "160000 ") {
+			submodules = append(submodules, filePath)
+		}
+	}
+
+	return submodules, nil
+}
+
+// isSubmoduleFolder tells if a folder of the walk is the work tree of a
+// submodule or of a nested repository, it has a .git folder or file.
+func isSubmoduleFolder(folder string) bool {
+	return fileExists(folder + "/.git")
+}
+
+// isInsideSubmodule tells if a path of the walk, relative to the root folder
+// and starting with a slash, is inside a submodule.
+func isInsideSubmodule(folder string, walkPath string) bool {
+	for parent := path.Dir(walkPath); parent != "/" && parent != "."; parent = path.Dir(parent) {
+		if isSubmoduleFolder(folder + parent) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSubmoduleScope returns the scope of a submodule relative to its root
+// folder, and if the submodule has files in the scope. The patterns without a
+// folder match at any depth, so they are kept.
+func getSubmoduleScope(scope []scopePattern, submodulePath string) ([]scopePattern, bool) {
+	if len(scope) == 0 {
+		return nil, true
+	}
+
+	var submoduleScope []scopePattern
+
+	for _, pattern := range scope {
+		if !isGlobPattern(pattern.pattern) {
+			// the submodule is inside the selected folder
+			if pattern.pattern == "." || pattern.pattern == submodulePath || strings.HasPrefix(submodulePath, pattern.pattern+"/") {
+				return nil, true
+			}
+
+			if strings.HasPrefix(pattern.pattern, submodulePath+"/") {
+				submoduleScope = append(submoduleScope, scopePattern{pattern: strings.TrimPrefix(pattern.pattern, submodulePath+"/")})
+			}
+
+			continue
+		}
+
+		if pattern.folder == submodulePath {
+			submoduleScope = append(submoduleScope, scopePattern{pattern: pattern.pattern})
+		} else if strings.HasPrefix(pattern.folder, submodulePath+"/") {
+			submoduleScope = append(submoduleScope, scopePattern{folder: strings.TrimPrefix(pattern.folder, submodulePath+"/"), pattern: pattern.pattern})
+		} else if (pattern.folder == "" || strings.HasPrefix(submodulePath, pattern.folder+"/")) && !strings.Contains(pattern.pattern, "/") {
+			submoduleScope = append(submoduleScope, scopePattern{pattern: pattern.pattern})
+		}
+	}
+
+	return submoduleScope, len(submoduleScope) > 0
+}
+
+// openSubmodule returns the application of a submodule, with the rules of its
+// .gitignore file and its setup file.
+func (app *application) openSubmodule(submodulePath string) (*application, error) {
+	folder := app.config.rootFolder + "/" + submodulePath
+
+	repository, err := findRepository(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if repository.rootFolder != folder {
+		return nil, errors.New(fmt.Sprintf("The submodule %s isn't a git repository", app.getDisplayPath(submodulePath)))
+	}
+
+	// the paths are printed relative to the current folder of the superproject
+	cfg := app.config
+	cfg.rootFolder = repository.rootFolder
+	cfg.gitDirectory = repository.gitDirectory
+	cfg.commonDirectory = repository.commonDirectory
+	cfg.submoduleFolder = path.Join(app.config.submoduleFolder, submodulePath)
+	cfg.fileRules = nil
+
+	if hasGitIgnoreFile(folder) {
+		cfg.fileRules, err = getGitIgnoreContent(folder)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.setup, err = readSetupFile(folder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &application{
+		config:          cfg,
+		trackedFiles:    make(map[string]trackedFile),
+		duplicatedFiles: make(map[string][]string),
+		verbose:         app.verbose,
+	}, nil
+}
+
+// openSubmodules returns the applications of the initialized submodules with
+// files in the scope, and of their own submodules.
+func (app *application) openSubmodules() ([]*application, error) {
+	submodulePaths, err := app.getSubmodules()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var submodules []*application
+
+	for _, submodulePath := range submodulePaths {
+		scope, ok := getSubmoduleScope(app.scope, submodulePath)
+
+		if !ok {
+			continue
+		}
+
+		if !isSubmoduleFolder(app.config.rootFolder + "/" + submodulePath) {
+			if app.verbose {
+				fmt.Printf("Skipping the submodule %s because it isn't initialized. Run git submodule update --init to initialize it.\n", app.getDisplayPath(submodulePath))
+			}
+
+			continue
+		}
+
+		submodule, err := app.openSubmodule(submodulePath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		submodule.scope = scope
+
+		nested, err := submodule.openSubmodules()
+
+		if err != nil {
+			return nil, err
+		}
+
+		submodules = append(submodules, submodule)
+		submodules = append(submodules, nested...)
+	}
+
+	return submodules, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGetSubmoduleScope(t *testing.T) {
+	for _, test := range []struct {
+		scope    []scopePattern
+		selected bool
+		expected []scopePattern
+	}{
+		{nil, true, nil},
+		{[]scopePattern{{pattern: "."}}, true, nil},
+		{[]scopePattern{{pattern: "libs"}}, true, nil},
+		{[]scopePattern{{pattern: "libs/assets"}}, true, nil},
+		{[]scopePattern{{pattern: "videos"}}, false, nil},
+		{[]scopePattern{{pattern: "libs/assets/videos"}, {pattern: "videos"}}, true, []scopePattern{{pattern: "videos"}}},
+		{[]scopePattern{{pattern: "*.mp4"}}, true, []scopePattern{{pattern: "*.mp4"}}},
+		{[]scopePattern{{folder: "libs", pattern: "*.mp4"}}, true, []scopePattern{{pattern: "*.mp4"}}},
+		{[]scopePattern{{folder: "libs/assets", pattern: "*.mp4"}}, true, []scopePattern{{pattern: "*.mp4"}}},
+		{[]scopePattern{{folder: "libs/assets/videos", pattern: "*.mp4"}}, true, []scopePattern{{folder: "videos", pattern: "*.mp4"}}},
+		{[]scopePattern{{folder: "libs", pattern: "*/intro.mp4"}}, false, nil},
+		{[]scopePattern{{folder: "videos", pattern: "*.mp4"}}, false, nil},
+	} {
+		scope, selected := getSubmoduleScope(test.scope, "libs/assets")
+
+		if selected != test.selected || fmt.Sprint(scope) != fmt.Sprint(test.expected) {
+			t.Errorf("the scope of the submodule for %v is %v, %t", test.scope, scope, selected)
+		}
+	}
+}
+
+func TestSubmodules(t *testing.T) {
+	library := newTestApplication(t, nil)
+	initTestRepository(t, library, map[string]string{".gitignore": gitIgnoreSeparator + "\n*.mp4\n"})
+	commitTestVersion(t, library, "videos/intro.mp4", "intro video", true)
+
+	app := newTestApplication(t, map[string]string{"photos/cover.raw": "cover photo"})
+	initTestRepository(t, app, nil)
+
+	runTestGit(t, app, "-c", "protocol.file.allow=always", "submodule", "add", "--quiet", library.config.rootFolder, "libs/assets")
+	runTestGit(t, app, "commit", "--quiet", "-m", "submodule")
+
+	submodulePaths, err := app.getSubmodules()
+
+	if err != nil || strings.Join(submodulePaths, ",") != "libs/assets" {
+		t.Fatalf("the submodules are %v: %v", submodulePaths, err)
+	}
+
+	// the walk of the superproject skips the submodule, also when it is given as argument
+	for _, scope := range [][]scopePattern{nil, {{pattern: "libs/assets/videos"}}} {
+		files := walkTestFiles(t, app, scope, walkExclusions{}, true)
+
+		for _, file := range files {
+			if strings.HasPrefix(file.path, "libs/assets/") {
+				t.Errorf("the file %s of the submodule was found", file.path)
+			}
+		}
+	}
+
+	app.config.currentFolder = "photos"
+	app.scope = []scopePattern{{pattern: "*.mp4"}}
+
+	submodules, err := app.openSubmodules()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(submodules) != 1 {
+		t.Fatalf("%d submodules were opened", len(submodules))
+	}
+
+	submodule := submodules[0]
+
+	if submodule.config.rootFolder != app.config.rootFolder+"/libs/assets" || strings.Join(submodule.config.fileRules, ",") != "*.mp4" || fmt.Sprint(submodule.scope) != fmt.Sprint(app.scope) {
+		t.Errorf("the submodule is %+v with the scope %v", submodule.config, submodule.scope)
+	}
+
+	err = submodule.findTrackedFiles(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(submodule.sortedTrackedFiles, ",") != "videos/intro.mp4" {
+		t.Errorf("the tracked files of the submodule are %v", submodule.sortedTrackedFiles)
+	}
+
+	// the files of the submodule are printed from the current folder of the superproject
+	if submodule.getDisplayPath("videos/intro.mp4") != "../libs/assets/videos/intro.mp4" {
+		t.Errorf("the file of the submodule is printed as %s", submodule.getDisplayPath("videos/intro.mp4"))
+	}
+
+	// the submodules that aren't initialized are skipped
+	runTestGit(t, app, "submodule", "deinit", "--quiet", "--force", "libs/assets")
+
+	app.verbose = true
+
+	output := captureOutput(t, func() {
+		submodules, err = app.openSubmodules()
+	})
+
+	if err != nil || len(submodules) != 0 || !strings.Contains(output, "Skipping the submodule ../libs/assets because it isn't initialized") {
+		t.Errorf("the submodule that isn't initialized was opened: %v\n%s", err, output)
+	}
+}
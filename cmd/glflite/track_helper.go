@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// getCommittedFiles returns the files of the git index.
+func (app *application) getCommittedFiles() (map[string]bool, error) {
+	output, err := app.runGit("ls-files", "-z")
+
+	if err != nil {
+		return nil, err
+	}
+
+	committedFiles := make(map[string]bool)
+
+	for _, filePath := range strings.Split(string(output), "\x00") {
+		if filePath != "" {
+			committedFiles[filePath] = true
+		}
+	}
+
+	return committedFiles, nil
+}
+
+// trackPattern adds a rule to the GitLFSLite section of the .gitignore file
+// after listing the files that start being tracked.
+func (app *application) trackPattern(pattern string, files []fileInformation, dryRun bool) error {
+	for _, rule := range app.config.fileRules {
+		if strings.TrimSpace(rule) == pattern {
+			return errors.New(fmt.Sprintf("The rule %s is already in the .gitignore file after the %s line", pattern, gitIgnoreSeparator))
+		}
+	}
+
+	newRules := append(append([]string{}, app.config.fileRules...), pattern)
+
+	committedFiles, err := app.getCommittedFiles()
+
+	if err != nil {
+		return err
+	}
+
+	filesTracked := 0
+
+	for _, file := range files {
+		if file.isDirectory || isGLFLiteFile(file.path) {
+			continue
+		}
+
+		if isFileExcluded(app.config.fileRules, file.path, false) || !isFileExcluded(newRules, file.path, false) {
+			continue
+		}
+
+		if app.verbose {
+			fmt.Printf("File %s will be tracked\n", app.getDisplayPath(file.path))
+		}
+
+		if committedFiles[file.path] {
+			printRed(fmt.Sprintf("File %s is committed to git, remove it from the index with git rm --cached to track it.", file.path))
+		}
+
+		filesTracked++
+	}
+
+	fmt.Printf("Files that will be tracked: ")
+	printGreen(strconv.Itoa(filesTracked))
+
+	if dryRun {
+		fmt.Println("Dry run, the .gitignore file wasn't modified.")
+		return nil
+	}
+
+	err = addGitIgnoreRule(app.config.rootFolder, pattern)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Rule " + pattern + " added, run the update action to create the GLFLite files.")
+
+	return nil
+}
+
+// untrackPattern removes a rule of the GitLFSLite section of the .gitignore
+// file after listing the files that stop being tracked. Their GLFLite files
+// are kept, the untrack action removes them.
+func (app *application) untrackPattern(pattern string, dryRun bool) error {
+	var newRules []string
+
+	found := false
+
+	for _, rule := range app.config.fileRules {
+		if strings.TrimSpace(rule) == pattern {
+			found = true
+			continue
+		}
+
+		newRules = append(newRules, rule)
+	}
+
+	if !found {
+		return errors.New(fmt.Sprintf("The rule %s is not in the .gitignore file after the %s line", pattern, gitIgnoreSeparator))
+	}
+
+	var untrackedFiles []string
+
+	for _, fileFullPath := range app.sortedTrackedFiles {
+		file := app.trackedFiles[fileFullPath]
+
+		if !file.isPresent || file.file.isDirectory || isFileExcluded(newRules, fileFullPath, false) {
+			continue
+		}
+
+		if app.verbose {
+			fmt.Printf("File %s will stop being tracked\n", app.getDisplayPath(fileFullPath))
+		}
+
+		untrackedFiles = append(untrackedFiles, fileFullPath)
+	}
+
+	fmt.Printf("Files that will stop being tracked: ")
+	printRed(strconv.Itoa(len(untrackedFiles)))
+
+	if dryRun {
+		fmt.Println("Dry run, the .gitignore file wasn't modified.")
+		return nil
+	}
+
+	_, err := removeGitIgnoreRule(app.config.rootFolder, pattern)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Rule " + pattern + " removed.")
+
+	hasGLFLiteFiles := false
+
+	for _, fileFullPath := range untrackedFiles {
+		if !app.isIgnoredByGit(fileFullPath) {
+			printRed(fmt.Sprintf("File %s isn't ignored by git anymore, add a rule outside of the %s section of the .gitignore file to keep it out of the repository.", fileFullPath, gitIgnoreSeparator))
+		}
+
+		if fileExists(app.getFullPath(getGLFLiteFilePath(fileFullPath))) {
+			hasGLFLiteFiles = true
+		}
+	}
+
+	if hasGLFLiteFiles {
+		fmt.Printf("Run glflite untrack \"%s\" to remove the GLFLite files of the files that aren't tracked anymore.\n", pattern)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGitIgnoreSection(t *testing.T) {
+	folder := t.TempDir()
+
+	for _, test := range []struct {
+		name    string
+		content string
+		rules   string
+		added   string
+		removed string
+	}{
+		{
+			"missing section",
+			"node_modules\n",
+			"",
+			"node_modules\n\n#GitLFSLite\n*.wav\n",
+			"",
+		},
+		{
+			"section at the end",
+			"node_modules\n#GitLFSLite\n*.mp4\n\n",
+			"*.mp4",
+			"node_modules\n#GitLFSLite\n*.mp4\n*.wav\n\n",
+			"node_modules\n#GitLFSLite\n\n",
+		},
+		{
+			"section with an end marker",
+			"#GitLFSLite\n*.mp4\n\n#EndGitLFSLite\n*.wav\nbuild\n",
+			"*.mp4",
+			"#GitLFSLite\n*.mp4\n*.wav\n\n#EndGitLFSLite\n*.wav\nbuild\n",
+			"#GitLFSLite\n\n#EndGitLFSLite\n*.wav\nbuild\n",
+		},
+	} {
+		gitIgnoreFile := folder + "/.gitignore"
+
+		err := os.WriteFile(gitIgnoreFile, []byte(test.content), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rules, err := getGitIgnoreContent(folder)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(rules, ",") != test.rules {
+			t.Errorf("%s: the rules are %v", test.name, rules)
+		}
+
+		// the rules outside of the section aren't removed
+		removed, err := removeGitIgnoreRule(folder, "*.wav")
+
+		if err != nil || removed {
+			t.Errorf("%s: a rule outside of the section was removed: %v", test.name, err)
+		}
+
+		err = addGitIgnoreRule(folder, "*.wav")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if content, _ := os.ReadFile(gitIgnoreFile); string(content) != test.added {
+			t.Errorf("%s: the file with the rule added is %q", test.name, content)
+		}
+
+		if test.removed == "" {
+			continue
+		}
+
+		removed, err = removeGitIgnoreRule(folder, "*.mp4")
+
+		if err != nil || !removed {
+			t.Errorf("%s: the rule wasn't removed: %v", test.name, err)
+		}
+
+		removed, err = removeGitIgnoreRule(folder, "*.wav")
+
+		if err != nil || !removed {
+			t.Errorf("%s: the added rule wasn't removed: %v", test.name, err)
+		}
+
+		if content, _ := os.ReadFile(gitIgnoreFile); string(content) != test.removed {
+			t.Errorf("%s: the file with the rules removed is %q", test.name, content)
+		}
+	}
+}
+
+func TestTrackAndUntrackPattern(t *testing.T) {
+	app := newTestApplication(t, map[string]string{"videos/intro.mp4": "intro video"})
+
+	initTestRepository(t, app, map[string]string{
+		".gitignore":      "build\n" + gitIgnoreSeparator + "\n*.mp4\n" + gitIgnoreEndMarker + "\n",
+		"audio/intro.wav": "intro audio",
+	})
+
+	writeTestFile(t, app, "audio/outro.wav", "outro audio")
+
+	var err error
+
+	app.config.fileRules, err = getGitIgnoreContent(app.config.rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := []fileInformation{
+		{path: "audio", isDirectory: true},
+		{path: "audio/intro.wav"},
+		{path: "audio/outro.wav"},
+		{path: "videos/intro.mp4"},
+		{path: "videos/intro.mp4.glflite"},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		output := captureOutput(t, func() {
+			err = app.trackPattern("*.wav", files, dryRun)
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the committed file has to be removed from the index
+		if !strings.Contains(output, "Files that will be tracked: 2\n") || !strings.Contains(output, "File audio/intro.wav is committed to git") || strings.Contains(output, "outro.wav is committed") {
+			t.Errorf("the track action printed:\n%s", output)
+		}
+	}
+
+	app.config.fileRules, err = getGitIgnoreContent(app.config.rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(app.config.fileRules, ",") != "*.mp4,*.wav" {
+		t.Errorf("the rules are %v", app.config.fileRules)
+	}
+
+	err = app.trackPattern("*.wav", files, false)
+
+	if err == nil || !strings.Contains(err.Error(), "is already in the .gitignore file") {
+		t.Errorf("the rule was added twice: %v", err)
+	}
+
+	output := captureOutput(t, func() {
+		err = app.untrackPattern("*.mp4", false)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, message := range []string{
+		"Files that will stop being tracked: 1\n",
+		"File videos/intro.mp4 isn't ignored by git anymore",
+		"Run glflite untrack \"*.mp4\"",
+	} {
+		if !strings.Contains(output, message) {
+			t.Errorf("the untrack-pattern action didn't print %q:\n%s", message, output)
+		}
+	}
+
+	app.config.fileRules, err = getGitIgnoreContent(app.config.rootFolder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(app.config.fileRules, ",") != "*.wav" {
+		t.Errorf("the rules are %v", app.config.fileRules)
+	}
+
+	err = app.untrackPattern("*.mp4", false)
+
+	if err == nil {
+		t.Error("a missing rule was removed")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// walkReaders is the number of workers that read the folders, the reads
+// mostly wait for the disk.
+const walkReaders = 16
+
+// fileWalker finds the files of the root folder with several goroutines and
+// sends them to a channel. Only the files that match the rules of the
+// #GitLFSLite section and the GLFLite files are sent, unless allFiles is set,
+// the information of the other files isn't read.
+type fileWalker struct {
+	folder     string
+	scope      []scopePattern
+	exclusions walkExclusions
+	fileRules  []string
+	allFiles   bool
+
+	files chan fileInformation
+
+	// the folders waiting for a worker, and the count of the folders queued or being read
+	queue   []walkFolder
+	pending int
+	mutex   sync.Mutex
+	ready   *sync.Cond
+
+	stopped atomic.Bool
+	errOnce sync.Once
+	err     error
+}
+
+// walkFolder is a folder queued for the workers, with the entry read in its
+// parent folder. The entry of the root folder is nil.
+type walkFolder struct {
+	path  string
+	entry fs.DirEntry
+}
+
+// startFileWalk starts the walk of the files of the scope. The files channel
+// is closed at the end of the walk, then err is set if the walk failed.
+func startFileWalk(folder string, scope []scopePattern, exclusions walkExclusions, fileRules []string, allFiles bool) (*fileWalker, error) {
+	walkPaths, err := getWalkPaths(folder, scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fileWalker{
+		folder:     folder,
+		scope:      scope,
+		exclusions: exclusions,
+		fileRules:  fileRules,
+		allFiles:   allFiles,
+		files:      make(chan fileInformation, 256),
+	}
+
+	w.ready = sync.NewCond(&w.mutex)
+
+	// the paths of the scope are visited like a folder, the workers wait until they are queued
+	w.pending = 1
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < walkReaders; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			w.readFolders()
+		}()
+	}
+
+	go func() {
+		for _, walkPath := range getOutermostPaths(walkPaths) {
+			// the files of the submodules given as arguments are found with --recursive
+			if isInsideSubmodule(folder, walkPath) {
+				continue
+			}
+
+			w.walkPath(strings.TrimPrefix(walkPath, "/"))
+		}
+
+		w.doneFolder()
+	}()
+
+	go func() {
+		workers.Wait()
+		close(w.files)
+	}()
+
+	return w, nil
+}
+
+// getOutermostPaths removes the walk paths that are inside another one, so
+// that no file is found twice.
+func getOutermostPaths(walkPaths []string) []string {
+	sorted := append([]string{}, walkPaths...)
+	sort.Strings(sorted)
+
+	var outermost []string
+
+	for _, walkPath := range sorted {
+		last := len(outermost) - 1
+
+		if last >= 0 && (outermost[last] == "" || walkPath == outermost[last] || strings.HasPrefix(walkPath, outermost[last]+"/")) {
+			continue
+		}
+
+		outermost = append(outermost, walkPath)
+	}
+
+	return outermost
+}
+
+func (w *fileWalker) fail(err error) {
+	w.errOnce.Do(func() {
+		w.err = err
+		w.stopped.Store(true)
+	})
+}
+
+// walkPath walks a path of the scope, the root folder when it is empty.
+func (w *fileWalker) walkPath(filePath string) {
+	if filePath == "" {
+		w.queueFolder(walkFolder{})
+
+		return
+	}
+
+	info, err := os.Lstat(w.folder + "/" + filePath)
+
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	w.visit(filePath, fs.FileInfoToDirEntry(info))
+}
+
+// queueFolder adds a folder for the workers, the queue grows with the
+// folders found so that a worker never waits for another one.
+func (w *fileWalker) queueFolder(folder walkFolder) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.queue = append(w.queue, folder)
+	w.pending++
+
+	w.ready.Signal()
+}
+
+// doneFolder counts a folder as read, the workers stop when no folder is
+// queued or being read anymore.
+func (w *fileWalker) doneFolder() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending--
+
+	if w.pending == 0 {
+		w.ready.Broadcast()
+	}
+}
+
+// readFolders is a worker of the walk, it reads the queued folders until all
+// the folders are read.
+func (w *fileWalker) readFolders() {
+	for {
+		w.mutex.Lock()
+
+		for len(w.queue) == 0 && w.pending > 0 {
+			w.ready.Wait()
+		}
+
+		if len(w.queue) == 0 {
+			w.mutex.Unlock()
+			return
+		}
+
+		// the last folder queued is read first, so the queue stays small in a deep tree
+		folder := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+
+		w.mutex.Unlock()
+
+		w.readFolder(folder)
+		w.doneFolder()
+	}
+}
+
+// readFolder reads a folder and visits its files, the subfolders are queued
+// for the workers. The entries of the folder tell if it is a git directory or
+// a submodule, without reading their files.
+func (w *fileWalker) readFolder(folder walkFolder) {
+	if w.stopped.Load() {
+		return
+	}
+
+	entries, err := os.ReadDir(w.folder + "/" + folder.path)
+
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	if folder.path != "" {
+		// exclude the git directories with another name, like the one of GIT_DIR
+		if isGitDirectory(entries) {
+			return
+		}
+
+		// the submodules have their own rules and GLFLite files, they are checked with --recursive
+		if hasEntry(entries, ".git") {
+			return
+		}
+
+		w.sendFile(folder.path, folder.entry)
+	}
+
+	for _, entry := range entries {
+		w.visit(path.Join(folder.path, entry.Name()), entry)
+	}
+}
+
+// isGitDirectory tells if the entries of a folder are the ones of a git
+// directory, a HEAD file and the objects and refs folders.
+func isGitDirectory(entries []fs.DirEntry) bool {
+	isGitDirectory := true
+
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		isGitDirectory = isGitDirectory && hasEntry(entries, name)
+	}
+
+	return isGitDirectory
+}
+
+// hasEntry tells if a folder has a file, the entries are sorted by name.
+func hasEntry(entries []fs.DirEntry, name string) bool {
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Name() >= name
+	})
+
+	return i < len(entries) && entries[i].Name() == name
+}
+
+func (w *fileWalker) visit(filePath string, entry fs.DirEntry) {
+	// exclude the setup file, the .git folder or file and the .gitignore file
+	if filePath == setupFile || filePath == ".git" || strings.HasPrefix(filePath, ".gitignore") {
+		return
+	}
+
+	// the .glfliteignore rules, the folders ignored by git and the other file systems
+	if w.exclusions.isExcluded(filePath, entry) {
+		return
+	}
+
+	// the folders are sent once they are read, they can be git directories or submodules
+	if entry.IsDir() {
+		if canHaveFilesInScope(w.scope, filePath) {
+			w.queueFolder(walkFolder{path: filePath, entry: entry})
+		}
+
+		return
+	}
+
+	w.sendFile(filePath, entry)
+}
+
+// sendFile sends a file of the rules or of the scope to the channel.
+func (w *fileWalker) sendFile(filePath string, entry fs.DirEntry) {
+	if !w.allFiles && !isGLFLiteFile(filePath) && !isFileExcluded(w.fileRules, filePath, entry.IsDir()) {
+		return
+	}
+
+	if !isInScope(w.scope, getTrackedFilePath(filePath)) {
+		return
+	}
+
+	info, err := entry.Info()
+
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	changed, inode := getChangeInformation(info)
+
+	w.files <- fileInformation{
+		path:         filePath,
+		isDirectory:  info.IsDir(),
+		lastModified: info.ModTime(),
+		size:         info.Size(),
+		changed:      changed,
+		inode:        inode,
+	}
+}
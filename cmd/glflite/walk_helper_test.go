@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// walkTestFiles walks the files of the root folder and returns them sorted.
+func walkTestFiles(t *testing.T, app *application, scope []scopePattern, exclusions walkExclusions, allFiles bool) []fileInformation {
+	t.Helper()
+
+	walker, err := startFileWalk(app.config.rootFolder, scope, exclusions, app.config.fileRules, allFiles)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []fileInformation
+
+	for file := range walker.files {
+		files = append(files, file)
+	}
+
+	if walker.err != nil {
+		t.Fatal(walker.err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+
+	return files
+}
+
+func TestGetOutermostPaths(t *testing.T) {
+	for _, test := range []struct {
+		walkPaths string
+		outermost string
+	}{
+		{"/videos,/photos", "/photos,/videos"},
+		{"/videos/2024,/videos", "/videos"},
+		{"/videos,/videos", "/videos"},
+		{"/videos-2024,/videos", "/videos,/videos-2024"},
+		{"/videos,", ""},
+	} {
+		outermost := getOutermostPaths(strings.Split(test.walkPaths, ","))
+
+		if strings.Join(outermost, ",") != test.outermost {
+			t.Errorf("the outermost paths of %s are %v", test.walkPaths, outermost)
+		}
+	}
+}
+
+func TestFileWalk(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	// the files aren't tracked yet, only the rules select them
+	for _, filePath := range []string{"videos/intro.mp4", "videos/2024/outro.mp4", "videos/notes.txt", "photos/cover.raw", "photos/2024/nested/a.txt", "photos/2024/nested/b.mp4", "photos/2024/nested/c.raw.glflite"} {
+		writeTestFile(t, app, filePath, filePath)
+	}
+
+	app.config.fileRules = []string{"*.mp4"}
+
+	for _, test := range []struct {
+		scope    string
+		allFiles bool
+		files    string
+	}{
+		{"", false, "photos/2024/nested/b.mp4,photos/2024/nested/c.raw.glflite,videos/2024/outro.mp4,videos/intro.mp4"},
+		{"", true, "photos,photos/2024,photos/2024/nested,photos/2024/nested/a.txt,photos/2024/nested/b.mp4,photos/2024/nested/c.raw.glflite,photos/cover.raw,videos,videos/2024,videos/2024/outro.mp4,videos/intro.mp4,videos/notes.txt"},
+		{"videos", false, "videos/2024/outro.mp4,videos/intro.mp4"},
+		{"videos/2024,videos", true, "videos,videos/2024,videos/2024/outro.mp4,videos/intro.mp4,videos/notes.txt"},
+	} {
+		var scope []scopePattern
+
+		if test.scope != "" {
+			var err error
+
+			scope, err = app.getScope(strings.Split(test.scope, ","))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var filePaths []string
+
+		for _, file := range walkTestFiles(t, app, scope, walkExclusions{}, test.allFiles) {
+			filePaths = append(filePaths, file.path)
+		}
+
+		if strings.Join(filePaths, ",") != test.files {
+			t.Errorf("the files of the scope %q are %v", test.scope, filePaths)
+		}
+	}
+}
+
+func TestFindTrackedFilesSorted(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	initTestRepository(t, app, nil)
+
+	for _, filePath := range []string{"b/video.mp4", "a/video.mp4", "c.mp4", "notes.txt"} {
+		writeTestFile(t, app, filePath, filePath)
+	}
+
+	app.config.fileRules = []string{"*.mp4"}
+
+	err := app.findTrackedFiles(false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(app.sortedTrackedFiles, ",") != "a/video.mp4,b/video.mp4,c.mp4" {
+		t.Errorf("the tracked files are %v", app.sortedTrackedFiles)
+	}
+
+	for i := 1; i < len(app.files); i++ {
+		if app.files[i-1].path > app.files[i].path {
+			t.Errorf("the files aren't sorted: %s before %s", app.files[i-1].path, app.files[i].path)
+		}
+	}
+}
+
+func TestFileWalkerReadsFoldersWithWorkers(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	var expected []string
+
+	// wide and deep folders, more than the workers
+	for i := 0; i < 50; i++ {
+		folder := fmt.Sprintf("shoots/day%02d", i)
+
+		for depth := 0; depth < 4; depth++ {
+			folder += fmt.Sprintf("/take%d", depth)
+
+			writeTestFile(t, app, folder+"/notes.txt", "notes")
+		}
+
+		writeTestFile(t, app, folder+"/clip.mp4", "clip")
+
+		expected = append(expected, folder+"/clip.mp4")
+	}
+
+	sort.Strings(expected)
+
+	goroutines := runtime.NumGoroutine()
+
+	walker, err := startFileWalk(app.config.rootFolder, nil, walkExclusions{}, []string{"*.mp4"}, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+
+	for file := range walker.files {
+		// the workers, the goroutine of the scope paths and the one that closes the channel
+		if running := runtime.NumGoroutine() - goroutines; running > walkReaders+2 {
+			t.Errorf("%d goroutines read the folders", running)
+		}
+
+		found = append(found, file.path)
+	}
+
+	if walker.err != nil {
+		t.Fatal(walker.err)
+	}
+
+	sort.Strings(found)
+
+	if fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("the walk found %v, expected %v", found, expected)
+	}
+}
+
+func TestFileWalkPrunesFoldersOutsideScope(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the folders that can't be read are read by root")
+	}
+
+	app := newTestApplication(t, nil)
+
+	app.config.fileRules = []string{"*.mp4"}
+
+	writeTestFile(t, app, "videos/2024/intro.mp4", "intro video")
+	writeTestFile(t, app, "archive/old.mp4", "old video")
+
+	// the walk fails if it reads the folder outside of the scope
+	err := os.Chmod(app.getFullPath("archive"), 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chmod(app.getFullPath("archive"), 0755)
+	})
+
+	scope, err := app.getScope([]string{"videos/20*/*.mp4"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the root folder is walked, the pattern starts with a glob after videos/
+	scope = append(scope, scopePattern{pattern: "cover?.raw"})
+
+	files := walkTestFiles(t, app, scope, walkExclusions{}, false)
+
+	if len(files) != 1 || files[0].path != "videos/2024/intro.mp4" {
+		t.Errorf("the files found are %v", files)
+	}
+}
+
+func TestFileWalkSendsFoldersAfterReadingThem(t *testing.T) {
+	app := newTestApplication(t, nil)
+
+	writeTestFile(t, app, "videos/intro.mp4", "intro video")
+
+	// a git directory with another name and a submodule, found from the entries of the folders
+	for _, filePath := range []string{"backup.git/HEAD", "backup.git/objects/info", "backup.git/refs/heads", "libs/assets/.git"} {
+		writeTestFile(t, app, filePath, "")
+	}
+
+	var filePaths []string
+
+	for _, file := range walkTestFiles(t, app, nil, walkExclusions{}, true) {
+		filePaths = append(filePaths, file.path)
+	}
+
+	if strings.Join(filePaths, ",") != "libs,videos,videos/intro.mp4" {
+		t.Errorf("the files found are %v", filePaths)
+	}
+}